@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/auth"
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/internal_types"
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/storage"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+const headerAPIKey = "X-API-Key"
+
+// authenticateAPIKey looks up the key of an X-API-Key header. Rejections are
+// returned as an *echo.HTTPError with the response to send.
+func authenticateAPIKey(ctx echo.Context, keys storage.APIKeyStore, raw string) (auth.Principal, error) {
+	// Malformed keys can't match, don't query the database for them
+	key := internal_types.APIKey{}
+	err := storage.ErrNotFound
+	if auth.LooksLikeKey(raw) {
+		key, err = keys.AuthenticateAPIKey(ctx.Request().Context(), auth.HashKey(raw))
+	}
+	if errors.Is(err, storage.ErrNotFound) {
+		requestLog(ctx).WithFields(log.Fields{"prefix": auth.DisplayPrefix(raw)}).Warn("rejected an unknown or revoked api key")
+		return auth.Principal{}, echo.NewHTTPError(http.StatusUnauthorized, "invalid api key")
+	}
+	if err != nil {
+		return auth.Principal{}, err
+	}
+	return auth.Principal{
+		Method:  auth.MethodAPIKey,
+		Subject: key.ID.String(),
+		Name:    key.Name,
+		Scope:   auth.Scope(key.Scope),
+	}, nil
+}
+
+// newAPIKey generates a key and stores its hash.
+func newAPIKey(ctx context.Context, keys storage.APIKeyStore, name string, scope auth.Scope) (internal_types.CreateAPIKeyResponse, error) {
+	key, err := auth.GenerateKey()
+	if err != nil {
+		return internal_types.CreateAPIKeyResponse{}, err
+	}
+	stored, err := keys.CreateAPIKey(ctx, name, string(scope), auth.DisplayPrefix(key), auth.HashKey(key))
+	if err != nil {
+		return internal_types.CreateAPIKeyResponse{}, err
+	}
+	return internal_types.CreateAPIKeyResponse{APIKey: stored, Key: key}, nil
+}
+
+func listAPIKeys(keys storage.APIKeyStore) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		requestLog(ctx).Info("listing api keys")
+
+		apiKeys, err := keys.ListAPIKeys(ctx.Request().Context())
+		if err != nil {
+			return storageErrorResponse(ctx, err)
+		}
+		ctx.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+		return ctx.JSON(http.StatusOK, map[string][]internal_types.APIKey{
+			"api_keys": apiKeys,
+		})
+	}
+}
+
+func createAPIKey(keys storage.APIKeyStore) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		requestLog(ctx).Info("creating api key")
+
+		body := ctx.Request().Body
+		defer body.Close()
+
+		var request internal_types.CreateAPIKeyRequest
+		fieldErrors, err := decodeJSON(body, &request)
+		if errors.Is(err, errBodyTooLarge) {
+			return ctx.JSON(http.StatusRequestEntityTooLarge, internal_types.ErrorResponse{
+				Error: err.Error(),
+			})
+		}
+		if err != nil {
+			return ctx.JSON(http.StatusBadRequest, internal_types.FieldErrorResponse{
+				Error: "failed to decode json",
+			})
+		}
+		if fieldErrors == nil {
+			fieldErrors = validateStruct(validator.New(validator.WithRequiredStructEnabled()), request, "API Key")
+		}
+		if fieldErrors != nil {
+			return ctx.JSON(http.StatusBadRequest, internal_types.FieldErrorResponse{
+				Error:      "invalid api key data",
+				FieldError: fieldErrors,
+			})
+		}
+
+		created, err := newAPIKey(ctx.Request().Context(), keys, request.Name, auth.Scope(request.Scope))
+		if err != nil {
+			return storageErrorResponse(ctx, err)
+		}
+		requestLog(ctx).WithFields(log.Fields{"api_key_id": created.ID, "api_key_name": created.Name, "scope": created.Scope}).Info("created api key")
+
+		// The key is only ever returned here
+		ctx.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+		return ctx.JSON(http.StatusCreated, created)
+	}
+}
+
+func revokeAPIKey(keys storage.APIKeyStore) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		requestLog(ctx).WithFields(log.Fields{"api_key_id": ctx.Param("id")}).Info("revoking api key")
+
+		keyID, err := uuid.Parse(ctx.Param("id"))
+		if err != nil {
+			return ctx.JSON(http.StatusBadRequest, internal_types.FieldErrorResponse{
+				Error: "invalid api key id",
+				FieldError: []internal_types.FieldError{
+					{
+						Location: "Path",
+						Field:    "id",
+						Message:  "uuid",
+					},
+				},
+			})
+		}
+
+		err = keys.RevokeAPIKey(ctx.Request().Context(), keyID)
+		if errors.Is(err, storage.ErrNotFound) {
+			return ctx.JSON(http.StatusNotFound, internal_types.ErrorResponse{
+				Error: "api key not found",
+			})
+		}
+		if err != nil {
+			return storageErrorResponse(ctx, err)
+		}
+		return ctx.NoContent(http.StatusNoContent)
+	}
+}
+
+// runAPIKey runs an apikey subcommand and returns the process exit code. It
+// is how the first admin key is created.
+func runAPIKey(s *storage.Storage, args []string) int {
+	if len(args) == 0 {
+		printUsage(os.Stderr)
+		return 2
+	}
+
+	if err := s.Open(); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to open storage: %v\n", err)
+		return 1
+	}
+	defer s.Close()
+	ctx := context.Background()
+
+	switch {
+	case args[0] == "create" && len(args) == 3:
+		scope, err := auth.ParseScope(args[2])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 2
+		}
+		created, err := newAPIKey(ctx, s, args[1], scope)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to create api key: %v\n", err)
+			return 1
+		}
+		fmt.Printf("created api key %s (%s) with the %s scope, it won't be shown again:\n%s\n", created.Name, created.ID, created.Scope, created.Key)
+	case args[0] == "list" && len(args) == 1:
+		apiKeys, err := s.ListAPIKeys(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to list api keys: %v\n", err)
+			return 1
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tPREFIX\tSCOPE\tCREATED AT\tLAST USED AT\tREVOKED AT")
+		for _, key := range apiKeys {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", key.ID, key.Name, key.Prefix, key.Scope,
+				key.CreatedAt.Format(time.RFC3339), formatOptionalTime(key.LastUsedAt), formatOptionalTime(key.RevokedAt))
+		}
+		w.Flush()
+	case args[0] == "revoke" && len(args) == 2:
+		keyID, err := uuid.Parse(args[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid api key id %q\n", args[1])
+			return 2
+		}
+		if err := s.RevokeAPIKey(ctx, keyID); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to revoke api key: %v\n", err)
+			return 1
+		}
+		fmt.Printf("revoked api key %s\n", keyID)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown apikey command %q\n\n", strings.Join(args, " "))
+		printUsage(os.Stderr)
+		return 2
+	}
+
+	return 0
+}
+
+func formatOptionalTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/auth"
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/config"
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/internal_types"
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/storage"
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+// contextKeyPrincipal holds the auth.Principal of an authenticated request
+const contextKeyPrincipal = "principal"
+
+// newTokenVerifier returns the verifier of the bearer tokens of the OIDC
+// issuer and its signing keys, or nil when only API keys are accepted. A
+// JWKS file that can't be loaded is a configuration error, while an
+// unreachable identity provider only fails the bearer requests until it is
+// back.
+func newTokenVerifier(ctx context.Context, c *config.Config) (*auth.Verifier, *auth.KeySet, error) {
+	if c.OIDCIssuer == "" {
+		return nil, nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	var keys *auth.KeySet
+	if c.OIDCJWKSFile != "" {
+		keys = auth.NewFileKeySet(c.OIDCJWKSFile)
+		if err := keys.Refresh(ctx); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		keys = auth.NewRemoteKeySet(&http.Client{Timeout: 10 * time.Second}, c.OIDCIssuer, c.OIDCJWKSURL)
+		if err := keys.Refresh(ctx); err != nil {
+			log.WithError(err).WithFields(log.Fields{"issuer": c.OIDCIssuer}).Warn("failed to load the token signing keys, bearer requests fail until they load")
+		}
+	}
+	return auth.NewVerifier(c.OIDCIssuer, c.OIDCAudience, c.OIDCRolesClaim, keys), keys, nil
+}
+
+// requireScope authenticates the request with its bearer token, when tokens
+// is set, or its X-API-Key header and rejects it unless the caller has
+// scope. The caller is available to the handler with principalOf.
+func requireScope(keys storage.APIKeyStore, tokens *auth.Verifier, scope auth.Scope) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			var principal auth.Principal
+			var err error
+			if token, ok := bearerToken(ctx.Request()); ok {
+				principal, err = authenticateToken(ctx, tokens, token)
+			} else if raw := ctx.Request().Header.Get(headerAPIKey); raw != "" {
+				principal, err = authenticateAPIKey(ctx, keys, raw)
+			} else {
+				if tokens != nil {
+					ctx.Response().Header().Set(echo.HeaderWWWAuthenticate, "Bearer")
+				}
+				return ctx.JSON(http.StatusUnauthorized, internal_types.ErrorResponse{
+					Error: "missing api key or bearer token",
+				})
+			}
+			var response *echo.HTTPError
+			if errors.As(err, &response) {
+				return ctx.JSON(response.Code, internal_types.ErrorResponse{
+					Error: fmt.Sprint(response.Message),
+				})
+			}
+			if err != nil {
+				return storageErrorResponse(ctx, err)
+			}
+
+			ctx.Set(contextKeyPrincipal, principal)
+			if !principal.Scope.Allows(scope) {
+				requestLog(ctx).WithFields(log.Fields{"scope": principal.Scope}).Warn("caller lacks the required scope")
+				message := fmt.Sprintf("api key lacks the %s scope", scope)
+				if principal.Method == auth.MethodBearer {
+					message = fmt.Sprintf("token lacks the %s role", auth.RoleFor(scope))
+				}
+				return ctx.JSON(http.StatusForbidden, internal_types.ErrorResponse{
+					Error: message,
+				})
+			}
+			requestLog(ctx).Debug("authenticated caller")
+			return next(ctx)
+		}
+	}
+}
+
+// bearerToken returns the token of an Authorization: Bearer header.
+func bearerToken(request *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(request.Header.Get(echo.HeaderAuthorization), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+// authenticateToken verifies a bearer token. Rejections are returned as an
+// *echo.HTTPError with the response to send.
+func authenticateToken(ctx echo.Context, tokens *auth.Verifier, token string) (auth.Principal, error) {
+	if tokens == nil {
+		return auth.Principal{}, echo.NewHTTPError(http.StatusUnauthorized, "bearer tokens are not accepted")
+	}
+
+	principal, err := tokens.Verify(ctx.Request().Context(), token)
+	if errors.Is(err, auth.ErrInvalidToken) {
+		requestLog(ctx).WithError(err).Warn("rejected a bearer token")
+		ctx.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer error="invalid_token"`)
+		return auth.Principal{}, echo.NewHTTPError(http.StatusUnauthorized, "invalid bearer token")
+	}
+	if err != nil {
+		requestLog(ctx).WithError(err).Error("failed to verify a bearer token")
+		ctx.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+		ctx.Response().Header().Set("Retry-After", "1")
+		return auth.Principal{}, echo.NewHTTPError(http.StatusServiceUnavailable, "identity provider unavailable")
+	}
+	return principal, nil
+}
+
+// principalOf returns the caller authenticated by requireScope.
+func principalOf(ctx echo.Context) (auth.Principal, bool) {
+	principal, ok := ctx.Get(contextKeyPrincipal).(auth.Principal)
+	return principal, ok
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/internal_types"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	headerETag        = "ETag"
+	headerIfNoneMatch = "If-None-Match"
+)
+
+// cachedJSON writes body as JSON with an ETag hashed from its content, so it
+// is the same on every instance, and a Last-Modified header unless
+// lastModified is zero. Conditional requests for an unchanged body are
+// answered with 304 Not Modified.
+func cachedJSON(ctx echo.Context, maxAge time.Duration, lastModified time.Time, body any) error {
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(encoded)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	header := ctx.Response().Header()
+	header.Set(headerETag, etag)
+	header.Set(echo.HeaderCacheControl, cacheControl(maxAge))
+	if !lastModified.IsZero() {
+		header.Set(echo.HeaderLastModified, lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	if notModified(ctx.Request(), etag, lastModified) {
+		return ctx.NoContent(http.StatusNotModified)
+	}
+	return ctx.JSONBlob(http.StatusOK, encoded)
+}
+
+// cacheControl lets browsers and a CDN reuse a response for maxAge, a maxAge
+// of 0 makes them revalidate every time.
+func cacheControl(maxAge time.Duration) string {
+	if maxAge <= 0 {
+		return "no-cache"
+	}
+	return fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds()))
+}
+
+// notModified evaluates If-None-Match and, only when it is absent,
+// If-Modified-Since as described in RFC 9110 section 13.2.2.
+func notModified(request *http.Request, etag string, lastModified time.Time) bool {
+	if values := request.Header.Values(headerIfNoneMatch); len(values) > 0 {
+		for _, value := range values {
+			for _, candidate := range strings.Split(value, ",") {
+				// Weak comparison, a CDN marks the ETag weak when it compresses
+				// the body
+				candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+				if candidate == "*" || candidate == etag {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	if lastModified.IsZero() {
+		return false
+	}
+	since, err := http.ParseTime(request.Header.Get(echo.HeaderIfModifiedSince))
+	if err != nil {
+		return false
+	}
+	// Last-Modified only has second precision
+	return !lastModified.Truncate(time.Second).After(since)
+}
+
+// lastUpdated returns the newest updated_at of the events, or the zero time
+// for no events.
+func lastUpdated(events []internal_types.StoredEvent) time.Time {
+	var latest time.Time
+	for _, event := range events {
+		if event.UpdatedAt.After(latest) {
+			latest = event.UpdatedAt
+		}
+	}
+	return latest
+}
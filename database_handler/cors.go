@@ -0,0 +1,109 @@
+package main
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/config"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// corsExposeHeaders are the response headers browsers let scripts read,
+// besides the safelisted ones.
+var corsExposeHeaders = []string{
+	headerETag,
+	echo.HeaderXRequestID,
+	headerRateLimitLimit,
+	headerRateLimitRemaining,
+	headerRateLimitReset,
+	echo.HeaderRetryAfter,
+}
+
+// corsPolicy is who may call a set of routes from a browser.
+type corsPolicy struct {
+	origins     []string
+	methods     []string
+	headers     []string
+	credentials bool
+	maxAge      int
+}
+
+// middleware returns the CORS middleware of the policy. No origins allows
+// no cross-origin request.
+func (p corsPolicy) middleware() echo.MiddlewareFunc {
+	cors := middleware.CORSConfig{
+		AllowOrigins:     p.origins,
+		AllowMethods:     p.methods,
+		AllowHeaders:     p.headers,
+		AllowCredentials: p.credentials,
+		ExposeHeaders:    corsExposeHeaders,
+		MaxAge:           p.maxAge,
+	}
+	// Echo answers * with *, which lets CDNs share the response, but its own
+	// patterns let * match anything including dots, so they are matched here
+	if !slices.Equal(p.origins, []string{"*"}) {
+		origins := p.origins
+		cors.AllowOrigins = nil
+		cors.AllowOriginFunc = func(origin string) (bool, error) {
+			return slices.ContainsFunc(origins, func(pattern string) bool {
+				return matchOrigin(pattern, origin)
+			}), nil
+		}
+	}
+	return middleware.CORSWithConfig(cors)
+}
+
+// matchOrigin reports whether origin matches pattern, an origin validated by
+// config.ValidOrigin. A *. host prefix matches exactly one label, so
+// https://*.dogdish.cc matches https://admin.dogdish.cc but neither
+// https://dogdish.cc nor https://a.b.dogdish.cc.
+func matchOrigin(pattern, origin string) bool {
+	if pattern == "*" || strings.EqualFold(pattern, origin) {
+		return true
+	}
+	scheme, host, ok := strings.Cut(pattern, "://")
+	domain, wildcard := strings.CutPrefix(host, "*.")
+	if !ok || !wildcard {
+		return false
+	}
+
+	parsed, err := url.Parse(origin)
+	if err != nil || !strings.EqualFold(parsed.Scheme, scheme) || parsed.Host == "" || parsed.Path != "" || parsed.User != nil {
+		return false
+	}
+	label, rest, ok := strings.Cut(parsed.Host, ".")
+	return ok && label != "" && strings.EqualFold(rest, domain)
+}
+
+// corsPolicies applies the admin policy to the admin routes and the public
+// policy to every other route. The route is matched before the middleware
+// runs, so preflight requests get the policy of their route too.
+func corsPolicies(c *config.Config, adminRoute func(route string) bool) echo.MiddlewareFunc {
+	maxAge := int(c.CORSMaxAge.Seconds())
+	public := corsPolicy{
+		origins:     c.CORSPublicOrigins,
+		methods:     c.CORSPublicMethods,
+		headers:     c.CORSPublicHeaders,
+		credentials: c.CORSPublicCredentials,
+		maxAge:      maxAge,
+	}.middleware()
+	admin := corsPolicy{
+		origins:     c.CORSAdminOrigins,
+		methods:     c.CORSAdminMethods,
+		headers:     c.CORSAdminHeaders,
+		credentials: c.CORSAdminCredentials,
+		maxAge:      maxAge,
+	}.middleware()
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		publicNext, adminNext := public(next), admin(next)
+		return func(ctx echo.Context) error {
+			if adminRoute(ctx.Path()) {
+				return adminNext(ctx)
+			}
+			return publicNext(ctx)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/internal_types"
+	"github.com/labstack/echo/v4"
+)
+
+// errBodyTooLarge is returned while reading a body over the limit.
+var errBodyTooLarge = errors.New("request body too large")
+
+// bodyLimit rejects request bodies larger than maxBytes with 413, before
+// reading them when the Content-Length is known.
+func bodyLimit(maxBytes int64) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			request := ctx.Request()
+			if request.ContentLength > maxBytes {
+				return ctx.JSON(http.StatusRequestEntityTooLarge, internal_types.ErrorResponse{
+					Error: errBodyTooLarge.Error(),
+				})
+			}
+			request.Body = http.MaxBytesReader(ctx.Response(), request.Body, maxBytes)
+			return next(ctx)
+		}
+	}
+}
+
+// decodeJSON decodes the body into v, which must be a pointer to a struct.
+// Fields of the body that v doesn't have are reported as field errors
+// instead of being dropped, so a typo doesn't silently lose data. The error
+// is errBodyTooLarge or a syntax or type error.
+func decodeJSON(body io.Reader, v any) ([]internal_types.FieldError, error) {
+	data, err := io.ReadAll(body)
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return nil, errBodyTooLarge
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var raw any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	var fieldErrors []internal_types.FieldError
+	for _, field := range unknownFields(raw, reflect.TypeOf(v), "") {
+		fieldErrors = append(fieldErrors, internal_types.FieldError{
+			Location: "Body",
+			Field:    field,
+			Message:  "unknown field",
+		})
+	}
+	if fieldErrors != nil {
+		return fieldErrors, nil
+	}
+	return nil, json.Unmarshal(data, v)
+}
+
+// unknownFields returns the path of every object key in value that doesn't
+// match a field of t, such as entrees_and_sides[0].preferences. Keys are
+// matched like encoding/json does, case-insensitively.
+func unknownFields(value any, t reflect.Type, path string) []string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	var unknown []string
+	switch value := value.(type) {
+	case map[string]any:
+		// Maps take any key
+		if t.Kind() != reflect.Struct {
+			return nil
+		}
+		fields := jsonFields(t)
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			keyPath := key
+			if path != "" {
+				keyPath = path + "." + key
+			}
+			field, ok := fields[key]
+			if !ok {
+				for name, candidate := range fields {
+					if strings.EqualFold(name, key) {
+						field, ok = candidate, true
+						break
+					}
+				}
+			}
+			if !ok {
+				unknown = append(unknown, keyPath)
+				continue
+			}
+			unknown = append(unknown, unknownFields(value[key], field.Type, keyPath)...)
+		}
+	case []any:
+		if t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
+			return nil
+		}
+		for i, element := range value {
+			unknown = append(unknown, unknownFields(element, t.Elem(), path+"["+strconv.Itoa(i)+"]")...)
+		}
+	}
+	return unknown
+}
+
+// jsonFields returns the fields of a struct by their JSON name, including
+// the fields of embedded structs.
+func jsonFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField)
+	for _, field := range reflect.VisibleFields(t) {
+		if !field.IsExported() {
+			continue
+		}
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = field
+	}
+	return fields
+}
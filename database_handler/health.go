@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/config"
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/migrations"
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/storage"
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// Health statuses, a warning still serves traffic
+	healthPass = "pass"
+	healthWarn = "warn"
+	healthFail = "fail"
+
+	// healthCheckTimeout bounds every check, so a hanging database fails the
+	// probe before Kubernetes times it out
+	healthCheckTimeout = 2 * time.Second
+
+	// poolSaturationWarning is the share of connections in use above which
+	// the pool check warns
+	poolSaturationWarning = 0.9
+)
+
+type HealthCheckResult struct {
+	Status    string         `json:"status"`
+	LatencyMs float64        `json:"latency_ms"`
+	Error     string         `json:"error,omitempty"`
+	Details   map[string]any `json:"details,omitempty"`
+}
+
+type HealthResponse struct {
+	Status  string                       `json:"status"`
+	Version string                       `json:"version,omitempty"`
+	Checks  map[string]HealthCheckResult `json:"checks,omitempty"`
+}
+
+// dependencyCheck checks a dependency. The error is only logged, the client
+// gets the failure message so database details aren't exposed.
+type dependencyCheck struct {
+	name    string
+	failure string
+	run     func(ctx context.Context) (status string, details map[string]any, err error)
+}
+
+// readinessChecks decide whether the instance can serve traffic.
+func readinessChecks(c *config.Config, s *storage.Storage) []dependencyCheck {
+	checks := []dependencyCheck{
+		{
+			name:    "database",
+			failure: "database unreachable",
+			run: func(ctx context.Context) (string, map[string]any, error) {
+				if err := s.Ping(ctx); err != nil {
+					return healthFail, nil, err
+				}
+				return healthPass, nil, nil
+			},
+		},
+		{
+			name:    "pool",
+			failure: "connection pool saturated",
+			run: func(context.Context) (string, map[string]any, error) {
+				return poolStatus(s.Stats())
+			},
+		},
+	}
+
+	if c.SchemaCheck != config.SchemaCheckOff {
+		checks = append(checks, dependencyCheck{
+			name:    "migrations",
+			failure: "database schema does not match the embedded migrations",
+			run: func(ctx context.Context) (string, map[string]any, error) {
+				return migrationStatus(ctx, c, s)
+			},
+		})
+	}
+	return checks
+}
+
+// healthChecks are the readiness checks along with the dependencies the
+// instance can do without.
+func healthChecks(c *config.Config, s *storage.Storage) []dependencyCheck {
+	checks := readinessChecks(c, s)
+	if _, ok := s.ReplicaStats(); ok {
+		checks = append(checks, dependencyCheck{
+			name:    "replica",
+			failure: "replica unreachable, reading from the primary",
+			run: func(ctx context.Context) (string, map[string]any, error) {
+				if _, err := s.PingReplica(ctx); err != nil {
+					return healthWarn, nil, err
+				}
+				return healthPass, nil, nil
+			},
+		})
+	}
+	return checks
+}
+
+func migrationStatus(ctx context.Context, c *config.Config, s *storage.Storage) (string, map[string]any, error) {
+	db, err := s.GetDBConnection()
+	if err != nil {
+		return healthFail, nil, err
+	}
+	expected, err := migrations.ExpectedVersion(s.DBType())
+	if err != nil {
+		return healthFail, nil, err
+	}
+	current, err := migrations.CurrentVersion(ctx, db, s.DBType())
+	if err != nil {
+		return healthFail, nil, err
+	}
+
+	details := map[string]any{"current_version": current, "expected_version": expected}
+	if current == expected {
+		return healthPass, details, nil
+	}
+	status := healthFail
+	if c.SchemaCheck == config.SchemaCheckWarn {
+		status = healthWarn
+	}
+	return status, details, migrations.ErrSchemaMismatch
+}
+
+func poolStatus(stats sql.DBStats) (string, map[string]any, error) {
+	saturation := 0.0
+	if stats.MaxOpenConnections > 0 {
+		saturation = float64(stats.InUse) / float64(stats.MaxOpenConnections)
+	}
+	details := map[string]any{
+		"in_use":               stats.InUse,
+		"max_open_connections": stats.MaxOpenConnections,
+		"wait_count":           stats.WaitCount,
+		"saturation":           saturation,
+	}
+	if saturation >= poolSaturationWarning {
+		return healthWarn, details, errors.New("connection pool saturated")
+	}
+	return healthPass, details, nil
+}
+
+// runHealthChecks runs the checks concurrently. The overall status is the
+// worst status of any check.
+func runHealthChecks(ctx context.Context, checks []dependencyCheck) HealthResponse {
+	response := HealthResponse{
+		Status: healthPass,
+		Checks: make(map[string]HealthCheckResult, len(checks)),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			checkCtx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+			defer cancel()
+			start := time.Now()
+			status, details, err := check.run(checkCtx)
+			result := HealthCheckResult{
+				Status:    status,
+				LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+				Details:   details,
+			}
+			if err != nil {
+				result.Error = check.failure
+				log.WithContext(ctx).WithError(err).WithFields(log.Fields{"check": check.name, "status": status}).Warn("health check failed")
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			response.Checks[check.name] = result
+			if status == healthFail || (status == healthWarn && response.Status == healthPass) {
+				response.Status = status
+			}
+		}()
+	}
+	wg.Wait()
+	return response
+}
+
+func healthStatusCode(response HealthResponse) int {
+	if response.Status == healthFail {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusOK
+}
+
+// livez only reports the process is up, restarting it won't fix a database
+// outage.
+func livez() echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		return ctx.JSON(http.StatusOK, HealthResponse{Status: healthPass})
+	}
+}
+
+// readyz fails while the instance can't serve requests, so it is taken out
+// of the load balancer.
+func readyz(checks []dependencyCheck) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		response := runHealthChecks(ctx.Request().Context(), checks)
+		ctx.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+		return ctx.JSON(healthStatusCode(response), response)
+	}
+}
+
+// healthCheck reports the version and every dependency with its latency.
+func healthCheck(c *config.Config, checks []dependencyCheck) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		requestLog(ctx).WithFields(log.Fields{"version": c.Version}).Info("health check hit")
+
+		response := runHealthChecks(ctx.Request().Context(), checks)
+		response.Version = c.Version
+		ctx.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+		return ctx.JSON(healthStatusCode(response), response)
+	}
+}
@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Scope is what an API key may do. Every scope allows what the scopes
+// before it in Scopes do, so a write key can also read.
+type Scope string
+
+const (
+	ScopeRead  Scope = "read"
+	ScopeWrite Scope = "write"
+	ScopeAdmin Scope = "admin"
+)
+
+// Scopes lists the scopes from the least to the most privileged.
+var Scopes = []Scope{ScopeRead, ScopeWrite, ScopeAdmin}
+
+// ParseScope returns the scope named raw.
+func ParseScope(raw string) (Scope, error) {
+	if !slices.Contains(Scopes, Scope(raw)) {
+		return "", fmt.Errorf("scope %q must be read, write or admin", raw)
+	}
+	return Scope(raw), nil
+}
+
+// Allows reports whether a key with scope s may do what required allows.
+func (s Scope) Allows(required Scope) bool {
+	granted, needed := slices.Index(Scopes, s), slices.Index(Scopes, required)
+	return granted >= 0 && needed >= 0 && granted >= needed
+}
+
+const (
+	// KeyPrefix starts every API key, so a leaked key is easy to recognize
+	KeyPrefix = "dgd_"
+
+	// displayPrefixLength is how much of a key is kept in clear to tell
+	// keys apart
+	displayPrefixLength = len(KeyPrefix) + 8
+
+	keyBytes = 32
+)
+
+// GenerateKey returns a new random API key. Only its hash is stored, the key
+// itself is shown once.
+func GenerateKey() (string, error) {
+	random := make([]byte, keyBytes)
+	if _, err := rand.Read(random); err != nil {
+		return "", fmt.Errorf("failed to generate an api key: %w", err)
+	}
+	return KeyPrefix + base64.RawURLEncoding.EncodeToString(random), nil
+}
+
+// HashKey returns the hash an API key is stored and looked up by. The keys
+// are random, so a fast hash is enough.
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// DisplayPrefix returns the start of key that is stored in clear, so keys
+// can be told apart when listing them.
+func DisplayPrefix(key string) string {
+	if len(key) <= displayPrefixLength {
+		return key
+	}
+	return key[:displayPrefixLength]
+}
+
+// LooksLikeKey reports whether key has the format of a generated key, so
+// malformed values are rejected without a database lookup.
+func LooksLikeKey(key string) bool {
+	encoded, ok := strings.CutPrefix(key, KeyPrefix)
+	if !ok {
+		return false
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(encoded)
+	return err == nil && len(decoded) == keyBytes
+}
@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestScopeAllows(t *testing.T) {
+	for _, test := range []struct {
+		scope    Scope
+		required Scope
+		allowed  bool
+	}{
+		{ScopeRead, ScopeRead, true},
+		{ScopeRead, ScopeWrite, false},
+		{ScopeWrite, ScopeRead, true},
+		{ScopeWrite, ScopeAdmin, false},
+		{ScopeAdmin, ScopeWrite, true},
+		{Scope("owner"), ScopeRead, false},
+		{ScopeAdmin, Scope("owner"), false},
+	} {
+		if allowed := test.scope.Allows(test.required); allowed != test.allowed {
+			t.Errorf("expected %s allows %s to be %t", test.scope, test.required, test.allowed)
+		}
+	}
+}
+
+func TestParseScope(t *testing.T) {
+	if scope, err := ParseScope("write"); err != nil || scope != ScopeWrite {
+		t.Errorf("expected the write scope, got %q, %v", scope, err)
+	}
+	if _, err := ParseScope("Write"); err == nil {
+		t.Errorf("expected an error for an unknown scope")
+	}
+}
+
+func TestGenerateKey(t *testing.T) {
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	other, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	if key == other {
+		t.Errorf("expected two generated keys to differ")
+	}
+
+	if !LooksLikeKey(key) {
+		t.Errorf("expected %q to look like a key", key)
+	}
+	if prefix := DisplayPrefix(key); !strings.HasPrefix(key, prefix) || len(prefix) != displayPrefixLength {
+		t.Errorf("unexpected display prefix %q of %q", prefix, key)
+	}
+	if HashKey(key) == HashKey(other) || HashKey(key) != HashKey(key) {
+		t.Errorf("expected the hash to depend only on the key")
+	}
+}
+
+func TestLooksLikeKey(t *testing.T) {
+	for _, key := range []string{
+		"",
+		"dgd_",
+		"abcdefghijklmnopqrstuvwxyzabcdefghijklmnopq",
+		"dgd_short",
+		"dgd_!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!",
+	} {
+		if LooksLikeKey(key) {
+			t.Errorf("expected %q not to look like a key", key)
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrKeysUnavailable is returned when the signing keys can't be loaded, so
+// a token can't be checked either way.
+var ErrKeysUnavailable = errors.New("signing keys unavailable")
+
+const (
+	// minUnknownKeyRefresh limits the refreshes made for tokens signed with
+	// an unknown key, so random key IDs can't hammer the identity provider
+	minUnknownKeyRefresh = time.Minute
+
+	// maxJWKSBytes bounds the documents read from the identity provider
+	maxJWKSBytes = 1 << 20
+)
+
+// jwk is a JSON Web Key, only the fields of RSA and EC signing keys.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKey is a verification key with the algorithm it is restricted to,
+// if any.
+type publicKey struct {
+	key crypto.PublicKey
+	alg string
+}
+
+// KeySet holds the signing keys of the identity provider by key ID. They
+// are loaded from a JWKS URL, discovered from the issuer when not given, or
+// from a local JWKS file.
+type KeySet struct {
+	load func(ctx context.Context) ([]byte, error)
+
+	mu   sync.RWMutex
+	keys map[string]publicKey
+
+	// lastAttempt is when the keys were last loaded, successfully or not
+	lastAttempt time.Time
+}
+
+// NewRemoteKeySet returns a key set fetched from jwksURL. When jwksURL is
+// empty it is discovered from the OpenID configuration of issuer.
+func NewRemoteKeySet(client *http.Client, issuer, jwksURL string) *KeySet {
+	var discovered sync.Mutex
+	return &KeySet{load: func(ctx context.Context) ([]byte, error) {
+		discovered.Lock()
+		if jwksURL == "" {
+			url, err := discoverJWKSURL(ctx, client, issuer)
+			if err != nil {
+				discovered.Unlock()
+				return nil, err
+			}
+			jwksURL = url
+		}
+		url := jwksURL
+		discovered.Unlock()
+		return fetch(ctx, client, url)
+	}}
+}
+
+// NewFileKeySet returns a key set read from a JWKS file, standing in for an
+// identity provider in tests and local development.
+func NewFileKeySet(path string) *KeySet {
+	return &KeySet{load: func(context.Context) ([]byte, error) {
+		return os.ReadFile(path)
+	}}
+}
+
+// Refresh loads the keys again. The current keys are kept when they can't
+// be loaded.
+func (s *KeySet) Refresh(ctx context.Context) error {
+	s.mu.Lock()
+	s.lastAttempt = time.Now()
+	s.mu.Unlock()
+
+	data, err := s.load(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrKeysUnavailable, err)
+	}
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrKeysUnavailable, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = keys
+	return nil
+}
+
+// key returns the key with the ID kid. An unknown ID loads the keys again
+// first, at most once every minUnknownKeyRefresh, since the identity provider
+// may have rotated them.
+func (s *KeySet) key(ctx context.Context, kid string) (publicKey, bool, error) {
+	s.mu.RLock()
+	key, ok := s.keys[kid]
+	stale := time.Since(s.lastAttempt) >= minUnknownKeyRefresh
+	s.mu.RUnlock()
+	if ok || !stale {
+		return key, ok, nil
+	}
+
+	if err := s.Refresh(ctx); err != nil {
+		return publicKey{}, false, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	key, ok = s.keys[kid]
+	return key, ok, nil
+}
+
+// Watch refreshes the keys every interval until ctx is done.
+func (s *KeySet) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Refresh(ctx); err != nil {
+				log.WithError(err).Warn("keeping the current token signing keys")
+			}
+		}
+	}
+}
+
+// discoverJWKSURL reads jwks_uri from the OpenID configuration of issuer.
+func discoverJWKSURL(ctx context.Context, client *http.Client, issuer string) (string, error) {
+	data, err := fetch(ctx, client, strings.TrimSuffix(issuer, "/")+"/.well-known/openid-configuration")
+	if err != nil {
+		return "", err
+	}
+	var configuration struct {
+		Issuer  string `json:"issuer"`
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := json.Unmarshal(data, &configuration); err != nil {
+		return "", fmt.Errorf("failed to decode the openid configuration: %w", err)
+	}
+	if configuration.Issuer != issuer {
+		return "", fmt.Errorf("openid configuration is for issuer %q, expected %q", configuration.Issuer, issuer)
+	}
+	if configuration.JWKSURI == "" {
+		return "", errors.New("openid configuration has no jwks_uri")
+	}
+	return configuration.JWKSURI, nil
+}
+
+func fetch(ctx context.Context, client *http.Client, url string) ([]byte, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Accept", "application/json")
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: unexpected status %s", url, response.Status)
+	}
+	return io.ReadAll(io.LimitReader(response.Body, maxJWKSBytes))
+}
+
+// parseJWKS returns the signing keys of a JWKS document. Keys of other
+// types or uses are skipped, so one unsupported key doesn't disable the
+// others.
+func parseJWKS(data []byte) (map[string]publicKey, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("failed to decode the jwks: %w", err)
+	}
+
+	keys := make(map[string]publicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{"kid": k.Kid}).Warn("skipping token signing key")
+			continue
+		}
+		keys[k.Kid] = publicKey{key: key, alg: k.Alg}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("jwks has no usable signing keys")
+	}
+	return keys, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid n: %w", err)
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid e: %w", err)
+		}
+		if n.BitLen() < 2048 {
+			return nil, fmt.Errorf("rsa key of %d bits is too small", n.BitLen())
+		}
+		if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid rsa exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		var checked ecdh.Curve
+		switch k.Crv {
+		case "P-256":
+			curve, checked = elliptic.P256(), ecdh.P256()
+		case "P-384":
+			curve, checked = elliptic.P384(), ecdh.P384()
+		case "P-521":
+			curve, checked = elliptic.P521(), ecdh.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		size := (curve.Params().BitSize + 7) / 8
+		x, errX := base64.RawURLEncoding.DecodeString(k.X)
+		y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+		if errX != nil || errY != nil || len(x) != size || len(y) != size {
+			return nil, errors.New("invalid ec coordinates")
+		}
+		// Rejects points that are not on the curve
+		point := append(append([]byte{4}, x...), y...)
+		if _, err := checked.NewPublicKey(point); err != nil {
+			return nil, fmt.Errorf("invalid ec point: %w", err)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBigInt(raw string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, errors.New("empty value")
+	}
+	return new(big.Int).SetBytes(data), nil
+}
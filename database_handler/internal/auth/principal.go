@@ -0,0 +1,66 @@
+package auth
+
+import "slices"
+
+// Role is what a user of the identity provider may do, taken from a claim
+// of their token. Every role maps to the scope of the same access.
+type Role string
+
+const (
+	RoleViewer Role = "viewer"
+	RoleEditor Role = "editor"
+	RoleAdmin  Role = "admin"
+)
+
+// RoleScopes maps the roles to the scopes they are granted.
+var RoleScopes = map[Role]Scope{
+	RoleViewer: ScopeRead,
+	RoleEditor: ScopeWrite,
+	RoleAdmin:  ScopeAdmin,
+}
+
+// RoleFor returns the least privileged role granted scope.
+func RoleFor(scope Scope) Role {
+	for _, role := range []Role{RoleViewer, RoleEditor, RoleAdmin} {
+		if RoleScopes[role] == scope {
+			return role
+		}
+	}
+	return ""
+}
+
+// ScopeOf returns the most privileged scope granted by roles, or "" when
+// none of them is known.
+func ScopeOf(roles []Role) Scope {
+	var scope Scope
+	for _, role := range roles {
+		granted, ok := RoleScopes[role]
+		if ok && slices.Index(Scopes, granted) > slices.Index(Scopes, scope) {
+			scope = granted
+		}
+	}
+	return scope
+}
+
+const (
+	// Ways a principal is authenticated
+	MethodAPIKey = "api_key"
+	MethodBearer = "bearer"
+)
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	// Method is MethodAPIKey or MethodBearer
+	Method string
+
+	// Subject identifies the caller, the key ID or the token's sub claim
+	Subject string
+
+	// Name is the key name or the token's email, when it has one
+	Name string
+
+	Scope Scope
+
+	// Roles are only set for bearer tokens
+	Roles []Role
+}
@@ -0,0 +1,245 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ErrInvalidToken is returned for a bearer token that is malformed, badly
+// signed, expired or meant for another issuer or audience.
+var ErrInvalidToken = errors.New("invalid token")
+
+// clockSkew is how far the clocks of the identity provider and the database
+// handler may drift apart.
+const clockSkew = time.Minute
+
+// algorithms maps the supported JWS algorithms to their hash. Symmetric
+// algorithms and "none" are rejected.
+var algorithms = map[string]crypto.Hash{
+	"RS256": crypto.SHA256,
+	"RS384": crypto.SHA384,
+	"RS512": crypto.SHA512,
+	"ES256": crypto.SHA256,
+	"ES384": crypto.SHA384,
+	"ES512": crypto.SHA512,
+}
+
+// Verifier checks the bearer tokens of an OIDC issuer and maps their roles
+// to scopes.
+type Verifier struct {
+	issuer     string
+	audience   string
+	rolesClaim string
+	keys       *KeySet
+	now        func() time.Time
+}
+
+// NewVerifier returns a verifier of tokens issued by issuer for audience,
+// signed with one of keys. The roles are read from rolesClaim, which may be
+// a dotted path such as realm_access.roles.
+func NewVerifier(issuer, audience, rolesClaim string, keys *KeySet) *Verifier {
+	return &Verifier{
+		issuer:     issuer,
+		audience:   audience,
+		rolesClaim: rolesClaim,
+		keys:       keys,
+		now:        time.Now,
+	}
+}
+
+// claims are the registered claims that are checked.
+type claims struct {
+	Issuer    string   `json:"iss"`
+	Subject   string   `json:"sub"`
+	Audience  audience `json:"aud"`
+	ExpiresAt *float64 `json:"exp"`
+	NotBefore *float64 `json:"nbf"`
+	Email     string   `json:"email"`
+}
+
+// audience is a single audience or a list of them.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return errors.New("aud must be a string or a list of strings")
+	}
+	*a = list
+	return nil
+}
+
+// Verify checks token and returns its principal. The error wraps
+// ErrInvalidToken when the token is rejected, or ErrKeysUnavailable when it
+// couldn't be checked.
+func (v *Verifier) Verify(ctx context.Context, token string) (Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Principal{}, fmt.Errorf("%w: not a signed jwt", ErrInvalidToken)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return Principal{}, fmt.Errorf("%w: header: %v", ErrInvalidToken, err)
+	}
+	hash, ok := algorithms[header.Alg]
+	if !ok {
+		return Principal{}, fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, header.Alg)
+	}
+	key, ok, err := v.keys.key(ctx, header.Kid)
+	if err != nil {
+		return Principal{}, err
+	}
+	if !ok {
+		return Principal{}, fmt.Errorf("%w: unknown signing key %q", ErrInvalidToken, header.Kid)
+	}
+	if key.alg != "" && key.alg != header.Alg {
+		return Principal{}, fmt.Errorf("%w: key %q is not for %s", ErrInvalidToken, header.Kid, header.Alg)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Principal{}, fmt.Errorf("%w: signature: %v", ErrInvalidToken, err)
+	}
+	if !verifySignature(key.key, header.Alg, hash, parts[0]+"."+parts[1], signature) {
+		return Principal{}, fmt.Errorf("%w: bad signature", ErrInvalidToken)
+	}
+
+	var registered claims
+	if err := decodeSegment(parts[1], &registered); err != nil {
+		return Principal{}, fmt.Errorf("%w: claims: %v", ErrInvalidToken, err)
+	}
+	if err := v.check(registered); err != nil {
+		return Principal{}, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	var all map[string]any
+	if err := decodeSegment(parts[1], &all); err != nil {
+		return Principal{}, fmt.Errorf("%w: claims: %v", ErrInvalidToken, err)
+	}
+
+	roles := v.roles(all)
+	return Principal{
+		Method:  MethodBearer,
+		Subject: registered.Subject,
+		Name:    registered.Email,
+		Scope:   ScopeOf(roles),
+		Roles:   roles,
+	}, nil
+}
+
+func (v *Verifier) check(c claims) error {
+	now := v.now()
+	switch {
+	case c.Issuer != v.issuer:
+		return fmt.Errorf("issued by %q", c.Issuer)
+	case !slices.Contains(c.Audience, v.audience):
+		return fmt.Errorf("not meant for audience %q", v.audience)
+	case c.Subject == "":
+		return errors.New("no subject")
+	case c.ExpiresAt == nil:
+		return errors.New("no expiry")
+	case now.Add(-clockSkew).After(numericDate(*c.ExpiresAt)):
+		return errors.New("expired")
+	case c.NotBefore != nil && now.Add(clockSkew).Before(numericDate(*c.NotBefore)):
+		return errors.New("not valid yet")
+	}
+	return nil
+}
+
+// roles returns the known roles listed in the roles claim, a list or a
+// space separated string.
+func (v *Verifier) roles(all map[string]any) []Role {
+	var value any = all
+	for _, key := range strings.Split(v.rolesClaim, ".") {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		value = object[key]
+	}
+
+	var names []string
+	switch value := value.(type) {
+	case string:
+		names = strings.Fields(value)
+	case []any:
+		for _, name := range value {
+			if name, ok := name.(string); ok {
+				names = append(names, name)
+			}
+		}
+	}
+	var roles []Role
+	for _, name := range names {
+		if _, ok := RoleScopes[Role(name)]; ok {
+			roles = append(roles, Role(name))
+		}
+	}
+	return roles
+}
+
+func verifySignature(key crypto.PublicKey, alg string, hash crypto.Hash, signed string, signature []byte) bool {
+	h := hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		return strings.HasPrefix(alg, "RS") && rsa.VerifyPKCS1v15(key, hash, digest, signature) == nil
+	case *ecdsa.PublicKey:
+		// The signature is r and s, each the size of the curve
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if !strings.HasPrefix(alg, "ES") || len(signature) != 2*size || ecdsaHash(key) != hash {
+			return false
+		}
+		r, s := new(big.Int).SetBytes(signature[:size]), new(big.Int).SetBytes(signature[size:])
+		return ecdsa.Verify(key, digest, r, s)
+	default:
+		return false
+	}
+}
+
+// ecdsaHash returns the hash of the ES algorithm of the key's curve, ES256
+// is only valid with P-256.
+func ecdsaHash(key *ecdsa.PublicKey) crypto.Hash {
+	switch key.Curve.Params().BitSize {
+	case 256:
+		return crypto.SHA256
+	case 384:
+		return crypto.SHA384
+	default:
+		return crypto.SHA512
+	}
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// numericDate converts a JWT date, seconds since the epoch, to a time.
+func numericDate(seconds float64) time.Time {
+	return time.Unix(int64(seconds), 0)
+}
@@ -0,0 +1,273 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testIssuer   = "https://login.example.com/realms/dogdish"
+	testAudience = "dogdish"
+)
+
+var (
+	testRSAKey, _ = rsa.GenerateKey(rand.Reader, 2048)
+	testECKey, _  = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+)
+
+func encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// jwks returns the JWKS document of the test keys, by key ID.
+func jwks(t *testing.T, keys map[string]crypto.PublicKey) []byte {
+	t.Helper()
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	for kid, key := range keys {
+		switch key := key.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, jwk{Kty: "RSA", Kid: kid, Use: "sig", Alg: "RS256", N: encode(key.N.Bytes()), E: encode(big.NewInt(int64(key.E)).Bytes())})
+		case *ecdsa.PublicKey:
+			set.Keys = append(set.Keys, jwk{Kty: "EC", Kid: kid, Crv: "P-256", X: encode(key.X.FillBytes(make([]byte, 32))), Y: encode(key.Y.FillBytes(make([]byte, 32)))})
+		}
+	}
+	data, err := json.Marshal(set)
+	if err != nil {
+		t.Fatalf("failed to encode jwks: %v", err)
+	}
+	return data
+}
+
+func writeJWKS(t *testing.T, path string, keys map[string]crypto.PublicKey) {
+	t.Helper()
+
+	if err := os.WriteFile(path, jwks(t, keys), 0o600); err != nil {
+		t.Fatalf("failed to write jwks: %v", err)
+	}
+}
+
+// sign returns a token with claims signed by key, RS256 for RSA keys and
+// ES256 for EC keys.
+func sign(t *testing.T, key crypto.Signer, kid string, claims map[string]any) string {
+	t.Helper()
+
+	alg := "RS256"
+	if _, ok := key.(*ecdsa.PrivateKey); ok {
+		alg = "ES256"
+	}
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("failed to encode claims: %v", err)
+	}
+	signed := encode(header) + "." + encode(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, key, digest[:])
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return signed + "." + encode(signature)
+}
+
+func validClaims() map[string]any {
+	return map[string]any{
+		"iss":   testIssuer,
+		"sub":   "f3b9c2d4",
+		"aud":   []string{"account", testAudience},
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"email": "chef@example.com",
+		"roles": []string{"editor", "unknown"},
+	}
+}
+
+func newTestVerifier(t *testing.T, rolesClaim string) *Verifier {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path, map[string]crypto.PublicKey{"rsa": &testRSAKey.PublicKey, "ec": &testECKey.PublicKey})
+	keys := NewFileKeySet(path)
+	if err := keys.Refresh(context.Background()); err != nil {
+		t.Fatalf("failed to load keys: %v", err)
+	}
+	return NewVerifier(testIssuer, testAudience, rolesClaim, keys)
+}
+
+func TestVerify(t *testing.T) {
+	verifier := newTestVerifier(t, "roles")
+
+	for _, key := range []struct {
+		kid    string
+		signer crypto.Signer
+	}{{"rsa", testRSAKey}, {"ec", testECKey}} {
+		principal, err := verifier.Verify(context.Background(), sign(t, key.signer, key.kid, validClaims()))
+		if err != nil {
+			t.Fatalf("expected a valid %s token, got %v", key.kid, err)
+		}
+		if principal.Method != MethodBearer || principal.Subject != "f3b9c2d4" || principal.Name != "chef@example.com" {
+			t.Errorf("unexpected principal %+v", principal)
+		}
+		if principal.Scope != ScopeWrite || !slices.Equal(principal.Roles, []Role{RoleEditor}) {
+			t.Errorf("expected the editor role to grant the write scope, got %+v", principal)
+		}
+	}
+}
+
+func TestVerifyNestedRoles(t *testing.T) {
+	verifier := newTestVerifier(t, "realm_access.roles")
+
+	claims := validClaims()
+	claims["realm_access"] = map[string]any{"roles": []string{"viewer", "admin"}}
+	principal, err := verifier.Verify(context.Background(), sign(t, testRSAKey, "rsa", claims))
+	if err != nil {
+		t.Fatalf("expected a valid token, got %v", err)
+	}
+	if principal.Scope != ScopeAdmin {
+		t.Errorf("expected the admin scope, got %+v", principal)
+	}
+
+	delete(claims, "realm_access")
+	principal, err = verifier.Verify(context.Background(), sign(t, testRSAKey, "rsa", claims))
+	if err != nil {
+		t.Fatalf("expected a token without roles to be valid, got %v", err)
+	}
+	if principal.Scope != "" || principal.Scope.Allows(ScopeRead) {
+		t.Errorf("expected no scope without roles, got %+v", principal)
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	verifier := newTestVerifier(t, "roles")
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	with := func(key string, value any) map[string]any {
+		claims := validClaims()
+		if value == nil {
+			delete(claims, key)
+		} else {
+			claims[key] = value
+		}
+		return claims
+	}
+	valid := sign(t, testRSAKey, "rsa", validClaims())
+	parts := strings.Split(valid, ".")
+
+	for _, tt := range []struct {
+		name  string
+		token string
+	}{
+		{name: "not a jwt", token: "abc"},
+		{name: "alg none", token: encode([]byte(`{"alg":"none","kid":"rsa"}`)) + "." + parts[1] + "."},
+		{name: "alg HS256", token: encode([]byte(`{"alg":"HS256","kid":"rsa"}`)) + "." + parts[1] + "." + parts[2]},
+		{name: "key for another algorithm", token: encode([]byte(`{"alg":"RS512","kid":"rsa"}`)) + "." + parts[1] + "." + parts[2]},
+		{name: "unknown key", token: sign(t, testRSAKey, "other", validClaims())},
+		{name: "wrong key", token: sign(t, otherKey, "rsa", validClaims())},
+		{name: "tampered", token: parts[0] + "." + encode([]byte(`{"iss":"`+testIssuer+`","sub":"admin","aud":"dogdish","exp":9999999999,"roles":["admin"]}`)) + "." + parts[2]},
+		{name: "other issuer", token: sign(t, testRSAKey, "rsa", with("iss", "https://evil.example.com"))},
+		{name: "other audience", token: sign(t, testRSAKey, "rsa", with("aud", "account"))},
+		{name: "no subject", token: sign(t, testRSAKey, "rsa", with("sub", nil))},
+		{name: "no expiry", token: sign(t, testRSAKey, "rsa", with("exp", nil))},
+		{name: "expired", token: sign(t, testRSAKey, "rsa", with("exp", time.Now().Add(-2*clockSkew).Unix()))},
+		{name: "not valid yet", token: sign(t, testRSAKey, "rsa", with("nbf", time.Now().Add(2*clockSkew).Unix()))},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := verifier.Verify(context.Background(), tt.token); !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("expected ErrInvalidToken, got %v", err)
+			}
+		})
+	}
+
+	// Within the clock skew
+	if _, err := verifier.Verify(context.Background(), sign(t, testRSAKey, "rsa", with("exp", time.Now().Add(-clockSkew/2).Unix()))); err != nil {
+		t.Errorf("expected a token expired within the clock skew to be accepted, got %v", err)
+	}
+}
+
+func TestKeySetRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path, map[string]crypto.PublicKey{"rsa": &testRSAKey.PublicKey})
+	keys := NewFileKeySet(path)
+	if err := keys.Refresh(context.Background()); err != nil {
+		t.Fatalf("failed to load keys: %v", err)
+	}
+	verifier := NewVerifier(testIssuer, testAudience, "roles", keys)
+
+	writeJWKS(t, path, map[string]crypto.PublicKey{"rsa": &testRSAKey.PublicKey, "ec": &testECKey.PublicKey})
+	rotated := sign(t, testECKey, "ec", validClaims())
+	if _, err := verifier.Verify(context.Background(), rotated); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected unknown keys to be reloaded at most every %s, got %v", minUnknownKeyRefresh, err)
+	}
+
+	keys.mu.Lock()
+	keys.lastAttempt = time.Now().Add(-minUnknownKeyRefresh)
+	keys.mu.Unlock()
+	if _, err := verifier.Verify(context.Background(), rotated); err != nil {
+		t.Errorf("expected the rotated key to be loaded, got %v", err)
+	}
+}
+
+func TestKeySetUnavailable(t *testing.T) {
+	verifier := NewVerifier(testIssuer, testAudience, "roles", NewFileKeySet(filepath.Join(t.TempDir(), "missing.json")))
+
+	_, err := verifier.Verify(context.Background(), sign(t, testRSAKey, "rsa", validClaims()))
+	if !errors.Is(err, ErrKeysUnavailable) || errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected ErrKeysUnavailable, got %v", err)
+	}
+}
+
+func TestRemoteKeySetDiscovery(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/.well-known/openid-configuration"):
+			json.NewEncoder(w).Encode(map[string]string{"issuer": server.URL, "jwks_uri": server.URL + "/keys"})
+		case r.URL.Path == "/keys":
+			w.Write(jwks(t, map[string]crypto.PublicKey{"ec": &testECKey.PublicKey}))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	keys := NewRemoteKeySet(server.Client(), server.URL, "")
+	if err := keys.Refresh(context.Background()); err != nil {
+		t.Fatalf("failed to discover keys: %v", err)
+	}
+	claims := validClaims()
+	claims["iss"] = server.URL
+	if _, err := NewVerifier(server.URL, testAudience, "roles", keys).Verify(context.Background(), sign(t, testECKey, "ec", claims)); err != nil {
+		t.Errorf("expected a valid token, got %v", err)
+	}
+
+	// The configuration must be for the issuer
+	if err := NewRemoteKeySet(server.Client(), server.URL+"/realms/other", "").Refresh(context.Background()); err == nil {
+		t.Errorf("expected discovery for another issuer to fail")
+	}
+}
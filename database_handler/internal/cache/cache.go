@@ -0,0 +1,181 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/internal_types"
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/storage"
+	"github.com/google/uuid"
+)
+
+// DefaultTTL is how long front page and menu reads are cached.
+const DefaultTTL = time.Minute
+
+// Repository caches the front page and per date menu reads of another
+// storage.Repository. Every write through it, and Invalidate, drops the whole
+// cache. Entries also expire after the TTL and when the day changes, so the
+// front page flips at midnight.
+type Repository struct {
+	storage.Repository
+
+	ttl time.Duration
+	now func() time.Time
+
+	mu        sync.Mutex
+	frontPage *entry
+	menus     map[string]*entry
+	// generation is bumped on every invalidation, loads that started before
+	// it changed are not cached
+	generation uint64
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+type entry struct {
+	events    []internal_types.StoredEvent
+	day       string
+	expiresAt time.Time
+}
+
+// Stats are the cache counters since startup.
+type Stats struct {
+	Hits    uint64 `json:"hits"`
+	Misses  uint64 `json:"misses"`
+	Entries int    `json:"entries"`
+}
+
+var _ storage.Repository = (*Repository)(nil)
+
+func New(repository storage.Repository, ttl time.Duration) *Repository {
+	return &Repository{
+		Repository: repository,
+		ttl:        ttl,
+		now:        time.Now,
+		menus:      make(map[string]*entry),
+	}
+}
+
+// WithClock overrides the clock used for expiry and the day rollover, it must
+// match the clock of the wrapped repository.
+func (r *Repository) WithClock(now func() time.Time) *Repository {
+	r.now = now
+	return r
+}
+
+func (r *Repository) StoreEvent(ctx context.Context, event internal_types.Event) (uuid.UUID, error) {
+	// Invalidate even on errors, the write may have been committed before a
+	// connection failure
+	defer r.Invalidate()
+	return r.Repository.StoreEvent(ctx, event)
+}
+
+func (r *Repository) GetFrontPageEvents(ctx context.Context) ([]internal_types.StoredEvent, error) {
+	return r.get(
+		func() *entry { return r.frontPage },
+		func(e *entry) { r.frontPage = e },
+		func() ([]internal_types.StoredEvent, error) { return r.Repository.GetFrontPageEvents(ctx) },
+	)
+}
+
+func (r *Repository) GetEventsByDate(ctx context.Context, isoDate string) ([]internal_types.StoredEvent, error) {
+	return r.get(
+		func() *entry { return r.menus[isoDate] },
+		func(e *entry) {
+			// Drop expired menus so dates that are not requested again don't
+			// pile up
+			now := r.now()
+			for date, menu := range r.menus {
+				if !now.Before(menu.expiresAt) {
+					delete(r.menus, date)
+				}
+			}
+			r.menus[isoDate] = e
+		},
+		func() ([]internal_types.StoredEvent, error) { return r.Repository.GetEventsByDate(ctx, isoDate) },
+	)
+}
+
+// Invalidate drops every cached entry. It must be called after any write
+// that does not go through this Repository.
+func (r *Repository) Invalidate() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.frontPage = nil
+	clear(r.menus)
+	r.generation++
+}
+
+func (r *Repository) Stats() Stats {
+	r.mu.Lock()
+	entries := len(r.menus)
+	if r.frontPage != nil {
+		entries++
+	}
+	r.mu.Unlock()
+
+	return Stats{
+		Hits:    r.hits.Load(),
+		Misses:  r.misses.Load(),
+		Entries: entries,
+	}
+}
+
+// get returns the cached entry when it is still fresh, otherwise it loads and
+// stores a new one. Errors are never cached.
+func (r *Repository) get(cached func() *entry, store func(*entry), load func() ([]internal_types.StoredEvent, error)) ([]internal_types.StoredEvent, error) {
+	now := r.now()
+	today := now.Format(time.DateOnly)
+
+	r.mu.Lock()
+	if e := cached(); e != nil && e.day == today && now.Before(e.expiresAt) {
+		r.mu.Unlock()
+		r.hits.Add(1)
+		return copyEvents(e.events), nil
+	}
+	generation := r.generation
+	r.mu.Unlock()
+	r.misses.Add(1)
+
+	events, err := load()
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	if generation == r.generation {
+		store(&entry{
+			events:    copyEvents(events),
+			day:       today,
+			expiresAt: now.Add(r.ttl),
+		})
+	}
+	r.mu.Unlock()
+
+	return events, nil
+}
+
+// copyEvents copies the events deep enough that callers can't modify the
+// cached foods and allergens.
+func copyEvents(events []internal_types.StoredEvent) []internal_types.StoredEvent {
+	copyFoods := func(foods []internal_types.EntreesAndSidesOrSaladBar) []internal_types.EntreesAndSidesOrSaladBar {
+		copied := make([]internal_types.EntreesAndSidesOrSaladBar, len(foods))
+		for ix, food := range foods {
+			food.Allergens = append([]string{}, food.Allergens...)
+			copied[ix] = food
+		}
+		return copied
+	}
+
+	copied := make([]internal_types.StoredEvent, len(events))
+	for ix, event := range events {
+		event.EntreesAndSides = copyFoods(event.EntreesAndSides)
+		event.SaladBar.Toppings = copyFoods(event.SaladBar.Toppings)
+		event.SaladBar.Dressings = copyFoods(event.SaladBar.Dressings)
+		copied[ix] = event
+	}
+	return copied
+}
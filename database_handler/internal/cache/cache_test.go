@@ -0,0 +1,162 @@
+package cache_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/cache"
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/internal_types"
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/storage/memory"
+)
+
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func newEvent(isoDate string) internal_types.Event {
+	return internal_types.Event{
+		Weekday: "Friday",
+		ISODate: isoDate,
+		Cuisine: "Italian",
+		EntreesAndSides: []internal_types.EntreesAndSidesOrSaladBar{
+			{Name: "Lasagna", Allergens: []string{"dairy", "gluten"}, Preference: "vegetarian"},
+		},
+	}
+}
+
+func newRepository(t *testing.T, now time.Time, isoDates ...string) (*cache.Repository, *clock) {
+	t.Helper()
+
+	c := &clock{now: now}
+	inner := memory.NewStorage().WithClock(c.Now)
+	for _, isoDate := range isoDates {
+		if _, err := inner.StoreEvent(context.Background(), newEvent(isoDate)); err != nil {
+			t.Fatalf("failed to store event: %v", err)
+		}
+	}
+	return cache.New(inner, time.Minute).WithClock(c.Now), c
+}
+
+func frontPageDates(t *testing.T, repository *cache.Repository) []string {
+	t.Helper()
+
+	events, err := repository.GetFrontPageEvents(context.Background())
+	if err != nil {
+		t.Fatalf("failed to get front page events: %v", err)
+	}
+	var dates []string
+	for _, event := range events {
+		dates = append(dates, event.ISODate)
+	}
+	return dates
+}
+
+func expectStats(t *testing.T, repository *cache.Repository, hits, misses uint64) {
+	t.Helper()
+
+	if stats := repository.Stats(); stats.Hits != hits || stats.Misses != misses {
+		t.Errorf("expected %d hits and %d misses, got %+v", hits, misses, stats)
+	}
+}
+
+func TestFrontPageIsCached(t *testing.T) {
+	repository, _ := newRepository(t, time.Date(2025, 9, 3, 11, 30, 0, 0, time.Local), "2025-09-03", "2025-09-04")
+
+	first := frontPageDates(t, repository)
+	second := frontPageDates(t, repository)
+	if len(first) != 2 || len(second) != 2 {
+		t.Fatalf("expected 2 front page events, got %v and %v", first, second)
+	}
+	expectStats(t, repository, 1, 1)
+}
+
+func TestStoreEventInvalidates(t *testing.T) {
+	ctx := context.Background()
+	repository, _ := newRepository(t, time.Date(2025, 9, 3, 11, 30, 0, 0, time.Local), "2025-09-03")
+
+	frontPageDates(t, repository)
+	if _, err := repository.GetEventsByDate(ctx, "2025-09-04"); err != nil {
+		t.Fatalf("failed to get menu: %v", err)
+	}
+	if _, err := repository.StoreEvent(ctx, newEvent("2025-09-04")); err != nil {
+		t.Fatalf("failed to store event: %v", err)
+	}
+
+	if dates := frontPageDates(t, repository); len(dates) != 2 {
+		t.Errorf("expected the new event on the front page, got %v", dates)
+	}
+	menu, err := repository.GetEventsByDate(ctx, "2025-09-04")
+	if err != nil || len(menu) != 1 {
+		t.Errorf("expected the new event in the menu, got %v (%v)", menu, err)
+	}
+	expectStats(t, repository, 0, 4)
+}
+
+func TestEntriesExpire(t *testing.T) {
+	repository, c := newRepository(t, time.Date(2025, 9, 3, 11, 30, 0, 0, time.Local), "2025-09-03")
+
+	frontPageDates(t, repository)
+	c.now = c.now.Add(59 * time.Second)
+	frontPageDates(t, repository)
+	c.now = c.now.Add(time.Second)
+	frontPageDates(t, repository)
+
+	expectStats(t, repository, 1, 2)
+}
+
+func TestFrontPageFlipsAtMidnight(t *testing.T) {
+	repository, c := newRepository(t, time.Date(2025, 9, 3, 23, 59, 50, 0, time.Local), "2025-09-02", "2025-09-03", "2025-09-04", "2025-09-05", "2025-09-08")
+
+	before := frontPageDates(t, repository)
+	c.now = time.Date(2025, 9, 4, 0, 0, 5, 0, time.Local)
+	after := frontPageDates(t, repository)
+
+	if before[0] != "2025-09-02" || after[0] != "2025-09-03" {
+		t.Errorf("expected the front page to move on at midnight, got %v then %v", before, after)
+	}
+	expectStats(t, repository, 0, 2)
+}
+
+func TestMenusAreCachedPerDate(t *testing.T) {
+	ctx := context.Background()
+	repository, _ := newRepository(t, time.Date(2025, 9, 3, 11, 30, 0, 0, time.Local), "2025-09-03", "2025-09-04")
+
+	for _, isoDate := range []string{"2025-09-03", "2025-09-04", "2025-09-03", "2025-09-10"} {
+		if _, err := repository.GetEventsByDate(ctx, isoDate); err != nil {
+			t.Fatalf("failed to get menu for %s: %v", isoDate, err)
+		}
+	}
+	expectStats(t, repository, 1, 3)
+	if entries := repository.Stats().Entries; entries != 3 {
+		t.Errorf("expected 3 cached menus, got %d", entries)
+	}
+}
+
+func TestErrorsAreNotCached(t *testing.T) {
+	repository, _ := newRepository(t, time.Date(2025, 9, 3, 11, 30, 0, 0, time.Local))
+
+	for range 2 {
+		if _, err := repository.GetEventsByDate(context.Background(), "not-a-date"); err == nil {
+			t.Fatalf("expected an error for an invalid date")
+		}
+	}
+	expectStats(t, repository, 0, 2)
+}
+
+func TestCachedEventsAreCopied(t *testing.T) {
+	ctx := context.Background()
+	repository, _ := newRepository(t, time.Date(2025, 9, 3, 11, 30, 0, 0, time.Local), "2025-09-03")
+
+	events, _ := repository.GetEventsByDate(ctx, "2025-09-03")
+	events[0].EntreesAndSides[0].Allergens[0] = "changed"
+
+	events, _ = repository.GetEventsByDate(ctx, "2025-09-03")
+	if got := events[0].EntreesAndSides[0].Allergens[0]; got != "dairy" {
+		t.Errorf("expected the cached allergens to be unchanged, got %q", got)
+	}
+}
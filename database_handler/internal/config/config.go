@@ -1,9 +1,22 @@
 package config
 
 import (
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"net/http"
+	"net/url"
 	"os"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/logging"
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/tracing"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
 )
 
 const (
@@ -11,44 +24,633 @@ const (
 )
 
 type Config struct {
-	Port             uint
-	DatabaseHost     string
-	DatabaseUser     string
-	DatabasePassword string
-	DatabasePort     uint
-	DatabaseName     string
-	Version          string
+	Port                          uint
+	HTTPReadTimeout               time.Duration
+	HTTPWriteTimeout              time.Duration
+	HTTPIdleTimeout               time.Duration
+	HTTPMaxBodyBytes              uint
+	TLSCertFile                   string
+	TLSKeyFile                    string
+	OIDCIssuer                    string
+	OIDCAudience                  string
+	OIDCJWKSURL                   string
+	OIDCJWKSFile                  string
+	OIDCRolesClaim                string
+	OIDCJWKSRefreshInterval       time.Duration
+	CORSPublicOrigins             []string
+	CORSPublicMethods             []string
+	CORSPublicHeaders             []string
+	CORSPublicCredentials         bool
+	CORSAdminOrigins              []string
+	CORSAdminMethods              []string
+	CORSAdminHeaders              []string
+	CORSAdminCredentials          bool
+	CORSMaxAge                    time.Duration
+	RateLimitBackend              string
+	RateLimitReadPerMinute        uint
+	RateLimitReadBurst            uint
+	RateLimitWritePerMinute       uint
+	RateLimitWriteBurst           uint
+	RateLimitAuthPerMinute        uint
+	RateLimitAuthBurst            uint
+	DatabaseType                  string
+	DatabaseHost                  string
+	DatabaseUser                  string
+	DatabasePassword              string
+	DatabasePasswordFile          string
+	DatabasePort                  uint
+	DatabaseName                  string
+	DatabaseURL                   string
+	DatabaseURLFile               string
+	DatabaseSSLMode               string
+	DatabaseSSLRootCert           string
+	DatabaseSSLCert               string
+	DatabaseSSLKey                string
+	DatabaseApplicationName       string
+	DatabaseStatementTimeout      time.Duration
+	DatabaseSearchPath            string
+	DatabaseReplicaURL            string
+	DatabaseReplicaURLFile        string
+	DatabaseReplicaReadAfterWrite time.Duration
+	DatabaseMaxOpenConns          uint
+	DatabaseMaxIdleConns          uint
+	DatabaseConnMaxLifetime       time.Duration
+	DatabaseConnMaxIdleTime       time.Duration
+	DatabaseMaxRetries            uint
+	DatabaseRetryBackoff          time.Duration
+	SecretRefreshInterval         time.Duration
+	Production                    bool
+	CacheTTL                      time.Duration
+	HTTPCacheMaxAge               time.Duration
+	ShutdownDelay                 time.Duration
+	ShutdownTimeout               time.Duration
+	SchemaCheck                   string
+	LogLevel                      string
+	LogFormat                     string
+	LogOutput                     string
+	TracingBackend                string
+	OTLPEndpoint                  string
+	Version                       string
+
+	// sources records where every setting that is not a default came from
+	sources map[string]string
+}
+
+const (
+	// SchemaCheck modes, used when the database schema version doesn't match
+	// the embedded migrations at startup
+	SchemaCheckStrict = "strict"
+	SchemaCheckWarn   = "warn"
+	SchemaCheckOff    = "off"
+)
+
+const (
+	// RateLimit backends, where the token buckets of the clients are kept
+	RateLimitMemory   = "memory"
+	RateLimitPostgres = "postgres"
+	RateLimitOff      = "off"
+)
+
+const (
+	// Sources of a setting, from lowest to highest precedence
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+// Error lists every invalid setting, so they can all be fixed at once.
+type Error struct {
+	Problems []string
 }
 
-func Load() *Config {
-	config := &Config{
-		Port:             getEnvAsUintOrDefault(fmt.Sprintf("%s_PORT", EnvPrefix), 1313),
-		DatabaseHost:     getEnvOrDefault(fmt.Sprintf("%s_DB_HOST", EnvPrefix), "localhost"),
-		DatabaseUser:     getEnvOrDefault(fmt.Sprintf("%s_DB_USER", EnvPrefix), "postgres"),
-		DatabasePassword: getEnvOrDefault(fmt.Sprintf("%s_DB_PASS", EnvPrefix), "password"),
-		DatabasePort:     getEnvAsUintOrDefault(fmt.Sprintf("%s_DB_PORT", EnvPrefix), 5432),
-		DatabaseName:     getEnvOrDefault(fmt.Sprintf("%s_DB_NAME", EnvPrefix), "postgres"),
-		Version:          getEnvOrDefault(fmt.Sprintf("%s_VERSION", EnvPrefix), "0.0.0"),
+func (e *Error) Error() string {
+	return "invalid configuration: " + strings.Join(e.Problems, "; ")
+}
+
+// Default returns the configuration used when nothing is set.
+func Default() *Config {
+	return &Config{
+		Port:                          1313,
+		HTTPReadTimeout:               10 * time.Second,
+		HTTPWriteTimeout:              30 * time.Second,
+		HTTPIdleTimeout:               2 * time.Minute,
+		HTTPMaxBodyBytes:              1 << 20,
+		OIDCRolesClaim:                "roles",
+		OIDCJWKSRefreshInterval:       15 * time.Minute,
+		CORSPublicOrigins:             []string{"*"},
+		CORSPublicMethods:             []string{http.MethodGet, http.MethodHead},
+		CORSPublicHeaders:             []string{"If-None-Match", "If-Modified-Since", "X-Request-ID"},
+		CORSAdminMethods:              []string{http.MethodGet, http.MethodPost, http.MethodDelete},
+		CORSAdminHeaders:              []string{"Authorization", "Content-Type", "X-API-Key", "X-Request-ID"},
+		CORSMaxAge:                    10 * time.Minute,
+		RateLimitBackend:              RateLimitMemory,
+		RateLimitReadPerMinute:        600,
+		RateLimitReadBurst:            100,
+		RateLimitWritePerMinute:       60,
+		RateLimitWriteBurst:           10,
+		RateLimitAuthPerMinute:        120,
+		RateLimitAuthBurst:            20,
+		DatabaseType:                  "postgres",
+		DatabaseHost:                  "localhost",
+		DatabaseUser:                  "postgres",
+		DatabasePassword:              "password",
+		DatabasePort:                  5432,
+		DatabaseName:                  "postgres",
+		DatabaseApplicationName:       "database_handler",
+		DatabaseReplicaReadAfterWrite: 5 * time.Second,
+		DatabaseMaxOpenConns:          25,
+		DatabaseMaxIdleConns:          10,
+		DatabaseConnMaxLifetime:       5 * time.Minute,
+		DatabaseConnMaxIdleTime:       1 * time.Minute,
+		DatabaseMaxRetries:            3,
+		DatabaseRetryBackoff:          50 * time.Millisecond,
+		SecretRefreshInterval:         time.Minute,
+		CacheTTL:                      time.Minute,
+		HTTPCacheMaxAge:               time.Minute,
+		ShutdownDelay:                 5 * time.Second,
+		ShutdownTimeout:               20 * time.Second,
+		SchemaCheck:                   SchemaCheckStrict,
+		LogLevel:                      "info",
+		LogFormat:                     logging.FormatJSON,
+		LogOutput:                     logging.OutputStdout,
+		TracingBackend:                tracing.BackendDatadog,
+		Version:                       "0.0.0",
+		sources:                       make(map[string]string),
 	}
-	return config
 }
 
-func getEnvOrDefault(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// setting binds a Config field to a key in the config file. The environment
+// variable is the key in upper case with the DH_ prefix and the flag is the
+// key with dashes, so db_host is DH_DB_HOST and --db-host.
+type setting struct {
+	key    string
+	value  value
+	secret bool
+	usage  string
+}
+
+type value interface {
+	Set(string) error
+	String() string
+}
+
+func (s setting) env() string {
+	return EnvPrefix + "_" + strings.ToUpper(s.key)
+}
+
+func (s setting) flag() string {
+	return strings.ReplaceAll(s.key, "_", "-")
+}
+
+func (c *Config) settings() []setting {
+	return []setting{
+		{key: "port", value: (*uintValue)(&c.Port), usage: "HTTP port"},
+		{key: "http_read_timeout", value: (*durationValue)(&c.HTTPReadTimeout), usage: "time to read a request, headers and body, 0 disables it"},
+		{key: "http_write_timeout", value: (*durationValue)(&c.HTTPWriteTimeout), usage: "time to handle a request and write the response, 0 disables it"},
+		{key: "http_idle_timeout", value: (*durationValue)(&c.HTTPIdleTimeout), usage: "how long idle keep-alive connections are kept, 0 uses the read timeout"},
+		{key: "http_max_body_bytes", value: (*uintValue)(&c.HTTPMaxBodyBytes), usage: "largest request body accepted"},
+		{key: "tls_cert_file", value: (*stringValue)(&c.TLSCertFile), usage: "certificate file, serves HTTPS when set along with tls_key_file"},
+		{key: "tls_key_file", value: (*stringValue)(&c.TLSKeyFile), usage: "private key file of tls_cert_file"},
+		{key: "oidc_issuer", value: (*stringValue)(&c.OIDCIssuer), usage: "OIDC issuer URL whose bearer tokens are accepted, empty only accepts api keys"},
+		{key: "oidc_audience", value: (*stringValue)(&c.OIDCAudience), usage: "aud claim the bearer tokens must have"},
+		{key: "oidc_jwks_url", value: (*stringValue)(&c.OIDCJWKSURL), usage: "JWKS URL of the signing keys, discovered from the issuer when empty"},
+		{key: "oidc_jwks_file", value: (*stringValue)(&c.OIDCJWKSFile), usage: "JWKS file read instead of fetching the signing keys, for tests and local development"},
+		{key: "oidc_roles_claim", value: (*stringValue)(&c.OIDCRolesClaim), usage: "claim listing the viewer, editor or admin roles, such as realm_access.roles"},
+		{key: "oidc_jwks_refresh_interval", value: (*durationValue)(&c.OIDCJWKSRefreshInterval), usage: "how often the signing keys are loaded again"},
+		{key: "cors_public_origins", value: (*listValue)(&c.CORSPublicOrigins), usage: "comma separated origins allowed to read events, * for any, https://*.dogdish.cc for any subdomain"},
+		{key: "cors_public_methods", value: (*listValue)(&c.CORSPublicMethods), usage: "methods allowed cross-origin on the read routes"},
+		{key: "cors_public_headers", value: (*listValue)(&c.CORSPublicHeaders), usage: "request headers allowed cross-origin on the read routes"},
+		{key: "cors_public_credentials", value: (*boolValue)(&c.CORSPublicCredentials), usage: "allow cookies and credentials on cross-origin reads"},
+		{key: "cors_admin_origins", value: (*listValue)(&c.CORSAdminOrigins), usage: "comma separated origins allowed to write, manage keys and debug, none when empty"},
+		{key: "cors_admin_methods", value: (*listValue)(&c.CORSAdminMethods), usage: "methods allowed cross-origin on the admin routes"},
+		{key: "cors_admin_headers", value: (*listValue)(&c.CORSAdminHeaders), usage: "request headers allowed cross-origin on the admin routes"},
+		{key: "cors_admin_credentials", value: (*boolValue)(&c.CORSAdminCredentials), usage: "allow cookies and credentials on cross-origin admin requests"},
+		{key: "cors_max_age", value: (*durationValue)(&c.CORSMaxAge), usage: "how long browsers cache a preflight response"},
+		{key: "rate_limit_backend", value: (*stringValue)(&c.RateLimitBackend), usage: "memory, postgres to share the limits across replicas, or off"},
+		{key: "rate_limit_read_per_minute", value: (*uintValue)(&c.RateLimitReadPerMinute), usage: "GET and HEAD requests a client may make a minute, 0 disables the limit"},
+		{key: "rate_limit_read_burst", value: (*uintValue)(&c.RateLimitReadBurst), usage: "GET and HEAD requests a client may make at once"},
+		{key: "rate_limit_write_per_minute", value: (*uintValue)(&c.RateLimitWritePerMinute), usage: "other requests a client may make a minute, 0 disables the limit"},
+		{key: "rate_limit_write_burst", value: (*uintValue)(&c.RateLimitWriteBurst), usage: "other requests a client may make at once"},
+		{key: "rate_limit_auth_per_minute", value: (*uintValue)(&c.RateLimitAuthPerMinute), usage: "requests an IP may make a minute to the routes needing a key or a token, checked before authenticating, 0 disables the limit"},
+		{key: "rate_limit_auth_burst", value: (*uintValue)(&c.RateLimitAuthBurst), usage: "requests an IP may make at once to the routes needing a key or a token"},
+		{key: "db_type", value: (*stringValue)(&c.DatabaseType), usage: "postgres or sqlite"},
+		{key: "db_host", value: (*stringValue)(&c.DatabaseHost), usage: "Postgres host"},
+		{key: "db_user", value: (*stringValue)(&c.DatabaseUser), usage: "Postgres user"},
+		{key: "db_pass", value: (*stringValue)(&c.DatabasePassword), secret: true, usage: "Postgres password"},
+		{key: "db_pass_file", value: (*stringValue)(&c.DatabasePasswordFile), usage: "file the Postgres password is read from, instead of db_pass"},
+		{key: "db_port", value: (*uintValue)(&c.DatabasePort), usage: "Postgres port"},
+		{key: "db_name", value: (*stringValue)(&c.DatabaseName), usage: "Postgres database, or the SQLite file"},
+		{key: "database_url", value: (*stringValue)(&c.DatabaseURL), secret: true, usage: "Postgres connection URL, replaces the host, port, user, password and database"},
+		{key: "database_url_file", value: (*stringValue)(&c.DatabaseURLFile), usage: "file the Postgres connection URL is read from, instead of database_url"},
+		{key: "db_sslmode", value: (*stringValue)(&c.DatabaseSSLMode), usage: "Postgres sslmode"},
+		{key: "db_sslrootcert", value: (*stringValue)(&c.DatabaseSSLRootCert), usage: "CA certificate file"},
+		{key: "db_sslcert", value: (*stringValue)(&c.DatabaseSSLCert), usage: "client certificate file"},
+		{key: "db_sslkey", value: (*stringValue)(&c.DatabaseSSLKey), usage: "client key file"},
+		{key: "db_application_name", value: (*stringValue)(&c.DatabaseApplicationName), usage: "application_name shown in pg_stat_activity"},
+		{key: "db_statement_timeout", value: (*durationValue)(&c.DatabaseStatementTimeout), usage: "Postgres statement_timeout, 0 keeps the server default"},
+		{key: "db_search_path", value: (*stringValue)(&c.DatabaseSearchPath), usage: "Postgres search_path"},
+		{key: "db_replica_url", value: (*stringValue)(&c.DatabaseReplicaURL), secret: true, usage: "read replica connection URL"},
+		{key: "db_replica_url_file", value: (*stringValue)(&c.DatabaseReplicaURLFile), usage: "file the read replica connection URL is read from, instead of db_replica_url"},
+		{key: "db_replica_read_after_write", value: (*durationValue)(&c.DatabaseReplicaReadAfterWrite), usage: "how long reads stay on the primary after a write"},
+		{key: "db_max_open_conns", value: (*uintValue)(&c.DatabaseMaxOpenConns), usage: "connection pool size"},
+		{key: "db_max_idle_conns", value: (*uintValue)(&c.DatabaseMaxIdleConns), usage: "idle connections kept in the pool"},
+		{key: "db_conn_max_lifetime", value: (*durationValue)(&c.DatabaseConnMaxLifetime), usage: "maximum connection age"},
+		{key: "db_conn_max_idle_time", value: (*durationValue)(&c.DatabaseConnMaxIdleTime), usage: "maximum connection idle time"},
+		{key: "db_max_retries", value: (*uintValue)(&c.DatabaseMaxRetries), usage: "retries of transient database errors"},
+		{key: "db_retry_backoff", value: (*durationValue)(&c.DatabaseRetryBackoff), usage: "initial backoff between retries"},
+		{key: "secret_refresh_interval", value: (*durationValue)(&c.SecretRefreshInterval), usage: "how often the secret and TLS certificate files are re-read"},
+		{key: "production", value: (*boolValue)(&c.Production), usage: "refuse to start with the default credentials"},
+		{key: "cache_ttl", value: (*durationValue)(&c.CacheTTL), usage: "front page and menu cache TTL, 0 disables the cache"},
+		{key: "http_cache_max_age", value: (*durationValue)(&c.HTTPCacheMaxAge), usage: "Cache-Control max-age of event reads"},
+		{key: "shutdown_delay", value: (*durationValue)(&c.ShutdownDelay), usage: "how long /readyz fails before the server stops accepting connections"},
+		{key: "shutdown_timeout", value: (*durationValue)(&c.ShutdownTimeout), usage: "how long in-flight requests are drained for on shutdown"},
+		{key: "schema_check", value: (*stringValue)(&c.SchemaCheck), usage: "strict, warn or off"},
+		{key: "log_level", value: (*stringValue)(&c.LogLevel), usage: "trace, debug, info, warn, error, fatal or panic"},
+		{key: "log_format", value: (*stringValue)(&c.LogFormat), usage: "json or text"},
+		{key: "log_output", value: (*stringValue)(&c.LogOutput), usage: "stdout, stderr or a file path"},
+		{key: "tracing_backend", value: (*stringValue)(&c.TracingBackend), usage: "datadog, otlp or none"},
+		{key: "otlp_endpoint", value: (*stringValue)(&c.OTLPEndpoint), usage: "OTLP/HTTP collector URL such as http://localhost:4318, OTEL_EXPORTER_OTLP_ENDPOINT when empty"},
+		{key: "version", value: (*stringValue)(&c.Version), usage: "version reported by /health"},
 	}
-	fmt.Printf("Environment variable %s not set, using default\n", key)
-	return defaultValue
 }
 
-func getEnvAsUintOrDefault(key string, defaultValue uint) uint {
-	if value := os.Getenv(key); value != "" {
-		if uintValue, err := strconv.Atoi(value); err == nil {
-			return uint(uintValue)
+// Load builds the configuration from, in order of precedence, the command
+// line flags in args, DH_ environment variables, the YAML file given with
+// --config or DH_CONFIG_FILE, and the defaults. It returns the arguments left
+// after the flags. Every invalid value is reported in a single *Error.
+func Load(args []string) (*Config, []string, error) {
+	c := Default()
+	settings := c.settings()
+
+	flags := flag.NewFlagSet("database_handler", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	configFile := flags.String("config", os.Getenv(EnvPrefix+"_CONFIG_FILE"), "")
+	flagValues := make(map[string]string)
+	for _, s := range settings {
+		capture := func(raw string) error {
+			flagValues[s.key] = raw
+			return nil
+		}
+		// Lets --production be given without a value
+		if _, ok := s.value.(*boolValue); ok {
+			flags.BoolFunc(s.flag(), s.usage, capture)
+		} else {
+			flags.Func(s.flag(), s.usage, capture)
 		}
-		fmt.Printf("failed to convert environment variable %s to int, using default\n", key)
-		return defaultValue
 	}
-	fmt.Printf("Environment variable %s not set, using default\n", key)
-	return defaultValue
+	if err := flags.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	var fileValues map[string]string
+	var problems []string
+	if *configFile != "" {
+		var err error
+		fileValues, problems, err = readFile(*configFile, settings)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	apply := func(s setting, source, name, raw string) {
+		if err := s.value.Set(raw); err != nil {
+			if s.secret {
+				problems = append(problems, fmt.Sprintf("%s: invalid value: %v", name, err))
+			} else {
+				problems = append(problems, fmt.Sprintf("%s: invalid value %q: %v", name, raw, err))
+			}
+			return
+		}
+		c.sources[s.key] = source
+	}
+	for _, s := range settings {
+		if raw, ok := fileValues[s.key]; ok {
+			apply(s, SourceFile, fmt.Sprintf("%s: %s", *configFile, s.key), raw)
+		}
+		// Empty variables are treated as unset, like env.example leaves them
+		if raw := os.Getenv(s.env()); raw != "" {
+			apply(s, SourceEnv, s.env(), raw)
+		}
+		if raw, ok := flagValues[s.key]; ok {
+			apply(s, SourceFlag, "--"+s.flag(), raw)
+		}
+	}
+
+	problems = append(problems, c.validate()...)
+	if len(problems) > 0 {
+		slices.Sort(problems)
+		return nil, nil, &Error{Problems: problems}
+	}
+	return c, flags.Args(), nil
+}
+
+// readFile reads the flat YAML config file. Unknown keys and values that are
+// not scalars are returned as problems.
+func readFile(path string, settings []setting) (map[string]string, []string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var nodes map[string]yaml.Node
+	if err := yaml.Unmarshal(data, &nodes); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	values := make(map[string]string, len(nodes))
+	var problems []string
+	for key, node := range nodes {
+		if !slices.ContainsFunc(settings, func(s setting) bool { return s.key == key }) {
+			problems = append(problems, fmt.Sprintf("%s: unknown setting %q", path, key))
+			continue
+		}
+		switch {
+		case node.Kind != yaml.ScalarNode:
+			problems = append(problems, fmt.Sprintf("%s: %s must be a single value", path, key))
+		case node.Tag == "!!null":
+			// Same as leaving the key out
+		default:
+			values[key] = node.Value
+		}
+	}
+	return values, problems, nil
+}
+
+func (c *Config) validate() []string {
+	var problems []string
+	if c.Port == 0 || c.Port > 65535 {
+		problems = append(problems, fmt.Sprintf("port %d must be between 1 and 65535", c.Port))
+	}
+	if !slices.Contains([]string{SchemaCheckStrict, SchemaCheckWarn, SchemaCheckOff}, c.SchemaCheck) {
+		problems = append(problems, fmt.Sprintf("schema check %q must be strict, warn or off", c.SchemaCheck))
+	}
+	if _, err := log.ParseLevel(c.LogLevel); err != nil {
+		problems = append(problems, fmt.Sprintf("log level %q must be trace, debug, info, warn, error, fatal or panic", c.LogLevel))
+	}
+	if !slices.Contains(logging.Formats, c.LogFormat) {
+		problems = append(problems, fmt.Sprintf("log format %q must be json or text", c.LogFormat))
+	}
+	if !tracing.Valid(c.TracingBackend) {
+		problems = append(problems, fmt.Sprintf("tracing backend %q must be datadog, otlp or none", c.TracingBackend))
+	}
+	if c.CacheTTL < 0 {
+		problems = append(problems, fmt.Sprintf("cache ttl %s cannot be negative", c.CacheTTL))
+	}
+	if c.HTTPCacheMaxAge < 0 {
+		problems = append(problems, fmt.Sprintf("http cache max age %s cannot be negative", c.HTTPCacheMaxAge))
+	}
+	for _, timeout := range []struct {
+		name  string
+		value time.Duration
+	}{{"http read timeout", c.HTTPReadTimeout}, {"http write timeout", c.HTTPWriteTimeout}, {"http idle timeout", c.HTTPIdleTimeout}} {
+		if timeout.value < 0 {
+			problems = append(problems, fmt.Sprintf("%s %s cannot be negative", timeout.name, timeout.value))
+		}
+	}
+	if c.HTTPMaxBodyBytes == 0 {
+		problems = append(problems, "http max body bytes must be positive")
+	}
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		problems = append(problems, "tls_cert_file and tls_key_file must be set together")
+	}
+	if c.OIDCIssuer != "" {
+		if issuer, err := url.Parse(c.OIDCIssuer); err != nil || !issuer.IsAbs() || issuer.Host == "" {
+			problems = append(problems, fmt.Sprintf("oidc issuer %q must be an absolute URL", c.OIDCIssuer))
+		}
+		if c.OIDCAudience == "" {
+			problems = append(problems, "oidc_audience must be set along with oidc_issuer")
+		}
+		if c.OIDCRolesClaim == "" {
+			problems = append(problems, "oidc roles claim cannot be empty")
+		}
+		if c.OIDCJWKSRefreshInterval <= 0 {
+			problems = append(problems, fmt.Sprintf("oidc jwks refresh interval %s must be positive", c.OIDCJWKSRefreshInterval))
+		}
+	}
+	if c.OIDCJWKSURL != "" && c.OIDCJWKSFile != "" {
+		problems = append(problems, "oidc_jwks_url and oidc_jwks_file cannot both be set")
+	}
+	for _, policy := range []struct {
+		name        string
+		origins     []string
+		methods     []string
+		credentials bool
+	}{{"cors_public", c.CORSPublicOrigins, c.CORSPublicMethods, c.CORSPublicCredentials}, {"cors_admin", c.CORSAdminOrigins, c.CORSAdminMethods, c.CORSAdminCredentials}} {
+		for _, origin := range policy.origins {
+			if !ValidOrigin(origin) {
+				problems = append(problems, fmt.Sprintf("%s_origins: origin %q must be *, or a scheme and host such as https://dogdish.cc or https://*.dogdish.cc", policy.name, origin))
+			}
+		}
+		if policy.credentials && slices.Contains(policy.origins, "*") {
+			problems = append(problems, fmt.Sprintf("%s_credentials needs the allowed origins listed, browsers reject it with *", policy.name))
+		}
+		if len(policy.origins) > 0 && len(policy.methods) == 0 {
+			problems = append(problems, fmt.Sprintf("%s_methods cannot be empty", policy.name))
+		}
+		for _, method := range policy.methods {
+			if !slices.Contains(corsMethods, method) {
+				problems = append(problems, fmt.Sprintf("%s_methods: method %q must be one of %s", policy.name, method, strings.Join(corsMethods, ", ")))
+			}
+		}
+	}
+	if c.CORSMaxAge < 0 {
+		problems = append(problems, fmt.Sprintf("cors max age %s cannot be negative", c.CORSMaxAge))
+	}
+	if !slices.Contains([]string{RateLimitMemory, RateLimitPostgres, RateLimitOff}, c.RateLimitBackend) {
+		problems = append(problems, fmt.Sprintf("rate limit backend %q must be memory, postgres or off", c.RateLimitBackend))
+	}
+	if c.RateLimitBackend == RateLimitPostgres && c.DatabaseType != "postgres" {
+		problems = append(problems, fmt.Sprintf("rate limit backend postgres needs db_type postgres, not %q", c.DatabaseType))
+	}
+	for _, budget := range []struct {
+		name      string
+		perMinute uint
+		burst     uint
+	}{{"rate_limit_read", c.RateLimitReadPerMinute, c.RateLimitReadBurst}, {"rate_limit_write", c.RateLimitWritePerMinute, c.RateLimitWriteBurst}, {"rate_limit_auth", c.RateLimitAuthPerMinute, c.RateLimitAuthBurst}} {
+		if budget.perMinute > 0 && budget.burst == 0 {
+			problems = append(problems, fmt.Sprintf("%s_burst must be positive, set %s_per_minute to 0 to disable the limit", budget.name, budget.name))
+		}
+	}
+	if c.ShutdownDelay < 0 {
+		problems = append(problems, fmt.Sprintf("shutdown delay %s cannot be negative", c.ShutdownDelay))
+	}
+	if c.ShutdownTimeout <= 0 {
+		problems = append(problems, fmt.Sprintf("shutdown timeout %s must be positive", c.ShutdownTimeout))
+	}
+	if c.SecretRefreshInterval <= 0 {
+		problems = append(problems, fmt.Sprintf("secret refresh interval %s must be positive", c.SecretRefreshInterval))
+	}
+	// The file wins over the value in storage, setting both is a mistake
+	for _, pair := range [][2]string{{"db_pass", "db_pass_file"}, {"database_url", "database_url_file"}, {"db_replica_url", "db_replica_url_file"}} {
+		if c.sources[pair[0]] != "" && c.sources[pair[1]] != "" {
+			problems = append(problems, fmt.Sprintf("%s and %s cannot both be set", pair[0], pair[1]))
+		}
+	}
+	if c.Production {
+		problems = append(problems, c.defaultCredentials()...)
+	}
+	return problems
+}
+
+// corsMethods are the methods a CORS policy may allow.
+var corsMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// ValidOrigin reports whether origin is *, or a scheme and host with an
+// optional port. The first label of the host may be *, matching one
+// subdomain label.
+func ValidOrigin(origin string) bool {
+	if origin == "*" {
+		return true
+	}
+	scheme, host, ok := strings.Cut(origin, "://")
+	if !ok || (scheme != "http" && scheme != "https") {
+		return false
+	}
+	if wildcard, ok := strings.CutPrefix(host, "*."); ok {
+		host = wildcard
+	}
+	parsed, err := url.Parse(scheme + "://" + host)
+	return err == nil && parsed.Host == host && parsed.Hostname() != "" && !strings.Contains(host, "*") && parsed.User == nil
+}
+
+// defaultCredentials returns a problem for the user and the password from
+// Default that Postgres would be connected with. The secret files are read
+// the way the storage reads them, so the defaults can't slip in through them.
+func (c *Config) defaultCredentials() []string {
+	if c.DatabaseType != "postgres" {
+		return nil
+	}
+
+	defaults := Default()
+	user, password := c.DatabaseUser, c.DatabasePassword
+	databaseURL, key := c.DatabaseURL, "database_url"
+	var err error
+	switch {
+	case c.DatabaseURLFile != "":
+		key = "database_url_file"
+		databaseURL, err = readSecretFile(c.DatabaseURLFile)
+	case c.DatabaseURL == "" && c.DatabasePasswordFile != "":
+		key = "db_pass_file"
+		password, err = readSecretFile(c.DatabasePasswordFile)
+	}
+	if err != nil {
+		return []string{fmt.Sprintf("production requires %s to be readable to check for the default credentials: %v", key, err)}
+	}
+	if databaseURL != "" {
+		parsed, err := url.Parse(databaseURL)
+		if err != nil {
+			return []string{fmt.Sprintf("%s is not a valid URL", key)}
+		}
+		user, password = parsed.User.Username(), ""
+		if secret, ok := parsed.User.Password(); ok {
+			password = secret
+		}
+	}
+
+	var problems []string
+	if user == defaults.DatabaseUser {
+		problems = append(problems, fmt.Sprintf("production requires a database user other than the default %s user", defaults.DatabaseUser))
+	}
+	if password == defaults.DatabasePassword {
+		problems = append(problems, "production requires db_pass, db_pass_file, database_url or database_url_file to set a password, the default password is in use")
+	}
+	return problems
+}
+
+// readSecretFile reads a secret file like the storage does, without the
+// trailing newline.
+func readSecretFile(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
+
+// Usage writes every setting with its flag, environment variable and default.
+func Usage(w io.Writer) {
+	defaults := Default()
+	fmt.Fprintf(w, "  --config FILE, %s_CONFIG_FILE\n        YAML file with the settings below, keyed like db_host\n", EnvPrefix)
+	for _, s := range defaults.settings() {
+		fmt.Fprintf(w, "  --%s, %s\n        %s", s.flag(), s.env(), s.usage)
+		if value := s.value.String(); value != "" && !s.secret {
+			fmt.Fprintf(w, " (default %s)", value)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+type stringValue string
+
+func (v *stringValue) Set(raw string) error {
+	*v = stringValue(raw)
+	return nil
+}
+
+func (v *stringValue) String() string {
+	return string(*v)
+}
+
+type uintValue uint
+
+func (v *uintValue) Set(raw string) error {
+	parsed, err := strconv.ParseUint(raw, 10, 0)
+	if err != nil {
+		return errors.Unwrap(err)
+	}
+	*v = uintValue(parsed)
+	return nil
+}
+
+func (v *uintValue) String() string {
+	return strconv.FormatUint(uint64(*v), 10)
+}
+
+type boolValue bool
+
+func (v *boolValue) Set(raw string) error {
+	parsed, err := strconv.ParseBool(raw)
+	if err != nil {
+		return errors.New("expected true or false")
+	}
+	*v = boolValue(parsed)
+	return nil
+}
+
+func (v *boolValue) String() string {
+	return strconv.FormatBool(bool(*v))
+}
+
+// listValue is a comma separated list, blank items are dropped.
+type listValue []string
+
+func (v *listValue) Set(raw string) error {
+	var items []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	*v = items
+	return nil
+}
+
+func (v *listValue) String() string {
+	return strings.Join(*v, ",")
+}
+
+type durationValue time.Duration
+
+func (v *durationValue) Set(raw string) error {
+	parsed, err := time.ParseDuration(raw)
+	if err != nil {
+		return errors.New("expected a duration such as 30s or 5m")
+	}
+	*v = durationValue(parsed)
+	return nil
+}
+
+func (v *durationValue) String() string {
+	return time.Duration(*v).String()
 }
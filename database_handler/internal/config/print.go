@@ -0,0 +1,56 @@
+package config
+
+import (
+	"io"
+	"net/url"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Redacted replaces secret values in printed configurations.
+const Redacted = "[redacted]"
+
+// Print writes the configuration as a config file, with the source of every
+// setting as a comment and secrets redacted.
+func (c *Config) Print(w io.Writer) error {
+	document := &yaml.Node{Kind: yaml.MappingNode}
+	for _, s := range c.settings() {
+		value := s.value.String()
+		if s.secret {
+			value = redact(value)
+		}
+
+		source, ok := c.sources[s.key]
+		if !ok {
+			source = SourceDefault
+		}
+
+		document.Content = append(document.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Value: s.key},
+			&yaml.Node{Kind: yaml.ScalarNode, Value: value, LineComment: source},
+		)
+	}
+
+	encoder := yaml.NewEncoder(w)
+	defer encoder.Close()
+	return encoder.Encode(document)
+}
+
+// redact hides the password of a connection URL, keeping the rest readable,
+// and every other secret entirely.
+func redact(value string) string {
+	if value == "" {
+		return ""
+	}
+
+	parsed, err := url.Parse(value)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return Redacted
+	}
+	if query := parsed.Query(); query.Has("password") {
+		query.Set("password", "xxxxx")
+		parsed.RawQuery = query.Encode()
+	}
+	// Replaces the password with xxxxx
+	return parsed.Redacted()
+}
@@ -1,5 +1,11 @@
 package internal_types
 
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
 type EntreesAndSidesOrSaladBar struct {
 	Name       string   `json:"name" validate:"required"`
 	Allergens  []string `json:"allergens" validate:"required"`
@@ -19,6 +25,12 @@ type Event struct {
 	SaladBar        SaladBar                    `json:"salad_bar" validate:"required"`
 }
 
+type StoredEvent struct {
+	ID uuid.UUID `json:"id"`
+	Event
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
 type FieldErrorResponse struct {
 	Error      string       `json:"error"`
 	FieldError []FieldError `json:"field_errors"`
@@ -32,3 +44,26 @@ type FieldError struct {
 	Field    string `json:"field"`
 	Message  string `json:"message"`
 }
+
+// APIKey is a stored API key. The key itself is never stored, only its hash,
+// and Prefix tells keys apart.
+type APIKey struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scope      string     `json:"scope"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name  string `json:"name" validate:"required,max=255"`
+	Scope string `json:"scope" validate:"required,oneof=read write admin"`
+}
+
+// CreateAPIKeyResponse is the only time the key is returned.
+type CreateAPIKeyResponse struct {
+	APIKey
+	Key string `json:"key"`
+}
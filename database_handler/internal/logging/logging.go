@@ -0,0 +1,100 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// Log formats
+	FormatJSON = "json"
+	FormatText = "text"
+
+	// Log outputs, any other output is a file path
+	OutputStdout = "stdout"
+	OutputStderr = "stderr"
+)
+
+// Formats lists the supported log formats.
+var Formats = []string{FormatJSON, FormatText}
+
+// Configure sets the level, format and output of the standard logger and adds
+// the request ID to every entry logged with a request context. The returned
+// closer closes the log file, if any.
+func Configure(level, format, output string) (io.Closer, error) {
+	parsedLevel, err := log.ParseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(Formats, format) {
+		return nil, fmt.Errorf("log format %q must be json or text", format)
+	}
+
+	var w io.WriteCloser
+	switch output {
+	case OutputStdout:
+		w = nopCloser{os.Stdout}
+	case OutputStderr:
+		w = nopCloser{os.Stderr}
+	default:
+		file, err := os.OpenFile(output, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open log file: %w", err)
+		}
+		w = file
+	}
+
+	log.SetLevel(parsedLevel)
+	if format == FormatText {
+		log.SetFormatter(&log.TextFormatter{FullTimestamp: true})
+	} else {
+		log.SetFormatter(&log.JSONFormatter{})
+	}
+	log.SetOutput(w)
+	log.StandardLogger().ReplaceHooks(log.LevelHooks{})
+	log.AddHook(requestIDHook{})
+	return w, nil
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns a context whose log entries carry the request ID.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestID returns the request ID of ctx, or "" outside a request.
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// requestIDHook adds the request ID to entries logged with log.WithContext.
+type requestIDHook struct{}
+
+func (requestIDHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+func (requestIDHook) Fire(entry *log.Entry) error {
+	if entry.Context == nil {
+		return nil
+	}
+	if requestID := RequestID(entry.Context); requestID != "" {
+		entry.Data["request_id"] = requestID
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package logging
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestConfigure(t *testing.T) {
+	t.Cleanup(func() {
+		if _, err := Configure("info", FormatJSON, OutputStdout); err != nil {
+			t.Errorf("failed to restore logging: %v", err)
+		}
+	})
+
+	path := filepath.Join(t.TempDir(), "database_handler.log")
+	output, err := Configure("warn", FormatJSON, path)
+	if err != nil {
+		t.Fatalf("failed to configure logging: %v", err)
+	}
+	ctx := WithRequestID(context.Background(), "req-1")
+	log.WithContext(ctx).Info("below the level")
+	log.WithContext(ctx).Warn("with a request")
+	log.Warn("without a request")
+	if err := output.Close(); err != nil {
+		t.Fatalf("failed to close log file: %v", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read log file: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines at warn level, got %q", content)
+	}
+	for i, expected := range []string{"req-1", ""} {
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(lines[i]), &entry); err != nil {
+			t.Fatalf("expected a JSON line, got %q", lines[i])
+		}
+		if requestID, _ := entry["request_id"].(string); requestID != expected {
+			t.Errorf("expected request_id %q, got %q in %s", expected, requestID, lines[i])
+		}
+	}
+}
+
+func TestConfigureInvalid(t *testing.T) {
+	if _, err := Configure("loud", FormatJSON, OutputStdout); err == nil {
+		t.Errorf("expected an unknown level to be rejected")
+	}
+	if _, err := Configure("info", "xml", OutputStdout); err == nil {
+		t.Errorf("expected an unknown format to be rejected")
+	}
+	if _, err := Configure("info", FormatText, filepath.Join(t.TempDir(), "missing", "dh.log")); err == nil {
+		t.Errorf("expected an unwritable file to be rejected")
+	}
+}
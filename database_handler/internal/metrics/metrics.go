@@ -0,0 +1,216 @@
+package metrics
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Namespace prefixes every metric name.
+const Namespace = "dogdish"
+
+// Metrics holds the Prometheus metrics of the database handler. The record
+// methods do nothing on a nil *Metrics, so it can be left out in tests.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	requestDuration     *prometheus.HistogramVec
+	eventsCreated       prometheus.Counter
+	validationFailures  *prometheus.CounterVec
+	foodsStored         *prometheus.CounterVec
+	allergensDiscovered prometheus.Counter
+	rateLimited         *prometheus.CounterVec
+}
+
+// New creates the metrics on their own registry, along with the Go runtime
+// and process metrics.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by route and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		eventsCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "events_created_total",
+			Help:      "Events stored.",
+		}),
+		validationFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "event_validation_failures_total",
+			Help:      "Events rejected by validation, by the field that failed.",
+		}, []string{"field"}),
+		foodsStored: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "foods_stored_total",
+			Help:      "Foods stored, by food type.",
+		}, []string{"food_type"}),
+		allergensDiscovered: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "allergens_discovered_total",
+			Help:      "Allergens stored for the first time.",
+		}),
+		rateLimited: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "rate_limited_total",
+			Help:      "Requests rejected by the rate limit, by budget.",
+		}, []string{"budget"}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requestDuration,
+		m.eventsCreated,
+		m.validationFailures,
+		m.foodsStored,
+		m.allergensDiscovered,
+		m.rateLimited,
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// MustRegister adds a collector, such as the one returned by DBStats.
+func (m *Metrics) MustRegister(collector prometheus.Collector) {
+	m.registry.MustRegister(collector)
+}
+
+// Middleware records the latency of every request under its Echo route, so
+// /event/:id is a single series whatever the id.
+func (m *Metrics) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			start := time.Now()
+			err := next(ctx)
+
+			// The error handler writes the response after the middleware
+			// returns, so the status has to be taken from the error
+			status := ctx.Response().Status
+			if err != nil {
+				var httpErr *echo.HTTPError
+				if errors.As(err, &httpErr) {
+					status = httpErr.Code
+				} else if !ctx.Response().Committed {
+					status = http.StatusInternalServerError
+				}
+			}
+			// Unknown paths are not routes, keep them out of the labels
+			route := ctx.Path()
+			if route == "" {
+				route = "unmatched"
+			}
+
+			m.requestDuration.WithLabelValues(ctx.Request().Method, route, strconv.Itoa(status)).Observe(time.Since(start).Seconds())
+			return err
+		}
+	}
+}
+
+// EventCreated records a stored event and its foods by type.
+func (m *Metrics) EventCreated(foodsByType map[string]int) {
+	if m == nil {
+		return
+	}
+	m.eventsCreated.Inc()
+	for foodType, count := range foodsByType {
+		m.foodsStored.WithLabelValues(foodType).Add(float64(count))
+	}
+}
+
+// ValidationFailed records an event rejected because of field.
+func (m *Metrics) ValidationFailed(field string) {
+	if m == nil {
+		return
+	}
+	m.validationFailures.WithLabelValues(field).Inc()
+}
+
+// AllergensDiscovered records allergens stored for the first time.
+func (m *Metrics) AllergensDiscovered(count int) {
+	if m == nil || count == 0 {
+		return
+	}
+	m.allergensDiscovered.Add(float64(count))
+}
+
+// RateLimited records a request rejected because budget ran out.
+func (m *Metrics) RateLimited(budget string) {
+	if m == nil {
+		return
+	}
+	m.rateLimited.WithLabelValues(budget).Inc()
+}
+
+// DBStats returns a collector of the connection pool stats. Every pool is
+// reported with its name as the pool label, stats returns false for a pool
+// that isn't configured.
+func DBStats(pools map[string]func() (sql.DBStats, bool)) prometheus.Collector {
+	return &dbStatsCollector{pools: pools}
+}
+
+type dbStatsCollector struct {
+	pools map[string]func() (sql.DBStats, bool)
+}
+
+var (
+	dbMaxOpenConnections = dbStatsDesc("max_open_connections", "Maximum number of open connections.")
+	dbOpenConnections    = dbStatsDesc("open_connections", "Established connections, in use and idle.")
+	dbInUse              = dbStatsDesc("in_use_connections", "Connections currently in use.")
+	dbIdle               = dbStatsDesc("idle_connections", "Idle connections.")
+	dbWaitCount          = dbStatsDesc("wait_count_total", "Connections waited for.")
+	dbWaitDuration       = dbStatsDesc("wait_duration_seconds_total", "Time spent waiting for a connection.")
+	dbMaxIdleClosed      = dbStatsDesc("max_idle_closed_total", "Connections closed because of the max idle connections.")
+	dbMaxIdleTimeClosed  = dbStatsDesc("max_idle_time_closed_total", "Connections closed because of the max idle time.")
+	dbMaxLifetimeClosed  = dbStatsDesc("max_lifetime_closed_total", "Connections closed because of the max lifetime.")
+)
+
+func dbStatsDesc(name, help string) *prometheus.Desc {
+	return prometheus.NewDesc(prometheus.BuildFQName(Namespace, "db", name), help, []string{"pool"}, nil)
+}
+
+func (c *dbStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{
+		dbMaxOpenConnections, dbOpenConnections, dbInUse, dbIdle, dbWaitCount,
+		dbWaitDuration, dbMaxIdleClosed, dbMaxIdleTimeClosed, dbMaxLifetimeClosed,
+	} {
+		ch <- desc
+	}
+}
+
+func (c *dbStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	for pool, statsFn := range c.pools {
+		stats, ok := statsFn()
+		if !ok {
+			continue
+		}
+		gauge := func(desc *prometheus.Desc, value float64) {
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, pool)
+		}
+		counter := func(desc *prometheus.Desc, value float64) {
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, value, pool)
+		}
+		gauge(dbMaxOpenConnections, float64(stats.MaxOpenConnections))
+		gauge(dbOpenConnections, float64(stats.OpenConnections))
+		gauge(dbInUse, float64(stats.InUse))
+		gauge(dbIdle, float64(stats.Idle))
+		counter(dbWaitCount, float64(stats.WaitCount))
+		counter(dbWaitDuration, stats.WaitDuration.Seconds())
+		counter(dbMaxIdleClosed, float64(stats.MaxIdleClosed))
+		counter(dbMaxIdleTimeClosed, float64(stats.MaxIdleTimeClosed))
+		counter(dbMaxLifetimeClosed, float64(stats.MaxLifetimeClosed))
+	}
+}
@@ -0,0 +1,94 @@
+package metrics
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func scrape(t *testing.T, m *Metrics) string {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body, err := io.ReadAll(rec.Body)
+	if err != nil {
+		t.Fatalf("failed to read metrics: %v", err)
+	}
+	return string(body)
+}
+
+func TestMiddleware(t *testing.T) {
+	m := New()
+	e := echo.New()
+	e.Use(m.Middleware())
+	e.GET("/event/:id", func(ctx echo.Context) error {
+		if ctx.Param("id") == "missing" {
+			return echo.NewHTTPError(http.StatusNotFound)
+		}
+		return ctx.NoContent(http.StatusOK)
+	})
+	e.GET("/fail", func(ctx echo.Context) error {
+		return errors.New("boom")
+	})
+
+	for _, target := range []string{"/event/1", "/event/2", "/event/missing", "/fail", "/no/such/route"} {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+	}
+
+	metrics := scrape(t, m)
+	for _, expected := range []string{
+		`dogdish_http_request_duration_seconds_count{method="GET",route="/event/:id",status="200"} 2`,
+		`dogdish_http_request_duration_seconds_count{method="GET",route="/event/:id",status="404"} 1`,
+		`dogdish_http_request_duration_seconds_count{method="GET",route="/fail",status="500"} 1`,
+		`dogdish_http_request_duration_seconds_count{method="GET",route="unmatched",status="404"} 1`,
+	} {
+		if !strings.Contains(metrics, expected) {
+			t.Errorf("expected the metrics to contain %q, got\n%s", expected, metrics)
+		}
+	}
+}
+
+func TestBusinessMetrics(t *testing.T) {
+	m := New()
+	m.EventCreated(map[string]int{"entrees_and_sides": 2, "toppings": 1})
+	m.EventCreated(map[string]int{"entrees_and_sides": 1})
+	m.ValidationFailed("Name")
+	m.AllergensDiscovered(3)
+	m.RateLimited("writes")
+	m.MustRegister(DBStats(map[string]func() (sql.DBStats, bool){
+		"primary": func() (sql.DBStats, bool) { return sql.DBStats{MaxOpenConnections: 25, InUse: 4}, true },
+		"replica": func() (sql.DBStats, bool) { return sql.DBStats{}, false },
+	}))
+
+	metrics := scrape(t, m)
+	for _, expected := range []string{
+		"dogdish_events_created_total 2",
+		`dogdish_foods_stored_total{food_type="entrees_and_sides"} 3`,
+		`dogdish_foods_stored_total{food_type="toppings"} 1`,
+		`dogdish_event_validation_failures_total{field="Name"} 1`,
+		"dogdish_allergens_discovered_total 3",
+		`dogdish_rate_limited_total{budget="writes"} 1`,
+		`dogdish_db_max_open_connections{pool="primary"} 25`,
+		`dogdish_db_in_use_connections{pool="primary"} 4`,
+	} {
+		if !strings.Contains(metrics, expected) {
+			t.Errorf("expected the metrics to contain %q, got\n%s", expected, metrics)
+		}
+	}
+	if strings.Contains(metrics, `pool="replica"`) {
+		t.Errorf("expected no replica metrics without a replica")
+	}
+
+	// Handlers and storages without metrics pass nil
+	var disabled *Metrics
+	disabled.EventCreated(map[string]int{"toppings": 1})
+	disabled.ValidationFailed("Name")
+	disabled.AllergensDiscovered(1)
+}
@@ -0,0 +1,150 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/storage"
+	"github.com/pressly/goose/v3"
+	"github.com/pressly/goose/v3/database"
+)
+
+// The Postgres migrations create the application user through goose ENVSUB,
+// so DATABASE_USER and DATABASE_PASSWORD must be set when they run.
+//
+//go:embed postgres/*.sql sqlite/*.sql
+var embedded embed.FS
+
+// ErrSchemaMismatch is returned by Check when the database schema version is
+// not the one the queries were generated against.
+var ErrSchemaMismatch = errors.New("schema version mismatch")
+
+func source(dbType storage.DBType) (fs.FS, goose.Dialect, error) {
+	switch dbType {
+	case storage.DBTypePostgres:
+		fsys, err := fs.Sub(embedded, "postgres")
+		return fsys, goose.DialectPostgres, err
+	case storage.DBTypeSQLite:
+		fsys, err := fs.Sub(embedded, "sqlite")
+		return fsys, goose.DialectSQLite3, err
+	default:
+		return nil, "", fmt.Errorf("database type %s not supported", dbType)
+	}
+}
+
+func newProvider(db *sql.DB, dbType storage.DBType) (*goose.Provider, error) {
+	fsys, dialect, err := source(dbType)
+	if err != nil {
+		return nil, err
+	}
+	return goose.NewProvider(dialect, db, fsys)
+}
+
+// Up applies every pending migration.
+func Up(ctx context.Context, db *sql.DB, dbType storage.DBType) ([]*goose.MigrationResult, error) {
+	provider, err := newProvider(db, dbType)
+	if err != nil {
+		return nil, err
+	}
+	return provider.Up(ctx)
+}
+
+// Down rolls back the most recently applied migration.
+func Down(ctx context.Context, db *sql.DB, dbType storage.DBType) (*goose.MigrationResult, error) {
+	provider, err := newProvider(db, dbType)
+	if err != nil {
+		return nil, err
+	}
+	return provider.Down(ctx)
+}
+
+// Status returns every embedded migration along with whether it was applied.
+func Status(ctx context.Context, db *sql.DB, dbType storage.DBType) ([]*goose.MigrationStatus, error) {
+	provider, err := newProvider(db, dbType)
+	if err != nil {
+		return nil, err
+	}
+	return provider.Status(ctx)
+}
+
+// ExpectedVersion returns the version of the newest embedded migration, which
+// is the schema the sqlc queries are generated against.
+func ExpectedVersion(dbType storage.DBType) (int64, error) {
+	fsys, _, err := source(dbType)
+	if err != nil {
+		return 0, err
+	}
+	files, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return 0, err
+	}
+
+	var expected int64
+	for _, file := range files {
+		version, err := goose.NumericComponent(path.Base(file))
+		if err != nil {
+			return 0, fmt.Errorf("invalid migration file name %s: %w", file, err)
+		}
+		expected = max(expected, version)
+	}
+	return expected, nil
+}
+
+// CurrentVersion returns the schema version recorded in the database, or 0
+// when no migrations were applied. Unlike Status it never creates the goose
+// version table, so it is safe to run as the application user.
+func CurrentVersion(ctx context.Context, db *sql.DB, dbType storage.DBType) (int64, error) {
+	_, dialect, err := source(dbType)
+	if err != nil {
+		return 0, err
+	}
+	store, err := database.NewStore(dialect, goose.DefaultTablename)
+	if err != nil {
+		return 0, err
+	}
+
+	if extender, ok := store.(database.StoreExtender); ok {
+		exists, err := extender.TableExists(ctx, db)
+		if errors.Is(err, errors.ErrUnsupported) {
+			// Not every dialect can check, fall through to reading the version
+			exists, err = true, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to check for the goose version table: %w", err)
+		}
+		if !exists {
+			return 0, nil
+		}
+	}
+
+	version, err := store.GetLatestVersion(ctx, db)
+	if errors.Is(err, database.ErrVersionNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get the schema version: %w", err)
+	}
+	return version, nil
+}
+
+// Check compares the database schema version with ExpectedVersion and
+// returns an error wrapping ErrSchemaMismatch when they differ.
+func Check(ctx context.Context, db *sql.DB, dbType storage.DBType) error {
+	expected, err := ExpectedVersion(dbType)
+	if err != nil {
+		return err
+	}
+	current, err := CurrentVersion(ctx, db, dbType)
+	if err != nil {
+		return err
+	}
+	if current != expected {
+		return fmt.Errorf("%w: database is at version %d, expected version %d", ErrSchemaMismatch, current, expected)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package migrations_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/migrations"
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/storage"
+)
+
+func TestExpectedVersion(t *testing.T) {
+	for _, dbType := range []storage.DBType{storage.DBTypePostgres, storage.DBTypeSQLite} {
+		version, err := migrations.ExpectedVersion(dbType)
+		if err != nil {
+			t.Fatalf("%s: failed to get expected version: %v", dbType, err)
+		}
+		if version < 1 {
+			t.Errorf("%s: expected at least one embedded migration, got version %d", dbType, version)
+		}
+	}
+
+	if _, err := migrations.ExpectedVersion("oracle"); err == nil {
+		t.Errorf("expected an error for an unsupported database type")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	ctx := context.Background()
+
+	s := storage.NewStorage().
+		WithDBType(storage.DBTypeSQLite).
+		WithDatabase(filepath.Join(t.TempDir(), "dogdish.db"))
+	if err := s.Open(); err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+	defer s.Close()
+	db, _ := s.GetDBConnection()
+
+	if version, err := migrations.CurrentVersion(ctx, db, storage.DBTypeSQLite); err == nil && version != 0 {
+		t.Errorf("expected a fresh database to be at version 0, got %d", version)
+	}
+	if err := migrations.Check(ctx, db, storage.DBTypeSQLite); err == nil {
+		t.Errorf("expected a fresh database to fail the schema check")
+	}
+
+	if _, err := migrations.Up(ctx, db, storage.DBTypeSQLite); err != nil {
+		t.Fatalf("failed to apply migrations: %v", err)
+	}
+	if err := migrations.Check(ctx, db, storage.DBTypeSQLite); err != nil {
+		t.Errorf("expected the schema check to pass after migrating, got %v", err)
+	}
+
+	if _, err := migrations.Down(ctx, db, storage.DBTypeSQLite); err != nil {
+		t.Fatalf("failed to roll back migration: %v", err)
+	}
+	if err := migrations.Check(ctx, db, storage.DBTypeSQLite); !errors.Is(err, migrations.ErrSchemaMismatch) {
+		t.Errorf("expected ErrSchemaMismatch after rolling back, got %v", err)
+	}
+}
+
+func TestUniqueNamesMigrationMergesDuplicates(t *testing.T) {
+	ctx := context.Background()
+
+	s := storage.NewStorage().
+		WithDBType(storage.DBTypeSQLite).
+		WithDatabase(filepath.Join(t.TempDir(), "dogdish.db"))
+	if err := s.Open(); err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+	defer s.Close()
+	db, _ := s.GetDBConnection()
+
+	// Go back to version 1, without the unique indexes, to seed duplicates
+	results, err := migrations.Up(ctx, db, storage.DBTypeSQLite)
+	if err != nil {
+		t.Fatalf("failed to apply migrations: %v", err)
+	}
+	for range len(results) - 1 {
+		if _, err := migrations.Down(ctx, db, storage.DBTypeSQLite); err != nil {
+			t.Fatalf("failed to roll back migration: %v", err)
+		}
+	}
+	_, err = db.ExecContext(ctx, `
+		INSERT INTO cuisine (id, name) VALUES ('c1', 'Italian'), ('c2', ' italian');
+		INSERT INTO event (id, date, iso_date) VALUES ('e1', 'Friday', '2025-08-29');
+		INSERT INTO food (id, cuisine_id, event_id, name, food_type) VALUES
+			('f1', 'c1', 'e1', 'Lasagna', 'entrees_and_sides'),
+			('f2', 'c2', 'e1', 'Croutons', 'toppings');
+		INSERT INTO allergen (id, name) VALUES ('a1', 'gluten'), ('a2', 'Gluten '), ('a3', 'dairy');
+		INSERT INTO food_allergen (food_id, allergen_id) VALUES ('f1', 'a1'), ('f1', 'a2'), ('f1', 'a3'), ('f2', 'a2');
+	`)
+	if err != nil {
+		t.Fatalf("failed to seed duplicates: %v", err)
+	}
+
+	if _, err := migrations.Up(ctx, db, storage.DBTypeSQLite); err != nil {
+		t.Fatalf("failed to apply migrations: %v", err)
+	}
+
+	var cuisines, allergens, foodAllergens int
+	err = db.QueryRowContext(ctx, `SELECT
+		(SELECT COUNT(*) FROM cuisine),
+		(SELECT COUNT(*) FROM allergen),
+		(SELECT COUNT(*) FROM food_allergen)`).Scan(&cuisines, &allergens, &foodAllergens)
+	if err != nil {
+		t.Fatalf("failed to count rows: %v", err)
+	}
+	if cuisines != 1 || allergens != 2 || foodAllergens != 3 {
+		t.Errorf("expected 1 cuisine, 2 allergens and 3 food allergens, got %d, %d and %d", cuisines, allergens, foodAllergens)
+	}
+
+	var cuisineID string
+	if err := db.QueryRowContext(ctx, `SELECT cuisine_id FROM food WHERE id = 'f2'`).Scan(&cuisineID); err != nil || cuisineID != "c1" {
+		t.Errorf("expected food f2 to point at cuisine c1, got %q (%v)", cuisineID, err)
+	}
+}
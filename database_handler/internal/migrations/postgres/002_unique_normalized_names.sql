@@ -0,0 +1,43 @@
+-- +goose Up
+-- Merge allergens and cuisines that only differ by case or surrounding
+-- whitespace into the oldest row before adding the unique indexes.
+CREATE TEMPORARY TABLE allergen_merge ON COMMIT DROP AS
+SELECT id, FIRST_VALUE(id) OVER (PARTITION BY LOWER(BTRIM(name)) ORDER BY ctid) AS keep_id
+FROM dogdish.allergen;
+
+UPDATE dogdish.food_allergen fa SET allergen_id = m.keep_id
+FROM allergen_merge m
+WHERE fa.allergen_id = m.id AND m.id <> m.keep_id;
+
+DELETE FROM dogdish.food_allergen fa
+USING dogdish.food_allergen duplicate
+WHERE fa.food_id = duplicate.food_id
+  AND fa.allergen_id = duplicate.allergen_id
+  AND fa.ctid > duplicate.ctid;
+
+DELETE FROM dogdish.allergen a
+USING allergen_merge m
+WHERE a.id = m.id AND m.id <> m.keep_id;
+
+CREATE TEMPORARY TABLE cuisine_merge ON COMMIT DROP AS
+SELECT id, FIRST_VALUE(id) OVER (PARTITION BY LOWER(BTRIM(name)) ORDER BY ctid) AS keep_id
+FROM dogdish.cuisine;
+
+UPDATE dogdish.food f SET cuisine_id = m.keep_id
+FROM cuisine_merge m
+WHERE f.cuisine_id = m.id AND m.id <> m.keep_id;
+
+DELETE FROM dogdish.cuisine c
+USING cuisine_merge m
+WHERE c.id = m.id AND m.id <> m.keep_id;
+
+UPDATE dogdish.allergen SET name = BTRIM(name) WHERE name <> BTRIM(name);
+UPDATE dogdish.cuisine SET name = BTRIM(name) WHERE name <> BTRIM(name);
+
+CREATE UNIQUE INDEX allergen_name_normalized_key ON dogdish.allergen (LOWER(BTRIM(name)));
+CREATE UNIQUE INDEX cuisine_name_normalized_key ON dogdish.cuisine (LOWER(BTRIM(name)));
+
+-- +goose Down
+-- Merged rows are not split up again
+DROP INDEX IF EXISTS dogdish.cuisine_name_normalized_key;
+DROP INDEX IF EXISTS dogdish.allergen_name_normalized_key;
@@ -0,0 +1,6 @@
+-- +goose Up
+-- Events stored before this migration get the time it ran.
+ALTER TABLE dogdish.event ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+-- +goose Down
+ALTER TABLE dogdish.event DROP COLUMN IF EXISTS updated_at;
@@ -0,0 +1,16 @@
+-- +goose Up
+-- Only the SHA-256 of a key is stored, the prefix tells keys apart in
+-- listings. Revoked keys are kept so their usage stays auditable.
+CREATE TABLE dogdish.api_key (
+  id UUID PRIMARY KEY NOT NULL DEFAULT gen_random_uuid(),
+  name VARCHAR(255) NOT NULL,
+  prefix VARCHAR(16) NOT NULL,
+  hash CHAR(64) UNIQUE NOT NULL,
+  scope VARCHAR(16) NOT NULL CHECK (scope IN ('read', 'write', 'admin')),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  last_used_at TIMESTAMPTZ NULL,
+  revoked_at TIMESTAMPTZ NULL
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS dogdish.api_key;
@@ -0,0 +1,15 @@
+-- +goose Up
+-- Token buckets shared by the replicas with DH_RATE_LIMIT_BACKEND=postgres.
+-- Every request rewrites its bucket, so the table is unlogged: a crash only
+-- loses the buckets, which is the same as refilling them.
+CREATE UNLOGGED TABLE dogdish.rate_limit_bucket (
+  key VARCHAR(255) PRIMARY KEY NOT NULL,
+  tokens DOUBLE PRECISION NOT NULL,
+  allowed BOOLEAN NOT NULL,
+  updated_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX rate_limit_bucket_updated_at_idx ON dogdish.rate_limit_bucket (updated_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS dogdish.rate_limit_bucket;
@@ -0,0 +1,34 @@
+-- +goose Up
+-- The cuisine and foods of an event in the JSON shape every event read
+-- returns, no row when it has no foods. A function rather than a view, so
+-- the reads join it LATERAL per event and Postgres inlines it.
+-- +goose StatementBegin
+CREATE FUNCTION dogdish.event_foods(event_id UUID)
+RETURNS TABLE (cuisine TEXT, foods JSON)
+LANGUAGE sql STABLE
+AS $$
+    SELECT
+        MIN(c.name)::text,
+        JSON_AGG(
+            JSON_BUILD_OBJECT(
+                'name', f.name,
+                'food_type', f.food_type,
+                'preference', COALESCE(f.preference::text, ''),
+                'allergens', COALESCE(fa.allergen_names, '{}')
+            ) ORDER BY f.name
+        )
+    FROM dogdish.food f
+    JOIN dogdish.cuisine c ON c.id = f.cuisine_id
+    LEFT JOIN LATERAL (
+        SELECT ARRAY_AGG(a.name ORDER BY a.name) AS allergen_names
+        FROM dogdish.food_allergen fa
+        JOIN dogdish.allergen a ON a.id = fa.allergen_id
+        WHERE fa.food_id = f.id
+    ) fa ON true
+    WHERE f.event_id = $1
+    HAVING COUNT(f.id) > 0
+$$;
+-- +goose StatementEnd
+
+-- +goose Down
+DROP FUNCTION IF EXISTS dogdish.event_foods(UUID);
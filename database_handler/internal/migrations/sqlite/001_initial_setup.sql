@@ -0,0 +1,38 @@
+-- +goose Up
+CREATE TABLE cuisine (
+  id TEXT PRIMARY KEY NOT NULL,
+  name TEXT NOT NULL
+);
+CREATE TABLE event (
+  id TEXT PRIMARY KEY NOT NULL,
+  date TEXT NOT NULL,
+  iso_date TEXT NOT NULL
+);
+CREATE TABLE allergen (
+  id TEXT PRIMARY KEY NOT NULL,
+  name TEXT NOT NULL
+);
+CREATE TABLE food (
+  id TEXT PRIMARY KEY NOT NULL,
+  cuisine_id TEXT NOT NULL REFERENCES cuisine(id) ON DELETE CASCADE,
+  event_id TEXT NOT NULL REFERENCES event(id) ON DELETE CASCADE,
+  name TEXT NOT NULL,
+  food_type TEXT NOT NULL CHECK (food_type IN ('entrees_and_sides', 'toppings', 'dressings')),
+  preference TEXT NULL CHECK (preference IN ('', 'vegan', 'vegetarian'))
+);
+CREATE TABLE food_allergen (
+  food_id TEXT NOT NULL REFERENCES food(id) ON DELETE CASCADE,
+  allergen_id TEXT NOT NULL REFERENCES allergen(id) ON DELETE CASCADE
+);
+
+CREATE INDEX event_iso_date_idx ON event (iso_date);
+CREATE INDEX food_event_id_idx ON food (event_id);
+CREATE INDEX food_allergen_food_id_idx ON food_allergen (food_id);
+
+
+-- +goose Down
+DROP TABLE IF EXISTS food_allergen;
+DROP TABLE IF EXISTS food;
+DROP TABLE IF EXISTS allergen;
+DROP TABLE IF EXISTS event;
+DROP TABLE IF EXISTS cuisine;
@@ -0,0 +1,37 @@
+-- +goose Up
+-- Merge allergens and cuisines that only differ by case or surrounding
+-- whitespace into the oldest row before adding the unique indexes.
+UPDATE food_allergen SET allergen_id = (
+  SELECT keep.id FROM allergen keep, allergen a
+  WHERE a.id = food_allergen.allergen_id AND LOWER(TRIM(keep.name)) = LOWER(TRIM(a.name))
+  ORDER BY keep.rowid LIMIT 1
+);
+
+DELETE FROM food_allergen WHERE rowid NOT IN (
+  SELECT MIN(rowid) FROM food_allergen GROUP BY food_id, allergen_id
+);
+
+DELETE FROM allergen WHERE rowid NOT IN (
+  SELECT MIN(rowid) FROM allergen GROUP BY LOWER(TRIM(name))
+);
+
+UPDATE food SET cuisine_id = (
+  SELECT keep.id FROM cuisine keep, cuisine c
+  WHERE c.id = food.cuisine_id AND LOWER(TRIM(keep.name)) = LOWER(TRIM(c.name))
+  ORDER BY keep.rowid LIMIT 1
+);
+
+DELETE FROM cuisine WHERE rowid NOT IN (
+  SELECT MIN(rowid) FROM cuisine GROUP BY LOWER(TRIM(name))
+);
+
+UPDATE allergen SET name = TRIM(name) WHERE name <> TRIM(name);
+UPDATE cuisine SET name = TRIM(name) WHERE name <> TRIM(name);
+
+CREATE UNIQUE INDEX allergen_name_normalized_key ON allergen (LOWER(TRIM(name)));
+CREATE UNIQUE INDEX cuisine_name_normalized_key ON cuisine (LOWER(TRIM(name)));
+
+-- +goose Down
+-- Merged rows are not split up again
+DROP INDEX IF EXISTS cuisine_name_normalized_key;
+DROP INDEX IF EXISTS allergen_name_normalized_key;
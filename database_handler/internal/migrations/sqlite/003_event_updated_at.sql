@@ -0,0 +1,8 @@
+-- +goose Up
+-- SQLite can't add a column with a non-constant default, so new events set
+-- updated_at on insert and existing ones get the time this migration ran.
+ALTER TABLE event ADD COLUMN updated_at TEXT NOT NULL DEFAULT '1970-01-01T00:00:00Z';
+UPDATE event SET updated_at = STRFTIME('%Y-%m-%dT%H:%M:%fZ', 'now');
+
+-- +goose Down
+ALTER TABLE event DROP COLUMN updated_at;
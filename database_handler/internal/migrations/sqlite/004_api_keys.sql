@@ -0,0 +1,16 @@
+-- +goose Up
+-- Only the SHA-256 of a key is stored, the prefix tells keys apart in
+-- listings. Revoked keys are kept so their usage stays auditable.
+CREATE TABLE api_key (
+  id TEXT PRIMARY KEY NOT NULL,
+  name TEXT NOT NULL,
+  prefix TEXT NOT NULL,
+  hash TEXT UNIQUE NOT NULL,
+  scope TEXT NOT NULL CHECK (scope IN ('read', 'write', 'admin')),
+  created_at TEXT NOT NULL,
+  last_used_at TEXT NULL,
+  revoked_at TEXT NULL
+);
+
+-- +goose Down
+DROP TABLE api_key;
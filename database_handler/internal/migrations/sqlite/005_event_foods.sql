@@ -0,0 +1,26 @@
+-- +goose Up
+-- The cuisine and foods of every event in the JSON shape every event read
+-- returns, events without foods have no row.
+CREATE VIEW event_foods AS
+SELECT
+    f.event_id,
+    MIN(c.name) AS cuisine,
+    JSON_GROUP_ARRAY(
+        JSON_OBJECT(
+            'name', f.name,
+            'food_type', f.food_type,
+            'preference', COALESCE(f.preference, ''),
+            'allergens', JSON((
+                SELECT JSON_GROUP_ARRAY(a.name ORDER BY a.name)
+                FROM food_allergen fa
+                JOIN allergen a ON a.id = fa.allergen_id
+                WHERE fa.food_id = f.id
+            ))
+        ) ORDER BY f.name
+    ) AS foods
+FROM food f
+JOIN cuisine c ON c.id = f.cuisine_id
+GROUP BY f.event_id;
+
+-- +goose Down
+DROP VIEW event_foods;
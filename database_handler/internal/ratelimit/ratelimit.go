@@ -0,0 +1,154 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Budget is a token bucket: Burst requests at once, refilled at Rate
+// requests a second. A budget with no rate is unlimited.
+type Budget struct {
+	// Name keeps the buckets of different budgets of a client apart
+	Name  string
+	Rate  float64
+	Burst int
+}
+
+// PerMinute returns a budget of perMinute requests a minute with bursts of
+// up to burst requests.
+func PerMinute(name string, perMinute, burst uint) Budget {
+	return Budget{Name: name, Rate: float64(perMinute) / 60, Burst: int(burst)}
+}
+
+// Enabled reports whether the budget limits anything.
+func (b Budget) Enabled() bool {
+	return b.Rate > 0 && b.Burst > 0
+}
+
+// FillTime returns how long an empty bucket takes to fill up.
+func (b Budget) FillTime() time.Duration {
+	if !b.Enabled() {
+		return 0
+	}
+	return seconds(float64(b.Burst) / b.Rate)
+}
+
+// result returns the result of a take that left tokens in the bucket.
+func (b Budget) result(tokens float64, allowed bool) Result {
+	r := Result{
+		Allowed:   allowed,
+		Limit:     b.Burst,
+		Remaining: max(int(math.Floor(tokens)), 0),
+		Reset:     seconds((float64(b.Burst) - tokens) / b.Rate),
+	}
+	if !allowed {
+		r.RetryAfter = seconds((1 - tokens) / b.Rate)
+	}
+	return r
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(max(s, 0) * float64(time.Second))
+}
+
+// Result is the outcome of taking a token.
+type Result struct {
+	Allowed bool
+	// Limit is the burst of the budget
+	Limit int
+	// Remaining is the number of requests that can be made right away
+	Remaining int
+	// Reset is how long until the bucket is full again
+	Reset time.Duration
+	// RetryAfter is how long until the next token, when not allowed
+	RetryAfter time.Duration
+}
+
+// Limiter takes a token from the bucket of key in budget.
+type Limiter interface {
+	Take(ctx context.Context, key string, budget Budget) (Result, error)
+}
+
+// sweepInterval is how often Memory drops the buckets that refilled.
+const sweepInterval = time.Minute
+
+// Memory keeps the buckets in the process, so every replica has its own
+// budget.
+type Memory struct {
+	now func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	budget  Budget
+	tokens  float64
+	updated time.Time
+}
+
+var _ Limiter = (*Memory)(nil)
+
+func NewMemory() *Memory {
+	return &Memory{
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// WithClock overrides the clock the buckets are refilled with.
+func (m *Memory) WithClock(now func() time.Time) *Memory {
+	m.now = now
+	m.lastSweep = now()
+	return m
+}
+
+func (m *Memory) Take(_ context.Context, key string, budget Budget) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.sweep(now)
+	key = budget.Name + ":" + key
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{budget: budget, tokens: float64(budget.Burst), updated: now}
+		m.buckets[key] = b
+	}
+	b.refill(now)
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	return budget.result(b.tokens, allowed), nil
+}
+
+func (b *bucket) refill(now time.Time) {
+	b.tokens = min(float64(b.budget.Burst), b.tokens+now.Sub(b.updated).Seconds()*b.budget.Rate)
+	b.updated = now
+}
+
+// sweep drops the full buckets every sweepInterval, a new bucket is full
+// anyway, so the map only holds the clients seen lately.
+func (m *Memory) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < sweepInterval {
+		return
+	}
+	m.lastSweep = now
+	for key, b := range m.buckets {
+		if b.refill(now); b.tokens >= float64(b.budget.Burst) {
+			delete(m.buckets, key)
+		}
+	}
+}
+
+// Len returns the number of buckets held.
+func (m *Memory) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.buckets)
+}
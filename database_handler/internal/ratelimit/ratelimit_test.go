@@ -0,0 +1,131 @@
+package ratelimit_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/ratelimit"
+)
+
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func take(t *testing.T, limiter ratelimit.Limiter, key string, budget ratelimit.Budget) ratelimit.Result {
+	t.Helper()
+
+	result, err := limiter.Take(context.Background(), key, budget)
+	if err != nil {
+		t.Fatalf("failed to take a token: %v", err)
+	}
+	return result
+}
+
+func TestPerMinute(t *testing.T) {
+	budget := ratelimit.PerMinute("writes", 60, 10)
+	if budget.Rate != 1 || budget.Burst != 10 || !budget.Enabled() {
+		t.Errorf("unexpected budget %+v", budget)
+	}
+	if budget.FillTime() != 10*time.Second {
+		t.Errorf("expected a fill time of 10s, got %s", budget.FillTime())
+	}
+	if ratelimit.PerMinute("writes", 0, 10).Enabled() {
+		t.Errorf("expected 0 requests a minute to disable the budget")
+	}
+}
+
+func TestMemory(t *testing.T) {
+	c := &clock{now: time.Date(2025, 8, 29, 12, 0, 0, 0, time.UTC)}
+	limiter := ratelimit.NewMemory().WithClock(c.Now)
+	writes := ratelimit.PerMinute("writes", 60, 2)
+
+	for i := range 2 {
+		result := take(t, limiter, "ip:192.0.2.1", writes)
+		if !result.Allowed || result.Limit != 2 || result.Remaining != 1-i {
+			t.Errorf("take %d: unexpected result %+v", i+1, result)
+		}
+	}
+	result := take(t, limiter, "ip:192.0.2.1", writes)
+	if result.Allowed || result.Remaining != 0 || result.RetryAfter != time.Second || result.Reset != 2*time.Second {
+		t.Errorf("expected the empty bucket to be limited for a second, got %+v", result)
+	}
+
+	// Other clients and other budgets have their own buckets
+	if !take(t, limiter, "ip:192.0.2.2", writes).Allowed {
+		t.Errorf("expected another client not to be limited")
+	}
+	if !take(t, limiter, "ip:192.0.2.1", ratelimit.PerMinute("reads", 60, 2)).Allowed {
+		t.Errorf("expected another budget not to be limited")
+	}
+
+	c.now = c.now.Add(time.Second)
+	if result := take(t, limiter, "ip:192.0.2.1", writes); !result.Allowed || result.Remaining != 0 {
+		t.Errorf("expected a token after a second, got %+v", result)
+	}
+	if take(t, limiter, "ip:192.0.2.1", writes).Allowed {
+		t.Errorf("expected a single token after a second")
+	}
+}
+
+func TestMemorySweep(t *testing.T) {
+	c := &clock{now: time.Date(2025, 8, 29, 12, 0, 0, 0, time.UTC)}
+	limiter := ratelimit.NewMemory().WithClock(c.Now)
+	writes := ratelimit.PerMinute("writes", 60, 2)
+	slow := ratelimit.PerMinute("slow", 1, 2)
+
+	take(t, limiter, "ip:192.0.2.1", writes)
+	take(t, limiter, "ip:192.0.2.2", slow)
+	take(t, limiter, "ip:192.0.2.2", slow)
+	c.now = c.now.Add(time.Minute)
+	take(t, limiter, "ip:192.0.2.3", writes)
+	// The full writes bucket is dropped, the slow one is still refilling
+	if limiter.Len() != 2 {
+		t.Errorf("expected 2 buckets after the sweep, got %d", limiter.Len())
+	}
+}
+
+type store struct {
+	key     string
+	tokens  float64
+	allowed bool
+	err     error
+}
+
+func (s *store) TakeRateLimitToken(_ context.Context, key string, _ float64, _ int) (float64, bool, error) {
+	s.key = key
+	return s.tokens, s.allowed, s.err
+}
+
+func (s *store) DeleteIdleRateLimitBuckets(context.Context, time.Time) (int64, error) {
+	return 0, nil
+}
+
+func TestShared(t *testing.T) {
+	st := &store{tokens: 4.5, allowed: true}
+	limiter := ratelimit.NewShared(st)
+	reads := ratelimit.PerMinute("reads", 600, 10)
+
+	result := take(t, limiter, "api_key:pdf_handler", reads)
+	if st.key != "reads:api_key:pdf_handler" {
+		t.Errorf("expected the bucket key to include the budget, got %q", st.key)
+	}
+	if !result.Allowed || result.Limit != 10 || result.Remaining != 4 || result.Reset != 550*time.Millisecond {
+		t.Errorf("unexpected result %+v", result)
+	}
+
+	st.tokens, st.allowed = 0.5, false
+	if result := take(t, limiter, "api_key:pdf_handler", reads); result.Allowed || result.Remaining != 0 || result.RetryAfter != 50*time.Millisecond {
+		t.Errorf("expected to be limited, got %+v", result)
+	}
+
+	st.err = errors.New("connection refused")
+	if _, err := limiter.Take(context.Background(), "api_key:pdf_handler", reads); err == nil {
+		t.Errorf("expected the store error")
+	}
+}
@@ -0,0 +1,56 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Store holds the buckets shared by the replicas, such as *storage.Storage
+// with Postgres.
+type Store interface {
+	TakeRateLimitToken(ctx context.Context, key string, rate float64, burst int) (float64, bool, error)
+	DeleteIdleRateLimitBuckets(ctx context.Context, before time.Time) (int64, error)
+}
+
+// Shared keeps the buckets in a Store, so the budget of a client holds
+// across replicas. Every request costs a round trip to the database.
+type Shared struct {
+	store Store
+}
+
+var _ Limiter = (*Shared)(nil)
+
+func NewShared(store Store) *Shared {
+	return &Shared{store: store}
+}
+
+func (s *Shared) Take(ctx context.Context, key string, budget Budget) (Result, error) {
+	tokens, allowed, err := s.store.TakeRateLimitToken(ctx, budget.Name+":"+key, budget.Rate, budget.Burst)
+	if err != nil {
+		return Result{}, err
+	}
+	return budget.result(tokens, allowed), nil
+}
+
+// Sweep deletes the buckets unused for idle every interval until ctx is
+// done. idle must be longer than the fill time of every budget, so the
+// deleted buckets were full anyway.
+func (s *Shared) Sweep(ctx context.Context, interval, idle time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := s.store.DeleteIdleRateLimitBuckets(ctx, time.Now().Add(-idle))
+			if err != nil {
+				log.WithError(err).Warn("failed to delete idle rate limit buckets")
+				continue
+			}
+			log.WithFields(log.Fields{"deleted": deleted}).Debug("deleted idle rate limit buckets")
+		}
+	}
+}
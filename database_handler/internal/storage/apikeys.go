@@ -0,0 +1,229 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/internal_types"
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/storage/postgres"
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/storage/sqlite"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+func (s *Storage) CreateAPIKey(ctx context.Context, name, scope, prefix, hash string) (internal_types.APIKey, error) {
+	return retry(ctx, s, "create api key", func(ctx context.Context) (internal_types.APIKey, error) {
+		switch s.dbType {
+		case DBTypePostgres:
+			queryExecutor, err := s.getPostgresQueryExecutor()
+			if err != nil {
+				return internal_types.APIKey{}, err
+			}
+			row, err := queryExecutor.InsertAPIKey(ctx, postgres.InsertAPIKeyParams{
+				Name:   name,
+				Prefix: prefix,
+				Hash:   hash,
+				Scope:  scope,
+			})
+			if err != nil {
+				return internal_types.APIKey{}, fmt.Errorf("failed to insert api key: %w", err)
+			}
+			return apiKeyFromPostgres(row), nil
+		case DBTypeSQLite:
+			queryExecutor, err := s.getSQLiteQueryExecutor()
+			if err != nil {
+				return internal_types.APIKey{}, err
+			}
+			row, err := queryExecutor.InsertAPIKey(ctx, sqlite.InsertAPIKeyParams{
+				ID:     uuid.New(),
+				Name:   name,
+				Prefix: prefix,
+				Hash:   hash,
+				Scope:  scope,
+			})
+			if err != nil {
+				return internal_types.APIKey{}, fmt.Errorf("failed to insert api key: %w", err)
+			}
+			return apiKeyFromSQLite(row)
+		default:
+			return internal_types.APIKey{}, fmt.Errorf("database type %s not supported", s.dbType)
+		}
+	})
+}
+
+// AuthenticateAPIKey returns the active key with the hash. It reads from the
+// primary, so a revoked key is rejected right away. Failing to record its use
+// is only logged, it doesn't fail the request.
+func (s *Storage) AuthenticateAPIKey(ctx context.Context, hash string) (internal_types.APIKey, error) {
+	return retry(ctx, s, "authenticate api key", func(ctx context.Context) (internal_types.APIKey, error) {
+		var key internal_types.APIKey
+		var touch func(ctx context.Context, id uuid.UUID) error
+		switch s.dbType {
+		case DBTypePostgres:
+			queryExecutor, err := s.getPostgresQueryExecutor()
+			if err != nil {
+				return internal_types.APIKey{}, err
+			}
+			row, err := queryExecutor.GetActiveAPIKeyByHash(ctx, hash)
+			if errors.Is(err, sql.ErrNoRows) {
+				return internal_types.APIKey{}, ErrNotFound
+			}
+			if err != nil {
+				return internal_types.APIKey{}, fmt.Errorf("failed to get api key by hash: %w", err)
+			}
+			key, touch = apiKeyFromPostgres(row), queryExecutor.TouchAPIKey
+		case DBTypeSQLite:
+			queryExecutor, err := s.getSQLiteQueryExecutor()
+			if err != nil {
+				return internal_types.APIKey{}, err
+			}
+			row, err := queryExecutor.GetActiveAPIKeyByHash(ctx, hash)
+			if errors.Is(err, sql.ErrNoRows) {
+				return internal_types.APIKey{}, ErrNotFound
+			}
+			if err != nil {
+				return internal_types.APIKey{}, fmt.Errorf("failed to get api key by hash: %w", err)
+			}
+			if key, err = apiKeyFromSQLite(row); err != nil {
+				return internal_types.APIKey{}, err
+			}
+			touch = queryExecutor.TouchAPIKey
+		default:
+			return internal_types.APIKey{}, fmt.Errorf("database type %s not supported", s.dbType)
+		}
+
+		if err := touch(ctx, key.ID); err != nil {
+			log.WithContext(ctx).WithError(err).WithFields(log.Fields{"api_key_id": key.ID}).Warn("failed to record api key use")
+		}
+		return key, nil
+	})
+}
+
+func (s *Storage) ListAPIKeys(ctx context.Context) ([]internal_types.APIKey, error) {
+	return retry(ctx, s, "list api keys", func(ctx context.Context) ([]internal_types.APIKey, error) {
+		switch s.dbType {
+		case DBTypePostgres:
+			queryExecutor, err := s.getPostgresQueryExecutor()
+			if err != nil {
+				return nil, err
+			}
+			rows, err := queryExecutor.ListAPIKeys(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list api keys: %w", err)
+			}
+			keys := make([]internal_types.APIKey, 0, len(rows))
+			for _, row := range rows {
+				keys = append(keys, apiKeyFromPostgres(row))
+			}
+			return keys, nil
+		case DBTypeSQLite:
+			queryExecutor, err := s.getSQLiteQueryExecutor()
+			if err != nil {
+				return nil, err
+			}
+			rows, err := queryExecutor.ListAPIKeys(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list api keys: %w", err)
+			}
+			keys := make([]internal_types.APIKey, 0, len(rows))
+			for _, row := range rows {
+				key, err := apiKeyFromSQLite(row)
+				if err != nil {
+					return nil, err
+				}
+				keys = append(keys, key)
+			}
+			return keys, nil
+		default:
+			return nil, fmt.Errorf("database type %s not supported", s.dbType)
+		}
+	})
+}
+
+func (s *Storage) RevokeAPIKey(ctx context.Context, id uuid.UUID) error {
+	_, err := retry(ctx, s, "revoke api key", func(ctx context.Context) (int64, error) {
+		var revoke func(ctx context.Context, id uuid.UUID) (int64, error)
+		switch s.dbType {
+		case DBTypePostgres:
+			queryExecutor, err := s.getPostgresQueryExecutor()
+			if err != nil {
+				return 0, err
+			}
+			revoke = queryExecutor.RevokeAPIKey
+		case DBTypeSQLite:
+			queryExecutor, err := s.getSQLiteQueryExecutor()
+			if err != nil {
+				return 0, err
+			}
+			revoke = queryExecutor.RevokeAPIKey
+		default:
+			return 0, fmt.Errorf("database type %s not supported", s.dbType)
+		}
+
+		revoked, err := revoke(ctx, id)
+		if err != nil {
+			return 0, fmt.Errorf("failed to revoke api key: %w", err)
+		}
+		if revoked == 0 {
+			return 0, ErrNotFound
+		}
+		return revoked, nil
+	})
+	return err
+}
+
+// getPostgresQueryExecutor returns the queries on the primary.
+func (s *Storage) getPostgresQueryExecutor() (*postgres.Queries, error) {
+	dbConnection, err := s.GetDBConnection()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get db connection: %w", err)
+	}
+	return s.GetQueryExecutor(dbConnection)
+}
+
+func apiKeyFromPostgres(row postgres.DogdishApiKey) internal_types.APIKey {
+	key := internal_types.APIKey{
+		ID:        row.ID,
+		Name:      row.Name,
+		Prefix:    row.Prefix,
+		Scope:     row.Scope,
+		CreatedAt: row.CreatedAt,
+	}
+	if row.LastUsedAt.Valid {
+		key.LastUsedAt = &row.LastUsedAt.Time
+	}
+	if row.RevokedAt.Valid {
+		key.RevokedAt = &row.RevokedAt.Time
+	}
+	return key
+}
+
+func apiKeyFromSQLite(row sqlite.ApiKey) (internal_types.APIKey, error) {
+	key := internal_types.APIKey{
+		ID:     row.ID,
+		Name:   row.Name,
+		Prefix: row.Prefix,
+		Scope:  row.Scope,
+	}
+	var err error
+	if key.CreatedAt, err = time.Parse(time.RFC3339Nano, row.CreatedAt); err != nil {
+		return internal_types.APIKey{}, fmt.Errorf("failed to parse api key created_at: %w", err)
+	}
+	for _, column := range []struct {
+		value sql.NullString
+		into  **time.Time
+	}{{row.LastUsedAt, &key.LastUsedAt}, {row.RevokedAt, &key.RevokedAt}} {
+		if !column.value.Valid {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339Nano, column.value.String)
+		if err != nil {
+			return internal_types.APIKey{}, fmt.Errorf("failed to parse api key time: %w", err)
+		}
+		*column.into = &parsed
+	}
+	return key, nil
+}
@@ -0,0 +1,91 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/storage"
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/storage/memory"
+	"github.com/google/uuid"
+)
+
+func TestMemoryAPIKeys(t *testing.T) {
+	runAPIKeyTests(t, memory.NewStorage())
+}
+
+func TestSQLiteAPIKeys(t *testing.T) {
+	runAPIKeyTests(t, openSQLite(t).(*storage.Storage))
+}
+
+func TestPostgresAPIKeys(t *testing.T) {
+	host := os.Getenv("DH_TEST_DB_HOST")
+	if host == "" {
+		t.Skip("DH_TEST_DB_HOST not set")
+	}
+
+	runAPIKeyTests(t, openPostgres(t, host))
+}
+
+func runAPIKeyTests(t *testing.T, keys storage.APIKeyStore) {
+	ctx := context.Background()
+	hash := uuid.NewString()
+
+	created, err := keys.CreateAPIKey(ctx, "pdf_handler", "write", "dgd_abcdefgh", hash)
+	if err != nil {
+		t.Fatalf("failed to create api key: %v", err)
+	}
+	if created.ID == uuid.Nil || created.Name != "pdf_handler" || created.Scope != "write" || created.CreatedAt.IsZero() {
+		t.Errorf("unexpected api key %+v", created)
+	}
+	if created.LastUsedAt != nil || created.RevokedAt != nil {
+		t.Errorf("expected a new api key to be unused and active, got %+v", created)
+	}
+
+	if _, err := keys.CreateAPIKey(ctx, "duplicate", "read", "dgd_abcdefgh", hash); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("expected ErrConflict for a duplicate hash, got %v", err)
+	}
+
+	authenticated, err := keys.AuthenticateAPIKey(ctx, hash)
+	if err != nil {
+		t.Fatalf("failed to authenticate api key: %v", err)
+	}
+	if authenticated.ID != created.ID {
+		t.Errorf("expected api key %s, got %s", created.ID, authenticated.ID)
+	}
+	if _, err := keys.AuthenticateAPIKey(ctx, uuid.NewString()); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for an unknown hash, got %v", err)
+	}
+
+	listed, err := keys.ListAPIKeys(ctx)
+	if err != nil {
+		t.Fatalf("failed to list api keys: %v", err)
+	}
+	found := false
+	for _, key := range listed {
+		if key.ID == created.ID {
+			found = true
+			if key.LastUsedAt == nil {
+				t.Errorf("expected authenticating to record the last use")
+			}
+		}
+	}
+	if !found {
+		t.Errorf("expected api key %s in %+v", created.ID, listed)
+	}
+
+	if err := keys.RevokeAPIKey(ctx, created.ID); err != nil {
+		t.Fatalf("failed to revoke api key: %v", err)
+	}
+	if _, err := keys.AuthenticateAPIKey(ctx, hash); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for a revoked key, got %v", err)
+	}
+	// Revoking again keeps the first revocation
+	if err := keys.RevokeAPIKey(ctx, created.ID); err != nil {
+		t.Errorf("failed to revoke api key again: %v", err)
+	}
+	if err := keys.RevokeAPIKey(ctx, uuid.New()); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected ErrNotFound revoking an unknown key, got %v", err)
+	}
+}
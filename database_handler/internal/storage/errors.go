@@ -0,0 +1,193 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	sqlite3 "modernc.org/sqlite"
+)
+
+// Error kinds returned by Storage. Callers match them with errors.Is, the
+// driver error stays reachable with errors.As.
+var (
+	// ErrNotFound is returned when the requested record does not exist.
+	ErrNotFound = errors.New("not found")
+
+	// ErrConflict is returned when a write violates a unique constraint.
+	ErrConflict = errors.New("conflict")
+
+	// ErrTransient is returned for failures that may succeed when retried,
+	// such as dropped connections, serialization failures and deadlocks.
+	ErrTransient = errors.New("transient database error")
+
+	// ErrValidation is returned when the database rejects the data itself,
+	// for example a malformed date or a violated check constraint.
+	ErrValidation = errors.New("invalid data")
+)
+
+const (
+	// Default retry options for transient errors
+	DefaultMaxRetries   int           = 3
+	DefaultRetryBackoff time.Duration = 50 * time.Millisecond
+
+	maxRetryBackoff time.Duration = 2 * time.Second
+)
+
+// Error is a storage failure classified into one of the error kinds.
+type Error struct {
+	Kind error
+	Op   string
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s: %v", e.Op, e.Kind, e.Err)
+}
+
+func (e *Error) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+// commitError is a failed COMMIT. The connection may have been lost after
+// the server committed, so the transaction is never retried.
+type commitError struct {
+	err error
+}
+
+func (e *commitError) Error() string {
+	return fmt.Sprintf("failed to commit transaction: %v", e.err)
+}
+
+func (e *commitError) Unwrap() error {
+	return e.err
+}
+
+// classify wraps err in an *Error when its kind can be determined. Errors
+// that already carry a kind and unknown errors are returned as is.
+func classify(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	for _, kind := range []error{ErrNotFound, ErrConflict, ErrTransient, ErrValidation} {
+		if errors.Is(err, kind) {
+			return err
+		}
+	}
+	if kind := errorKind(err); kind != nil {
+		return &Error{Kind: kind, Op: op, Err: err}
+	}
+	return err
+}
+
+func errorKind(err error) error {
+	// A cancelled request is not a database failure and must not be retried
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return nil
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch {
+		case pqErr.Code == "23505":
+			// unique_violation
+			return ErrConflict
+		case pqErr.Code.Class() == "22", pqErr.Code.Class() == "23":
+			// data_exception and the remaining integrity_constraint_violation
+			return ErrValidation
+		case pqErr.Code == "40001", pqErr.Code == "40P01":
+			// serialization_failure and deadlock_detected
+			return ErrTransient
+		case pqErr.Code.Class() == "08", pqErr.Code.Class() == "57", pqErr.Code == "53300":
+			// connection_exception, operator_intervention (shutdowns and
+			// failovers) and too_many_connections
+			return ErrTransient
+		}
+		return nil
+	}
+
+	var sqliteErr *sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		code := sqliteErr.Code()
+		switch code & 0xff {
+		case 5, 6:
+			// SQLITE_BUSY and SQLITE_LOCKED
+			return ErrTransient
+		case 19:
+			// SQLITE_CONSTRAINT, extended with UNIQUE and PRIMARYKEY
+			if code == 2067 || code == 1555 {
+				return ErrConflict
+			}
+			return ErrValidation
+		}
+		return nil
+	}
+
+	var netErr net.Error
+	if errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.As(err, &netErr) {
+		return ErrTransient
+	}
+
+	return nil
+}
+
+// retry calls fn until it succeeds, returns an error that is not transient or
+// a failed commit, or the retries run out. The wait between attempts doubles
+// from the storage's retry backoff and is jittered so concurrent callers do
+// not retry in step.
+// Every attempt runs in the span of the call, which fn receives in its ctx.
+func retry[T any](ctx context.Context, s *Storage, op string, fn func(ctx context.Context) (T, error)) (result T, err error) {
+	ctx, span := s.startCall(ctx, op)
+	defer func() {
+		// A missing record is an answer, not a failed call
+		if errors.Is(err, ErrNotFound) {
+			span.End()
+			return
+		}
+		endSpan(span, err)
+	}()
+
+	backoff := max(s.retryBackoff, 0)
+	for attempt := 0; ; attempt++ {
+		result, err = fn(ctx)
+		var commit *commitError
+		failedCommit := errors.As(err, &commit)
+		err = classify(op, err)
+		if err == nil || !errors.Is(err, ErrTransient) || failedCommit || attempt >= s.maxRetries {
+			return result, err
+		}
+		span.AddEvent("retry", trace.WithAttributes(attribute.Int("attempt", attempt+1)))
+
+		wait := backoff/2 + rand.N(backoff/2+1)
+		log.WithContext(ctx).WithError(err).WithFields(log.Fields{"op": op, "attempt": attempt + 1, "wait": wait}).Warn("transient database error, retrying")
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return result, err
+		case <-timer.C:
+		}
+		backoff = min(backoff*2, maxRetryBackoff)
+	}
+}
@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		kind error
+	}{
+		{name: "no rows", err: sql.ErrNoRows, kind: ErrNotFound},
+		{name: "unique violation", err: &pq.Error{Code: "23505"}, kind: ErrConflict},
+		{name: "foreign key violation", err: &pq.Error{Code: "23503"}, kind: ErrValidation},
+		{name: "invalid date", err: &pq.Error{Code: "22007"}, kind: ErrValidation},
+		{name: "serialization failure", err: &pq.Error{Code: "40001"}, kind: ErrTransient},
+		{name: "deadlock", err: &pq.Error{Code: "40P01"}, kind: ErrTransient},
+		{name: "admin shutdown", err: &pq.Error{Code: "57P01"}, kind: ErrTransient},
+		{name: "connection failure", err: &pq.Error{Code: "08006"}, kind: ErrTransient},
+		{name: "bad connection", err: driver.ErrBadConn, kind: ErrTransient},
+		{name: "connection reset", err: fmt.Errorf("failed to insert event: %w", syscall.ECONNRESET), kind: ErrTransient},
+		{name: "dial error", err: &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, kind: ErrTransient},
+		{name: "syntax error", err: &pq.Error{Code: "42601"}},
+		{name: "cancelled", err: context.Canceled},
+		{name: "unknown", err: errors.New("boom")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := classify("test", tt.err)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("expected the driver error to stay in the chain, got %v", err)
+			}
+			for _, kind := range []error{ErrNotFound, ErrConflict, ErrTransient, ErrValidation} {
+				if errors.Is(err, kind) != (kind == tt.kind) {
+					t.Errorf("expected kind %v, got %v", tt.kind, err)
+				}
+			}
+		})
+	}
+}
+
+func TestClassifySQLite(t *testing.T) {
+	s := NewStorage().
+		WithDBType(DBTypeSQLite).
+		WithDatabase(filepath.Join(t.TempDir(), "dogdish.db"))
+	if err := s.Open(); err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+	defer s.Close()
+	db, _ := s.GetDBConnection()
+
+	if _, err := db.Exec(`CREATE TABLE item (id TEXT PRIMARY KEY, name TEXT NOT NULL CHECK (name <> ''))`); err != nil {
+		t.Fatalf("failed to create table: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO item (id, name) VALUES ('1', 'first')`); err != nil {
+		t.Fatalf("failed to insert row: %v", err)
+	}
+
+	_, err := db.Exec(`INSERT INTO item (id, name) VALUES ('1', 'again')`)
+	if err := classify("insert", err); !errors.Is(err, ErrConflict) {
+		t.Errorf("expected a duplicate primary key to be a conflict, got %v", err)
+	}
+	_, err = db.Exec(`INSERT INTO item (id, name) VALUES ('2', '')`)
+	if err := classify("insert", err); !errors.Is(err, ErrValidation) {
+		t.Errorf("expected a check constraint failure to be a validation error, got %v", err)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	transient := &pq.Error{Code: "40001"}
+
+	tests := []struct {
+		name          string
+		failures      int
+		err           error
+		expectedCalls int
+		expectedErr   error
+	}{
+		{name: "succeeds after transient errors", failures: 2, err: transient, expectedCalls: 3},
+		{name: "gives up after max retries", failures: 10, err: transient, expectedCalls: 4, expectedErr: ErrTransient},
+		{name: "does not retry conflicts", failures: 10, err: &pq.Error{Code: "23505"}, expectedCalls: 1, expectedErr: ErrConflict},
+		{name: "does not retry a failed commit", failures: 10, err: &commitError{err: driver.ErrBadConn}, expectedCalls: 1, expectedErr: ErrTransient},
+		{name: "does not retry unknown errors", failures: 10, err: errors.New("boom"), expectedCalls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewStorage().WithMaxRetries(3).WithRetryBackoff(time.Millisecond)
+
+			calls := 0
+			result, err := retry(context.Background(), s, "test", func(context.Context) (int, error) {
+				calls++
+				if calls <= tt.failures {
+					return 0, tt.err
+				}
+				return 42, nil
+			})
+
+			if calls != tt.expectedCalls {
+				t.Errorf("expected %d calls, got %d", tt.expectedCalls, calls)
+			}
+			if tt.failures < tt.expectedCalls {
+				if err != nil || result != 42 {
+					t.Errorf("expected 42 and no error, got %d and %v", result, err)
+				}
+				return
+			}
+			if err == nil || (tt.expectedErr != nil && !errors.Is(err, tt.expectedErr)) {
+				t.Errorf("expected %v, got %v", tt.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestRetryStopsWhenContextIsDone(t *testing.T) {
+	s := NewStorage().WithMaxRetries(10).WithRetryBackoff(time.Hour)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	calls := 0
+	_, err := retry(ctx, s, "test", func(context.Context) (int, error) {
+		calls++
+		cancel()
+		return 0, driver.ErrBadConn
+	})
+
+	if calls != 1 {
+		t.Errorf("expected 1 call, got %d", calls)
+	}
+	if !errors.Is(err, ErrTransient) {
+		t.Errorf("expected the transient error to be returned, got %v", err)
+	}
+}
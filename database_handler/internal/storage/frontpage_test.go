@@ -0,0 +1,108 @@
+package storage_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/internal_types"
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/storage/postgres"
+)
+
+// benchmarkEvents is how many events are seeded, half of them in the past.
+const benchmarkEvents = 40
+
+func benchmarkFood(name string, allergens ...string) internal_types.EntreesAndSidesOrSaladBar {
+	return internal_types.EntreesAndSidesOrSaladBar{Name: name, Allergens: allergens, Preference: "vegetarian"}
+}
+
+// BenchmarkFrontPage compares the per-event lookups the front page used to
+// make, the previous, current and future events followed by the foods and
+// cuisine of each, with the single GetFrontPageEvents query. Both run on the
+// same pool, so the difference is the round trips. It needs an empty,
+// migrated Postgres database, see storage_test.go.
+//
+//	DH_TEST_DB_HOST=localhost go test ./internal/storage -run '^$' -bench FrontPage -benchmem
+func BenchmarkFrontPage(b *testing.B) {
+	host := os.Getenv("DH_TEST_DB_HOST")
+	if host == "" {
+		b.Skip("DH_TEST_DB_HOST not set")
+	}
+	s := openPostgres(b, host)
+	ctx := context.Background()
+
+	// Events around today, every one with entrees, sides, toppings and
+	// dressings carrying a few allergens each
+	today := time.Now()
+	for day := range benchmarkEvents {
+		date := today.AddDate(0, 0, day-benchmarkEvents/2)
+		event := internal_types.Event{
+			Weekday: date.Weekday().String(),
+			ISODate: date.Format(time.DateOnly),
+			Cuisine: fmt.Sprintf("Cuisine %d", day%5),
+		}
+		for i := range 8 {
+			event.EntreesAndSides = append(event.EntreesAndSides, benchmarkFood(fmt.Sprintf("Dish %d-%d", day, i), "gluten", "dairy", fmt.Sprintf("allergen %d", i)))
+		}
+		for i := range 4 {
+			event.SaladBar.Toppings = append(event.SaladBar.Toppings, benchmarkFood(fmt.Sprintf("Topping %d-%d", day, i), "nuts"))
+		}
+		for i := range 2 {
+			event.SaladBar.Dressings = append(event.SaladBar.Dressings, benchmarkFood(fmt.Sprintf("Dressing %d-%d", day, i), "eggs", "mustard"))
+		}
+		if _, err := s.StoreEvent(ctx, event); err != nil {
+			b.Fatalf("failed to store event: %v", err)
+		}
+	}
+	db, err := s.GetDBConnection()
+	if err != nil {
+		b.Fatalf("failed to get the pool: %v", err)
+	}
+	queries := postgres.New(db)
+
+	b.Run("per-event", func(b *testing.B) {
+		for range b.N {
+			var ids []postgres.GetFutureEventsRow
+			if previous, err := queries.GetPreviousEvent(ctx); err == nil {
+				ids = append(ids, postgres.GetFutureEventsRow(previous))
+			}
+			if current, err := queries.GetCurrentEvent(ctx); err == nil {
+				ids = append(ids, postgres.GetFutureEventsRow(current))
+			}
+			needed := int32(1)
+			if len(ids) > 0 {
+				needed = 2
+			}
+			future, err := queries.GetFutureEvents(ctx, needed)
+			if err != nil {
+				b.Fatalf("failed to get future events: %v", err)
+			}
+			for _, event := range append(ids, future...) {
+				foods, err := queries.GetFoodsByEventId(ctx, event.ID)
+				if err != nil {
+					b.Fatalf("failed to get foods: %v", err)
+				}
+				if len(foods) == 0 {
+					continue
+				}
+				if _, err := queries.GetCuisineById(ctx, foods[0].CuisineID); err != nil {
+					b.Fatalf("failed to get cuisine: %v", err)
+				}
+			}
+		}
+	})
+
+	b.Run("single-query", func(b *testing.B) {
+		for range b.N {
+			events, err := s.GetFrontPageEvents(ctx)
+			if err != nil {
+				b.Fatalf("failed to get front page events: %v", err)
+			}
+			if len(events) == 0 {
+				b.Fatalf("expected front page events")
+			}
+		}
+	})
+}
@@ -0,0 +1,283 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/internal_types"
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/storage"
+	"github.com/google/uuid"
+)
+
+// Storage is an in-memory implementation of storage.Repository. It mirrors the
+// ordering and front page rules of the Postgres implementation and is meant for
+// tests and local development.
+type Storage struct {
+	mu     sync.RWMutex
+	events map[uuid.UUID]internal_types.StoredEvent
+	now    func() time.Time
+
+	// Allergen and cuisine names keyed by their normalized form, so names
+	// that only differ by case or whitespace are stored once like in the
+	// database.
+	allergens map[string]string
+	cuisines  map[string]string
+
+	// API keys in creation order, along with their hash
+	apiKeys []apiKey
+}
+
+type apiKey struct {
+	internal_types.APIKey
+	hash string
+}
+
+var (
+	_ storage.Repository  = (*Storage)(nil)
+	_ storage.APIKeyStore = (*Storage)(nil)
+)
+
+func NewStorage() *Storage {
+	return &Storage{
+		events:    make(map[uuid.UUID]internal_types.StoredEvent),
+		now:       time.Now,
+		allergens: make(map[string]string),
+		cuisines:  make(map[string]string),
+	}
+}
+
+// WithClock overrides the clock used to decide which events are on the front
+// page.
+func (s *Storage) WithClock(now func() time.Time) *Storage {
+	s.now = now
+	return s
+}
+
+func (s *Storage) StoreEvent(_ context.Context, event internal_types.Event) (uuid.UUID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	event = normalizeEvent(event)
+	event.Cuisine = canonicalName(s.cuisines, event.Cuisine)
+	for _, foods := range [][]internal_types.EntreesAndSidesOrSaladBar{event.EntreesAndSides, event.SaladBar.Toppings, event.SaladBar.Dressings} {
+		for _, food := range foods {
+			for ix, allergen := range food.Allergens {
+				food.Allergens[ix] = canonicalName(s.allergens, allergen)
+			}
+			slices.Sort(food.Allergens)
+		}
+	}
+
+	id := uuid.New()
+	s.events[id] = internal_types.StoredEvent{
+		ID:        id,
+		Event:     event,
+		UpdatedAt: s.now(),
+	}
+	return id, nil
+}
+
+func (s *Storage) GetEvent(_ context.Context, eventID uuid.UUID) (internal_types.StoredEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	event, ok := s.events[eventID]
+	if !ok {
+		return internal_types.StoredEvent{}, storage.ErrNotFound
+	}
+	return copyEvent(event), nil
+}
+
+func (s *Storage) ListEvents(_ context.Context) ([]internal_types.StoredEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.sortedEvents(func(internal_types.StoredEvent) bool { return true }), nil
+}
+
+func (s *Storage) GetEventsByDate(_ context.Context, isoDate string) ([]internal_types.StoredEvent, error) {
+	if _, err := time.Parse(time.DateOnly, isoDate); err != nil {
+		return nil, &storage.Error{Kind: storage.ErrValidation, Op: "get events by date", Err: err}
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.sortedEvents(func(e internal_types.StoredEvent) bool { return e.ISODate == isoDate }), nil
+}
+
+func (s *Storage) GetFrontPageEvents(_ context.Context) ([]internal_types.StoredEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	today := s.now().Format(time.DateOnly)
+	previous := s.sortedEvents(func(e internal_types.StoredEvent) bool { return e.ISODate < today })
+	current := s.sortedEvents(func(e internal_types.StoredEvent) bool { return e.ISODate == today })
+	future := s.sortedEvents(func(e internal_types.StoredEvent) bool { return e.ISODate > today })
+
+	events := make([]internal_types.StoredEvent, 0)
+	if len(previous) != 0 {
+		events = append(events, previous[len(previous)-1])
+	}
+	if len(current) != 0 {
+		events = append(events, current[0])
+	}
+
+	futureEventsNeeded := 1
+	if len(events) != 0 {
+		futureEventsNeeded = 2
+	}
+	events = append(events, future[:min(futureEventsNeeded, len(future))]...)
+
+	// Events without any food are not shown on the front page
+	return slices.DeleteFunc(events, func(e internal_types.StoredEvent) bool {
+		return len(e.EntreesAndSides) == 0 && len(e.SaladBar.Toppings) == 0 && len(e.SaladBar.Dressings) == 0
+	}), nil
+}
+
+// canonicalName returns the first stored spelling of name, recording name as
+// the canonical spelling when it is new.
+func canonicalName(names map[string]string, name string) string {
+	name = strings.TrimSpace(name)
+	key := strings.ToLower(name)
+	if canonical, ok := names[key]; ok {
+		return canonical
+	}
+	names[key] = name
+	return name
+}
+
+// sortedEvents returns copies of the events matching keep, ordered by date.
+func (s *Storage) sortedEvents(keep func(internal_types.StoredEvent) bool) []internal_types.StoredEvent {
+	events := make([]internal_types.StoredEvent, 0, len(s.events))
+	for _, event := range s.events {
+		if keep(event) {
+			events = append(events, copyEvent(event))
+		}
+	}
+	slices.SortStableFunc(events, func(a, b internal_types.StoredEvent) int {
+		return strings.Compare(a.ISODate, b.ISODate)
+	})
+	return events
+}
+
+// normalizeEvent copies the event, replacing nil slices with empty ones and
+// sorting foods and allergens by name like the database does.
+func normalizeEvent(event internal_types.Event) internal_types.Event {
+	normalizeFoods := func(foods []internal_types.EntreesAndSidesOrSaladBar) []internal_types.EntreesAndSidesOrSaladBar {
+		normalized := make([]internal_types.EntreesAndSidesOrSaladBar, 0, len(foods))
+		for _, food := range foods {
+			allergens := append([]string{}, food.Allergens...)
+			slices.Sort(allergens)
+			normalized = append(normalized, internal_types.EntreesAndSidesOrSaladBar{
+				Name:       food.Name,
+				Allergens:  allergens,
+				Preference: food.Preference,
+			})
+		}
+		slices.SortStableFunc(normalized, func(a, b internal_types.EntreesAndSidesOrSaladBar) int {
+			return strings.Compare(a.Name, b.Name)
+		})
+		return normalized
+	}
+
+	return internal_types.Event{
+		Weekday:         event.Weekday,
+		ISODate:         event.ISODate,
+		Cuisine:         event.Cuisine,
+		EntreesAndSides: normalizeFoods(event.EntreesAndSides),
+		SaladBar: internal_types.SaladBar{
+			Toppings:  normalizeFoods(event.SaladBar.Toppings),
+			Dressings: normalizeFoods(event.SaladBar.Dressings),
+		},
+	}
+}
+
+func copyEvent(event internal_types.StoredEvent) internal_types.StoredEvent {
+	return internal_types.StoredEvent{
+		ID:        event.ID,
+		Event:     normalizeEvent(event.Event),
+		UpdatedAt: event.UpdatedAt,
+	}
+}
+
+func (s *Storage) CreateAPIKey(_ context.Context, name, scope, prefix, hash string) (internal_types.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The database checks the same
+	if !slices.Contains([]string{"read", "write", "admin"}, scope) {
+		return internal_types.APIKey{}, storage.ErrValidation
+	}
+	for _, key := range s.apiKeys {
+		if key.hash == hash {
+			return internal_types.APIKey{}, storage.ErrConflict
+		}
+	}
+
+	key := internal_types.APIKey{
+		ID:        uuid.New(),
+		Name:      name,
+		Prefix:    prefix,
+		Scope:     scope,
+		CreatedAt: s.now(),
+	}
+	s.apiKeys = append(s.apiKeys, apiKey{APIKey: key, hash: hash})
+	return key, nil
+}
+
+func (s *Storage) AuthenticateAPIKey(_ context.Context, hash string) (internal_types.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for ix, key := range s.apiKeys {
+		if key.hash != hash || key.RevokedAt != nil {
+			continue
+		}
+		now := s.now()
+		s.apiKeys[ix].LastUsedAt = &now
+		return copyAPIKey(s.apiKeys[ix].APIKey), nil
+	}
+	return internal_types.APIKey{}, storage.ErrNotFound
+}
+
+func (s *Storage) ListAPIKeys(_ context.Context) ([]internal_types.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([]internal_types.APIKey, 0, len(s.apiKeys))
+	for _, key := range s.apiKeys {
+		keys = append(keys, copyAPIKey(key.APIKey))
+	}
+	return keys, nil
+}
+
+func (s *Storage) RevokeAPIKey(_ context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for ix, key := range s.apiKeys {
+		if key.ID != id {
+			continue
+		}
+		if key.RevokedAt == nil {
+			now := s.now()
+			s.apiKeys[ix].RevokedAt = &now
+		}
+		return nil
+	}
+	return storage.ErrNotFound
+}
+
+func copyAPIKey(key internal_types.APIKey) internal_types.APIKey {
+	for _, t := range []**time.Time{&key.LastUsedAt, &key.RevokedAt} {
+		if *t != nil {
+			copied := **t
+			*t = &copied
+		}
+	}
+	return key
+}
@@ -0,0 +1,24 @@
+package storage
+
+import (
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/internal_types"
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/metrics"
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/storage/postgres"
+)
+
+// WithMetrics records the stored events, foods and new allergens.
+func (s *Storage) WithMetrics(m *metrics.Metrics) *Storage {
+	s.metrics = m
+	return s
+}
+
+// recordEventStored is called once the event is committed, so retried and
+// rolled back transactions are not counted.
+func (s *Storage) recordEventStored(event internal_types.Event, newAllergens int) {
+	s.metrics.EventCreated(map[string]int{
+		string(postgres.DogdishFoodTypeEnumEntreesAndSides): len(event.EntreesAndSides),
+		string(postgres.DogdishFoodTypeEnumToppings):        len(event.SaladBar.Toppings),
+		string(postgres.DogdishFoodTypeEnumDressings):       len(event.SaladBar.Dressings),
+	})
+	s.metrics.AllergensDiscovered(newAllergens)
+}
@@ -0,0 +1,165 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+)
+
+// NotifyChannel is the Postgres channel write transactions notify on. The
+// channel name is repeated in the NotifyEventChange query.
+const NotifyChannel = "dogdish_events"
+
+const (
+	// Notification ops
+	OpStoreEvent = "store_event"
+	// OpResync is sent after the listener reconnected, notifications sent
+	// while it was disconnected are lost so every change must be assumed.
+	OpResync = "resync"
+
+	listenerMinReconnect time.Duration = time.Second
+	listenerMaxReconnect time.Duration = time.Minute
+	listenerPingInterval time.Duration = 90 * time.Second
+)
+
+// ChangeNotification describes a committed write, on this instance or on any
+// other one sharing the database.
+type ChangeNotification struct {
+	Op      string    `json:"op"`
+	EventID uuid.UUID `json:"event_id"`
+	ISODate string    `json:"iso_date,omitempty"`
+}
+
+// Subscribe registers fn to be called with every change notification, for
+// cache invalidation and live updates. fn runs on the listener goroutine and
+// must not block. The returned function removes the subscription.
+func (s *Storage) Subscribe(fn func(ChangeNotification)) (unsubscribe func()) {
+	s.subscribersMu.Lock()
+	defer s.subscribersMu.Unlock()
+	if s.subscribers == nil {
+		s.subscribers = make(map[int]func(ChangeNotification))
+	}
+	id := s.nextSubscriber
+	s.nextSubscriber++
+	s.subscribers[id] = fn
+
+	return func() {
+		s.subscribersMu.Lock()
+		defer s.subscribersMu.Unlock()
+		delete(s.subscribers, id)
+	}
+}
+
+func (s *Storage) publish(notification ChangeNotification) {
+	s.subscribersMu.Lock()
+	subscribers := make([]func(ChangeNotification), 0, len(s.subscribers))
+	for _, fn := range s.subscribers {
+		subscribers = append(subscribers, fn)
+	}
+	s.subscribersMu.Unlock()
+
+	for _, fn := range subscribers {
+		fn(notification)
+	}
+}
+
+// Listen keeps a LISTEN connection to the primary and publishes every change
+// notification to the subscribers until ctx is done. The connection is
+// re-established automatically, and with the new credentials after they are
+// rotated. With SQLite there is a single process, so writes are published
+// directly and Listen only waits for ctx.
+func (s *Storage) Listen(ctx context.Context) error {
+	if s.dbType != DBTypePostgres {
+		<-ctx.Done()
+		return nil
+	}
+
+	for {
+		err := s.listen(ctx)
+		if !errors.Is(err, errCredentialsRotated) {
+			return err
+		}
+		log.Info("reconnecting change notification listener with rotated credentials")
+		// Notifications sent while reconnecting are lost
+		s.publish(ChangeNotification{Op: OpResync})
+	}
+}
+
+// errCredentialsRotated ends a listen call so the listener is reopened.
+var errCredentialsRotated = errors.New("credentials rotated")
+
+func (s *Storage) listen(ctx context.Context) error {
+	connectionString, err := s.postgresURL(s.currentSecrets().databaseURL)
+	if err != nil {
+		return err
+	}
+	listener := pq.NewListener(connectionString, listenerMinReconnect, listenerMaxReconnect, func(event pq.ListenerEventType, err error) {
+		switch event {
+		case pq.ListenerEventConnected:
+			log.WithFields(log.Fields{"channel": NotifyChannel}).Info("listening for change notifications")
+		case pq.ListenerEventDisconnected:
+			log.WithError(err).Warn("change notification listener disconnected")
+		case pq.ListenerEventReconnected:
+			log.Info("change notification listener reconnected")
+		case pq.ListenerEventConnectionAttemptFailed:
+			log.WithError(err).Warn("change notification listener failed to connect")
+		}
+	})
+	// Closing the listener also ends a Listen call still waiting for the
+	// first connection
+	stop := context.AfterFunc(ctx, func() { listener.Close() })
+	defer func() {
+		if stop() {
+			listener.Close()
+		}
+	}()
+
+	// The channel is listened on again after every reconnect
+	if err := listener.Listen(NotifyChannel); err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return fmt.Errorf("failed to listen on %s: %w", NotifyChannel, err)
+	}
+
+	ping := time.NewTicker(listenerPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case notification := <-listener.Notify:
+			s.handleNotification(notification)
+		case <-ping.C:
+			if current, err := s.postgresURL(s.currentSecrets().databaseURL); err == nil && current != connectionString {
+				return errCredentialsRotated
+			}
+			// Detects dead connections the server never closed
+			if err := listener.Ping(); err != nil {
+				log.WithError(err).Warn("change notification listener ping failed")
+			}
+		}
+	}
+}
+
+// handleNotification publishes a notification received by the listener. pq
+// sends nil after a reconnect, which is published as OpResync.
+func (s *Storage) handleNotification(notification *pq.Notification) {
+	if notification == nil {
+		s.publish(ChangeNotification{Op: OpResync})
+		return
+	}
+
+	var change ChangeNotification
+	if err := json.Unmarshal([]byte(notification.Extra), &change); err != nil {
+		log.WithError(err).WithFields(log.Fields{"payload": notification.Extra}).Warn("invalid change notification, resyncing")
+		change = ChangeNotification{Op: OpResync}
+	}
+	s.publish(change)
+}
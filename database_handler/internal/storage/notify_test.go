@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+func TestHandleNotification(t *testing.T) {
+	eventID := uuid.New()
+	tests := []struct {
+		name         string
+		notification *pq.Notification
+		expected     ChangeNotification
+	}{
+		{
+			name:         "store event",
+			notification: &pq.Notification{Channel: NotifyChannel, Extra: `{"op":"store_event","event_id":"` + eventID.String() + `","iso_date":"2025-09-03"}`},
+			expected:     ChangeNotification{Op: OpStoreEvent, EventID: eventID, ISODate: "2025-09-03"},
+		},
+		{
+			name:         "reconnect",
+			notification: nil,
+			expected:     ChangeNotification{Op: OpResync},
+		},
+		{
+			name:         "invalid payload",
+			notification: &pq.Notification{Channel: NotifyChannel, Extra: "not json"},
+			expected:     ChangeNotification{Op: OpResync},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var received []ChangeNotification
+			s := NewStorage()
+			s.Subscribe(func(notification ChangeNotification) { received = append(received, notification) })
+
+			s.handleNotification(tt.notification)
+			if len(received) != 1 || received[0] != tt.expected {
+				t.Errorf("expected %+v, got %+v", tt.expected, received)
+			}
+		})
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	s := NewStorage()
+	var first, second int
+	unsubscribe := s.Subscribe(func(ChangeNotification) { first++ })
+	s.Subscribe(func(ChangeNotification) { second++ })
+
+	s.publish(ChangeNotification{Op: OpResync})
+	unsubscribe()
+	s.publish(ChangeNotification{Op: OpResync})
+
+	if first != 1 || second != 2 {
+		t.Errorf("expected 1 and 2 notifications, got %d and %d", first, second)
+	}
+}
@@ -0,0 +1,253 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/internal_types"
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/storage/postgres"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+func (s *Storage) storeEventPostgres(ctx context.Context, event internal_types.Event) (uuid.UUID, error) {
+	dbConnection, err := s.GetDBConnection()
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	dbTx, err := dbConnection.BeginTx(ctx, nil)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	// Rolling back after a successful commit is a no-op
+	defer dbTx.Rollback()
+
+	// Every statement, including the allergen and cuisine upserts, runs in the
+	// transaction so a failed import does not leave orphan rows behind.
+	queryExecutorTx, err := s.GetQueryExecutorWithTx(dbConnection, dbTx)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to create a query executor: %w", err)
+	}
+
+	newAllergens := 0
+	storeFood := func(food internal_types.EntreesAndSidesOrSaladBar, foodType postgres.DogdishFoodTypeEnum, eventID, cuisineID uuid.UUID) (uuid.UUID, error) {
+		var preference postgres.NullDogdishPreferenceEnum
+		var foodID uuid.UUID
+
+		// Handle preference
+		switch food.Preference {
+		case string(postgres.DogdishPreferenceEnumValue0):
+			preference = postgres.NullDogdishPreferenceEnum{Valid: false}
+		case string(postgres.DogdishPreferenceEnumVegan):
+			preference = postgres.NullDogdishPreferenceEnum{
+				DogdishPreferenceEnum: postgres.DogdishPreferenceEnumVegan,
+				Valid:                 true,
+			}
+		case string(postgres.DogdishPreferenceEnumVegetarian):
+			preference = postgres.NullDogdishPreferenceEnum{
+				DogdishPreferenceEnum: postgres.DogdishPreferenceEnumVegetarian,
+				Valid:                 true,
+			}
+		default:
+			preference = postgres.NullDogdishPreferenceEnum{Valid: false}
+		}
+
+		// Create food
+		foodID, err := queryExecutorTx.InsertFood(ctx, postgres.InsertFoodParams{
+			CuisineID:  cuisineID,
+			EventID:    eventID,
+			Name:       food.Name,
+			FoodType:   foodType,
+			Preference: preference,
+		})
+		if err != nil {
+			return uuid.Nil, fmt.Errorf("failed to insert food into database: %w", err)
+		}
+
+		// Handle entree and sides allergens
+		for _, allergen := range food.Allergens {
+			// The unique index on the normalized name makes concurrent imports
+			// of the same allergen wait on each other instead of duplicating it
+			allergenRow, err := queryExecutorTx.UpsertAllergen(ctx, allergen)
+			if err != nil {
+				return uuid.Nil, fmt.Errorf("failed to upsert allergen: %w", err)
+			}
+			if allergenRow.Inserted {
+				newAllergens++
+				log.WithContext(ctx).WithFields(log.Fields{"allergen": allergen}).Info("new allergen detected, adding to database")
+			}
+
+			// Create the food allergen join table
+			_, err = queryExecutorTx.InsertFoodAllergen(ctx, postgres.InsertFoodAllergenParams{
+				FoodID:     foodID,
+				AllergenID: allergenRow.ID,
+			})
+			if err != nil {
+				return uuid.Nil, fmt.Errorf("failed to insert food allergen: %w", err)
+			}
+		}
+
+		return foodID, nil
+	}
+
+	// Ignoring error since this was already validated in validateEvent
+	isoDate, _ := time.Parse(time.DateOnly, event.ISODate)
+
+	// Create Event
+	newEventID, err := queryExecutorTx.InsertEvent(ctx, postgres.InsertEventParams{
+		Date:    event.Weekday,
+		IsoDate: isoDate,
+	})
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to insert event into database: %w", err)
+	}
+
+	// Create Cuisine
+	newCuisineID, err := queryExecutorTx.UpsertCuisine(ctx, event.Cuisine)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to upsert cuisine: %w", err)
+	}
+
+	// Store Entree
+	for _, entree := range event.EntreesAndSides {
+		log.WithContext(ctx).WithFields(log.Fields{"entree": entree}).Debug("inserting entree")
+		_, err := storeFood(entree, postgres.DogdishFoodTypeEnumEntreesAndSides, newEventID, newCuisineID)
+		if err != nil {
+			return uuid.Nil, fmt.Errorf("failed to insert entree into database: %w", err)
+		}
+	}
+
+	// Store salad bar toppings
+	for _, toppings := range event.SaladBar.Toppings {
+		log.WithContext(ctx).WithFields(log.Fields{"topping": toppings}).Debug("inserting topping")
+		_, err := storeFood(toppings, postgres.DogdishFoodTypeEnumToppings, newEventID, newCuisineID)
+		if err != nil {
+			return uuid.Nil, fmt.Errorf("failed to insert topping into database: %w", err)
+		}
+	}
+
+	// Store salad bar dressings
+	for _, dressings := range event.SaladBar.Dressings {
+		log.WithContext(ctx).WithFields(log.Fields{"dressing": dressings}).Debug("inserting dressing")
+		_, err := storeFood(dressings, postgres.DogdishFoodTypeEnumDressings, newEventID, newCuisineID)
+		if err != nil {
+			return uuid.Nil, fmt.Errorf("failed to insert dressing into database: %w", err)
+		}
+	}
+
+	// Every instance, including this one, invalidates its caches when the
+	// notification is delivered on commit
+	payload, err := json.Marshal(ChangeNotification{Op: OpStoreEvent, EventID: newEventID, ISODate: event.ISODate})
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to encode change notification: %w", err)
+	}
+	if err := queryExecutorTx.NotifyEventChange(ctx, string(payload)); err != nil {
+		return uuid.Nil, fmt.Errorf("failed to notify event change: %w", err)
+	}
+
+	if err := dbTx.Commit(); err != nil {
+		return uuid.Nil, &commitError{err: err}
+	}
+	s.recordWrite()
+	s.recordEventStored(event, newAllergens)
+
+	return newEventID, nil
+}
+
+func (s *Storage) getFrontPageEventsPostgres(ctx context.Context, dbConnection *sql.DB) ([]internal_types.StoredEvent, error) {
+	queryExecutor, err := s.GetQueryExecutor(dbConnection)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a query executor: %w", err)
+	}
+
+	rows, err := queryExecutor.GetFrontPageEvents(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get front page events: %w", err)
+	}
+
+	events := make([]internal_types.StoredEvent, 0, len(rows))
+	for _, row := range rows {
+		event, err := decodeEvent(row.ID, row.Date, row.IsoDate.Format(time.DateOnly), row.UpdatedAt, row.Cuisine, row.Foods)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	log.WithContext(ctx).WithFields(log.Fields{"event_count": len(events)}).Info("front page events found")
+
+	return events, nil
+}
+
+func (s *Storage) getEventPostgres(ctx context.Context, dbConnection *sql.DB, eventID uuid.UUID) (internal_types.StoredEvent, error) {
+	queryExecutor, err := s.GetQueryExecutor(dbConnection)
+	if err != nil {
+		return internal_types.StoredEvent{}, fmt.Errorf("failed to create a query executor: %w", err)
+	}
+
+	row, err := queryExecutor.GetEventById(ctx, eventID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return internal_types.StoredEvent{}, ErrNotFound
+	}
+	if err != nil {
+		return internal_types.StoredEvent{}, fmt.Errorf("failed to get event by id: %w", err)
+	}
+
+	return decodeEvent(row.ID, row.Date, row.IsoDate.Format(time.DateOnly), row.UpdatedAt, row.Cuisine, row.Foods)
+}
+
+func (s *Storage) listEventsPostgres(ctx context.Context, dbConnection *sql.DB) ([]internal_types.StoredEvent, error) {
+	queryExecutor, err := s.GetQueryExecutor(dbConnection)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a query executor: %w", err)
+	}
+
+	rows, err := queryExecutor.ListEvents(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list events: %w", err)
+	}
+
+	events := make([]internal_types.StoredEvent, 0, len(rows))
+	for _, row := range rows {
+		event, err := decodeEvent(row.ID, row.Date, row.IsoDate.Format(time.DateOnly), row.UpdatedAt, row.Cuisine, row.Foods)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+func (s *Storage) getEventsByDatePostgres(ctx context.Context, dbConnection *sql.DB, isoDate string) ([]internal_types.StoredEvent, error) {
+	date, err := time.Parse(time.DateOnly, isoDate)
+	if err != nil {
+		return nil, &Error{Kind: ErrValidation, Op: "get events by date", Err: err}
+	}
+
+	queryExecutor, err := s.GetQueryExecutor(dbConnection)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a query executor: %w", err)
+	}
+
+	rows, err := queryExecutor.ListEventsByDate(ctx, date)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list events by date: %w", err)
+	}
+
+	events := make([]internal_types.StoredEvent, 0, len(rows))
+	for _, row := range rows {
+		event, err := decodeEvent(row.ID, row.Date, row.IsoDate.Format(time.DateOnly), row.UpdatedAt, row.Cuisine, row.Foods)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	return events, nil
+}
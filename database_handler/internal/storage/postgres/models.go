@@ -5,6 +5,7 @@
 package postgres
 
 import (
+	"database/sql"
 	"database/sql/driver"
 	"fmt"
 	"time"
@@ -103,15 +104,27 @@ type DogdishAllergen struct {
 	Name string
 }
 
+type DogdishApiKey struct {
+	ID         uuid.UUID
+	Name       string
+	Prefix     string
+	Hash       string
+	Scope      string
+	CreatedAt  time.Time
+	LastUsedAt sql.NullTime
+	RevokedAt  sql.NullTime
+}
+
 type DogdishCuisine struct {
 	ID   uuid.UUID
 	Name string
 }
 
 type DogdishEvent struct {
-	ID      uuid.UUID
-	Date    string
-	IsoDate time.Time
+	ID        uuid.UUID
+	Date      string
+	IsoDate   time.Time
+	UpdatedAt time.Time
 }
 
 type DogdishFood struct {
@@ -127,3 +140,10 @@ type DogdishFoodAllergen struct {
 	FoodID     uuid.UUID
 	AllergenID uuid.UUID
 }
+
+type DogdishRateLimitBucket struct {
+	Key       string
+	Tokens    float64
+	Allowed   bool
+	UpdatedAt time.Time
+}
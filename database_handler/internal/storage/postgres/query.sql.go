@@ -7,11 +7,47 @@ package postgres
 
 import (
 	"context"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const deleteIdleRateLimitBuckets = `-- name: DeleteIdleRateLimitBuckets :execrows
+DELETE FROM dogdish.rate_limit_bucket WHERE updated_at < $1
+`
+
+func (q *Queries) DeleteIdleRateLimitBuckets(ctx context.Context, updatedAt time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteIdleRateLimitBuckets, updatedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getActiveAPIKeyByHash = `-- name: GetActiveAPIKeyByHash :one
+SELECT id, name, prefix, hash, scope, created_at, last_used_at, revoked_at
+FROM dogdish.api_key
+WHERE hash = $1 AND revoked_at IS NULL
+`
+
+func (q *Queries) GetActiveAPIKeyByHash(ctx context.Context, hash string) (DogdishApiKey, error) {
+	row := q.db.QueryRowContext(ctx, getActiveAPIKeyByHash, hash)
+	var i DogdishApiKey
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Prefix,
+		&i.Hash,
+		&i.Scope,
+		&i.CreatedAt,
+		&i.LastUsedAt,
+		&i.RevokedAt,
+	)
+	return i, err
+}
+
 const getAllAllergens = `-- name: GetAllAllergens :many
 SELECT id, name FROM dogdish.allergen
 `
@@ -68,7 +104,7 @@ func (q *Queries) GetAllCuisines(ctx context.Context) ([]DogdishCuisine, error)
 }
 
 const getAllEvents = `-- name: GetAllEvents :many
-SELECT id, date, iso_date FROM dogdish.event
+SELECT id, date, iso_date, updated_at FROM dogdish.event
 `
 
 func (q *Queries) GetAllEvents(ctx context.Context) ([]DogdishEvent, error) {
@@ -80,7 +116,12 @@ func (q *Queries) GetAllEvents(ctx context.Context) ([]DogdishEvent, error) {
 	var items []DogdishEvent
 	for rows.Next() {
 		var i DogdishEvent
-		if err := rows.Scan(&i.ID, &i.Date, &i.IsoDate); err != nil {
+		if err := rows.Scan(
+			&i.ID,
+			&i.Date,
+			&i.IsoDate,
+			&i.UpdatedAt,
+		); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -251,25 +292,67 @@ const getCurrentEvent = `-- name: GetCurrentEvent :one
 SELECT id, date, iso_date FROM dogdish.event WHERE iso_date = CURRENT_DATE LIMIT 1
 `
 
-func (q *Queries) GetCurrentEvent(ctx context.Context) (DogdishEvent, error) {
+type GetCurrentEventRow struct {
+	ID      uuid.UUID
+	Date    string
+	IsoDate time.Time
+}
+
+func (q *Queries) GetCurrentEvent(ctx context.Context) (GetCurrentEventRow, error) {
 	row := q.db.QueryRowContext(ctx, getCurrentEvent)
-	var i DogdishEvent
+	var i GetCurrentEventRow
 	err := row.Scan(&i.ID, &i.Date, &i.IsoDate)
 	return i, err
 }
 
+const getEventById = `-- name: GetEventById :one
+SELECT
+    e.id,
+    e.date,
+    e.iso_date,
+    e.updated_at,
+    COALESCE(ef.cuisine, '')::text AS cuisine,
+    COALESCE(ef.foods, '[]')::json AS foods
+FROM dogdish.event e
+LEFT JOIN LATERAL dogdish.event_foods(e.id) ef ON true
+WHERE e.id = $1
+`
+
+type GetEventByIdRow struct {
+	ID        uuid.UUID
+	Date      string
+	IsoDate   time.Time
+	UpdatedAt time.Time
+	Cuisine   string
+	Foods     json.RawMessage
+}
+
+func (q *Queries) GetEventById(ctx context.Context, id uuid.UUID) (GetEventByIdRow, error) {
+	row := q.db.QueryRowContext(ctx, getEventById, id)
+	var i GetEventByIdRow
+	err := row.Scan(
+		&i.ID,
+		&i.Date,
+		&i.IsoDate,
+		&i.UpdatedAt,
+		&i.Cuisine,
+		&i.Foods,
+	)
+	return i, err
+}
+
 const getFoodsByEventId = `-- name: GetFoodsByEventId :many
 SELECT 
     f.name, 
     f.food_type, 
     f.preference, 
     f.cuisine_id,
-    STRING_AGG(a.name, ',') as allergen_names
+    COALESCE(ARRAY_AGG(a.name ORDER BY a.name) FILTER (WHERE a.id IS NOT NULL), '{}')::text[] as allergen_names
 FROM dogdish.food f 
-JOIN dogdish.food_allergen fa ON f.id = fa.food_id 
-JOIN dogdish.allergen a ON fa.allergen_id = a.id 
+LEFT JOIN dogdish.food_allergen fa ON f.id = fa.food_id 
+LEFT JOIN dogdish.allergen a ON fa.allergen_id = a.id 
 WHERE event_id = $1
-GROUP BY f.name, f.food_type, f.preference, f.cuisine_id
+GROUP BY f.id, f.name, f.food_type, f.preference, f.cuisine_id
 `
 
 type GetFoodsByEventIdRow struct {
@@ -277,7 +360,7 @@ type GetFoodsByEventIdRow struct {
 	FoodType      DogdishFoodTypeEnum
 	Preference    NullDogdishPreferenceEnum
 	CuisineID     uuid.UUID
-	AllergenNames []byte
+	AllergenNames []string
 }
 
 func (q *Queries) GetFoodsByEventId(ctx context.Context, eventID uuid.UUID) ([]GetFoodsByEventIdRow, error) {
@@ -294,7 +377,76 @@ func (q *Queries) GetFoodsByEventId(ctx context.Context, eventID uuid.UUID) ([]G
 			&i.FoodType,
 			&i.Preference,
 			&i.CuisineID,
-			&i.AllergenNames,
+			pq.Array(&i.AllergenNames),
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getFrontPageEvents = `-- name: GetFrontPageEvents :many
+WITH previous_event AS (
+    SELECT id, date, iso_date, updated_at FROM dogdish.event WHERE iso_date < CURRENT_DATE ORDER BY iso_date DESC LIMIT 1
+), current_event AS (
+    SELECT id, date, iso_date, updated_at FROM dogdish.event WHERE iso_date = CURRENT_DATE LIMIT 1
+), future_events AS (
+    SELECT id, date, iso_date, updated_at FROM dogdish.event WHERE iso_date > CURRENT_DATE ORDER BY iso_date
+    LIMIT CASE
+        WHEN EXISTS (SELECT 1 FROM previous_event) OR EXISTS (SELECT 1 FROM current_event) THEN 2
+        ELSE 1
+    END
+), front_page_events AS (
+    SELECT id, date, iso_date, updated_at FROM previous_event
+    UNION ALL
+    SELECT id, date, iso_date, updated_at FROM current_event
+    UNION ALL
+    SELECT id, date, iso_date, updated_at FROM future_events
+)
+SELECT
+    e.id,
+    e.date,
+    e.iso_date,
+    e.updated_at,
+    ef.cuisine::text AS cuisine,
+    ef.foods::json AS foods
+FROM front_page_events e
+JOIN LATERAL dogdish.event_foods(e.id) ef ON true
+ORDER BY e.iso_date
+`
+
+type GetFrontPageEventsRow struct {
+	ID        uuid.UUID
+	Date      string
+	IsoDate   time.Time
+	UpdatedAt time.Time
+	Cuisine   string
+	Foods     json.RawMessage
+}
+
+func (q *Queries) GetFrontPageEvents(ctx context.Context) ([]GetFrontPageEventsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getFrontPageEvents)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetFrontPageEventsRow
+	for rows.Next() {
+		var i GetFrontPageEventsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Date,
+			&i.IsoDate,
+			&i.UpdatedAt,
+			&i.Cuisine,
+			&i.Foods,
 		); err != nil {
 			return nil, err
 		}
@@ -313,15 +465,21 @@ const getFutureEvents = `-- name: GetFutureEvents :many
 SELECT id, date, iso_date FROM dogdish.event WHERE iso_date > CURRENT_DATE LIMIT $1
 `
 
-func (q *Queries) GetFutureEvents(ctx context.Context, limit int32) ([]DogdishEvent, error) {
+type GetFutureEventsRow struct {
+	ID      uuid.UUID
+	Date    string
+	IsoDate time.Time
+}
+
+func (q *Queries) GetFutureEvents(ctx context.Context, limit int32) ([]GetFutureEventsRow, error) {
 	rows, err := q.db.QueryContext(ctx, getFutureEvents, limit)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []DogdishEvent
+	var items []GetFutureEventsRow
 	for rows.Next() {
-		var i DogdishEvent
+		var i GetFutureEventsRow
 		if err := rows.Scan(&i.ID, &i.Date, &i.IsoDate); err != nil {
 			return nil, err
 		}
@@ -340,35 +498,50 @@ const getPreviousEvent = `-- name: GetPreviousEvent :one
 SELECT id, date, iso_date FROM dogdish.event WHERE iso_date < CURRENT_DATE LIMIT 1
 `
 
-func (q *Queries) GetPreviousEvent(ctx context.Context) (DogdishEvent, error) {
+type GetPreviousEventRow struct {
+	ID      uuid.UUID
+	Date    string
+	IsoDate time.Time
+}
+
+func (q *Queries) GetPreviousEvent(ctx context.Context) (GetPreviousEventRow, error) {
 	row := q.db.QueryRowContext(ctx, getPreviousEvent)
-	var i DogdishEvent
+	var i GetPreviousEventRow
 	err := row.Scan(&i.ID, &i.Date, &i.IsoDate)
 	return i, err
 }
 
-const insertAllergen = `-- name: InsertAllergen :one
-INSERT INTO dogdish.allergen (name) VALUES ($1) RETURNING id
+const insertAPIKey = `-- name: InsertAPIKey :one
+INSERT INTO dogdish.api_key (name, prefix, hash, scope) VALUES ($1, $2, $3, $4)
+RETURNING id, name, prefix, hash, scope, created_at, last_used_at, revoked_at
 `
 
-func (q *Queries) InsertAllergen(ctx context.Context, name string) (uuid.UUID, error) {
-	row := q.db.QueryRowContext(ctx, insertAllergen, name)
-	var id uuid.UUID
-	err := row.Scan(&id)
-	return id, err
+type InsertAPIKeyParams struct {
+	Name   string
+	Prefix string
+	Hash   string
+	Scope  string
 }
 
-const insertCuisine = `-- name: InsertCuisine :one
-
-INSERT INTO dogdish.cuisine (name) VALUES ($1) RETURNING id
-`
-
-// Inserts
-func (q *Queries) InsertCuisine(ctx context.Context, name string) (uuid.UUID, error) {
-	row := q.db.QueryRowContext(ctx, insertCuisine, name)
-	var id uuid.UUID
-	err := row.Scan(&id)
-	return id, err
+func (q *Queries) InsertAPIKey(ctx context.Context, arg InsertAPIKeyParams) (DogdishApiKey, error) {
+	row := q.db.QueryRowContext(ctx, insertAPIKey,
+		arg.Name,
+		arg.Prefix,
+		arg.Hash,
+		arg.Scope,
+	)
+	var i DogdishApiKey
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Prefix,
+		&i.Hash,
+		&i.Scope,
+		&i.CreatedAt,
+		&i.LastUsedAt,
+		&i.RevokedAt,
+	)
+	return i, err
 }
 
 const insertEvent = `-- name: InsertEvent :one
@@ -427,3 +600,249 @@ func (q *Queries) InsertFoodAllergen(ctx context.Context, arg InsertFoodAllergen
 	err := row.Scan(&column_1)
 	return column_1, err
 }
+
+const listAPIKeys = `-- name: ListAPIKeys :many
+SELECT id, name, prefix, hash, scope, created_at, last_used_at, revoked_at
+FROM dogdish.api_key
+ORDER BY created_at, id
+`
+
+func (q *Queries) ListAPIKeys(ctx context.Context) ([]DogdishApiKey, error) {
+	rows, err := q.db.QueryContext(ctx, listAPIKeys)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []DogdishApiKey
+	for rows.Next() {
+		var i DogdishApiKey
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Prefix,
+			&i.Hash,
+			&i.Scope,
+			&i.CreatedAt,
+			&i.LastUsedAt,
+			&i.RevokedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listEvents = `-- name: ListEvents :many
+SELECT
+    e.id,
+    e.date,
+    e.iso_date,
+    e.updated_at,
+    COALESCE(ef.cuisine, '')::text AS cuisine,
+    COALESCE(ef.foods, '[]')::json AS foods
+FROM dogdish.event e
+LEFT JOIN LATERAL dogdish.event_foods(e.id) ef ON true
+ORDER BY e.iso_date
+`
+
+type ListEventsRow struct {
+	ID        uuid.UUID
+	Date      string
+	IsoDate   time.Time
+	UpdatedAt time.Time
+	Cuisine   string
+	Foods     json.RawMessage
+}
+
+func (q *Queries) ListEvents(ctx context.Context) ([]ListEventsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listEvents)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListEventsRow
+	for rows.Next() {
+		var i ListEventsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Date,
+			&i.IsoDate,
+			&i.UpdatedAt,
+			&i.Cuisine,
+			&i.Foods,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listEventsByDate = `-- name: ListEventsByDate :many
+SELECT
+    e.id,
+    e.date,
+    e.iso_date,
+    e.updated_at,
+    COALESCE(ef.cuisine, '')::text AS cuisine,
+    COALESCE(ef.foods, '[]')::json AS foods
+FROM dogdish.event e
+LEFT JOIN LATERAL dogdish.event_foods(e.id) ef ON true
+WHERE e.iso_date = $1
+ORDER BY e.id
+`
+
+type ListEventsByDateRow struct {
+	ID        uuid.UUID
+	Date      string
+	IsoDate   time.Time
+	UpdatedAt time.Time
+	Cuisine   string
+	Foods     json.RawMessage
+}
+
+func (q *Queries) ListEventsByDate(ctx context.Context, isoDate time.Time) ([]ListEventsByDateRow, error) {
+	rows, err := q.db.QueryContext(ctx, listEventsByDate, isoDate)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListEventsByDateRow
+	for rows.Next() {
+		var i ListEventsByDateRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Date,
+			&i.IsoDate,
+			&i.UpdatedAt,
+			&i.Cuisine,
+			&i.Foods,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const notifyEventChange = `-- name: NotifyEventChange :exec
+
+SELECT pg_notify('dogdish_events', $1::text)
+`
+
+// Delivered to the listeners when the transaction commits
+func (q *Queries) NotifyEventChange(ctx context.Context, payload string) error {
+	_, err := q.db.ExecContext(ctx, notifyEventChange, payload)
+	return err
+}
+
+const revokeAPIKey = `-- name: RevokeAPIKey :execrows
+
+UPDATE dogdish.api_key SET revoked_at = COALESCE(revoked_at, now()) WHERE id = $1
+`
+
+// Revoking a revoked key keeps the first revocation time
+func (q *Queries) RevokeAPIKey(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, revokeAPIKey, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const takeRateLimitToken = `-- name: TakeRateLimitToken :one
+
+INSERT INTO dogdish.rate_limit_bucket AS bucket (key, tokens, allowed, updated_at)
+VALUES ($1, $2::float8 - 1, true, now())
+ON CONFLICT (key) DO UPDATE SET
+  tokens = LEAST($2::float8, bucket.tokens + EXTRACT(EPOCH FROM now() - bucket.updated_at)::float8 * $3::float8)
+    - CASE WHEN LEAST($2::float8, bucket.tokens + EXTRACT(EPOCH FROM now() - bucket.updated_at)::float8 * $3::float8) >= 1 THEN 1 ELSE 0 END,
+  allowed = LEAST($2::float8, bucket.tokens + EXTRACT(EPOCH FROM now() - bucket.updated_at)::float8 * $3::float8) >= 1,
+  updated_at = now()
+RETURNING tokens, allowed
+`
+
+type TakeRateLimitTokenParams struct {
+	Key   string
+	Burst float64
+	Rate  float64
+}
+
+type TakeRateLimitTokenRow struct {
+	Tokens  float64
+	Allowed bool
+}
+
+// Refills the bucket for the time since its last update and takes a token if there is one, in one statement so replicas can't both take the last token
+func (q *Queries) TakeRateLimitToken(ctx context.Context, arg TakeRateLimitTokenParams) (TakeRateLimitTokenRow, error) {
+	row := q.db.QueryRowContext(ctx, takeRateLimitToken, arg.Key, arg.Burst, arg.Rate)
+	var i TakeRateLimitTokenRow
+	err := row.Scan(&i.Tokens, &i.Allowed)
+	return i, err
+}
+
+const touchAPIKey = `-- name: TouchAPIKey :exec
+
+UPDATE dogdish.api_key SET last_used_at = now()
+WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < now() - INTERVAL '1 minute')
+`
+
+// Written at most once a minute, so authenticating doesn't write on every request
+func (q *Queries) TouchAPIKey(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, touchAPIKey, id)
+	return err
+}
+
+const upsertAllergen = `-- name: UpsertAllergen :one
+
+INSERT INTO dogdish.allergen (name) VALUES (BTRIM($1))
+ON CONFLICT ((LOWER(BTRIM(name)))) DO UPDATE SET name = dogdish.allergen.name
+RETURNING id, (xmax = 0)::boolean AS inserted
+`
+
+type UpsertAllergenRow struct {
+	ID       uuid.UUID
+	Inserted bool
+}
+
+// xmax is only zero for rows inserted by this statement
+func (q *Queries) UpsertAllergen(ctx context.Context, btrim string) (UpsertAllergenRow, error) {
+	row := q.db.QueryRowContext(ctx, upsertAllergen, btrim)
+	var i UpsertAllergenRow
+	err := row.Scan(&i.ID, &i.Inserted)
+	return i, err
+}
+
+const upsertCuisine = `-- name: UpsertCuisine :one
+
+INSERT INTO dogdish.cuisine (name) VALUES (BTRIM($1))
+ON CONFLICT ((LOWER(BTRIM(name)))) DO UPDATE SET name = dogdish.cuisine.name
+RETURNING id
+`
+
+// Inserts
+func (q *Queries) UpsertCuisine(ctx context.Context, btrim string) (uuid.UUID, error) {
+	row := q.db.QueryRowContext(ctx, upsertCuisine, btrim)
+	var id uuid.UUID
+	err := row.Scan(&id)
+	return id, err
+}
@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/storage/postgres"
+)
+
+// TakeRateLimitToken takes a token from the shared bucket key, refilled at
+// rate tokens a second up to burst. It returns the tokens left and whether
+// one was taken. Buckets are only stored in Postgres.
+func (s *Storage) TakeRateLimitToken(ctx context.Context, key string, rate float64, burst int) (float64, bool, error) {
+	row, err := retry(ctx, s, "take rate limit token", func(ctx context.Context) (postgres.TakeRateLimitTokenRow, error) {
+		if s.dbType != DBTypePostgres {
+			return postgres.TakeRateLimitTokenRow{}, fmt.Errorf("database type %s doesn't store rate limit buckets", s.dbType)
+		}
+		queryExecutor, err := s.getPostgresQueryExecutor()
+		if err != nil {
+			return postgres.TakeRateLimitTokenRow{}, err
+		}
+		row, err := queryExecutor.TakeRateLimitToken(ctx, postgres.TakeRateLimitTokenParams{
+			Key:   key,
+			Burst: float64(burst),
+			Rate:  rate,
+		})
+		if err != nil {
+			return postgres.TakeRateLimitTokenRow{}, fmt.Errorf("failed to take rate limit token: %w", err)
+		}
+		return row, nil
+	})
+	return row.Tokens, row.Allowed, err
+}
+
+// DeleteIdleRateLimitBuckets deletes the buckets not used since before, which
+// are full again, and returns how many were deleted.
+func (s *Storage) DeleteIdleRateLimitBuckets(ctx context.Context, before time.Time) (int64, error) {
+	return retry(ctx, s, "delete idle rate limit buckets", func(ctx context.Context) (int64, error) {
+		if s.dbType != DBTypePostgres {
+			return 0, fmt.Errorf("database type %s doesn't store rate limit buckets", s.dbType)
+		}
+		queryExecutor, err := s.getPostgresQueryExecutor()
+		if err != nil {
+			return 0, err
+		}
+		deleted, err := queryExecutor.DeleteIdleRateLimitBuckets(ctx, before)
+		if err != nil {
+			return 0, fmt.Errorf("failed to delete idle rate limit buckets: %w", err)
+		}
+		return deleted, nil
+	})
+}
@@ -0,0 +1,54 @@
+package storage_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/storage"
+	"github.com/google/uuid"
+)
+
+func TestSQLiteRateLimitUnsupported(t *testing.T) {
+	s := openSQLite(t).(*storage.Storage)
+
+	if _, _, err := s.TakeRateLimitToken(context.Background(), "ip:192.0.2.1", 1, 1); err == nil {
+		t.Errorf("expected sqlite not to store rate limit buckets")
+	}
+}
+
+func TestPostgresRateLimit(t *testing.T) {
+	host := os.Getenv("DH_TEST_DB_HOST")
+	if host == "" {
+		t.Skip("DH_TEST_DB_HOST not set")
+	}
+	s := openPostgres(t, host)
+	ctx := context.Background()
+	key := "test:" + uuid.NewString()
+
+	// A slow refill, so the bucket only holds its burst during the test
+	for i := range 3 {
+		tokens, allowed, err := s.TakeRateLimitToken(ctx, key, 0.001, 2)
+		if err != nil {
+			t.Fatalf("failed to take a token: %v", err)
+		}
+		if allowed != (i < 2) {
+			t.Errorf("take %d: expected allowed to be %t", i+1, i < 2)
+		}
+		if want := float64(1 - i); i < 2 && (tokens < want || tokens > want+0.1) {
+			t.Errorf("take %d: expected about %v tokens left, got %v", i+1, want, tokens)
+		}
+	}
+
+	deleted, err := s.DeleteIdleRateLimitBuckets(ctx, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("failed to delete idle buckets: %v", err)
+	}
+	if deleted < 1 {
+		t.Errorf("expected the bucket to be deleted, got %d", deleted)
+	}
+	if _, allowed, err := s.TakeRateLimitToken(ctx, key, 0.001, 2); err != nil || !allowed {
+		t.Errorf("expected a deleted bucket to start full, got %t, %v", allowed, err)
+	}
+}
@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultReplicaReadAfterWrite is how long reads stay on the primary after
+	// a write, so a client reading back what it just stored does not race the
+	// replication lag.
+	DefaultReplicaReadAfterWrite time.Duration = 5 * time.Second
+
+	// replicaRetryAfter is how long reads skip the replica after it failed
+	replicaRetryAfter time.Duration = 30 * time.Second
+)
+
+// WithReplicaURL sets a postgres:// URL for a read replica. Reads go to the
+// replica while writes, and reads shortly after a write, use the primary. The
+// connection options other than the URL are shared with the primary.
+func (s *Storage) WithReplicaURL(replicaURL string) *Storage {
+	s.replicaURL = replicaURL
+	return s
+}
+
+// WithReplicaReadAfterWrite sets how long reads stay on the primary after a
+// write.
+func (s *Storage) WithReplicaReadAfterWrite(readAfterWrite time.Duration) *Storage {
+	s.replicaReadAfterWrite = readAfterWrite
+	return s
+}
+
+// ReplicaStats returns the replica connection pool statistics, the boolean is
+// false when no replica is configured.
+func (s *Storage) ReplicaStats() (sql.DBStats, bool) {
+	if s.replica == nil {
+		return sql.DBStats{}, false
+	}
+	return s.replica.Stats(), true
+}
+
+// PingReplica checks the replica can be reached, the boolean is false when no
+// replica is configured.
+func (s *Storage) PingReplica(ctx context.Context) (bool, error) {
+	if s.replica == nil {
+		return false, nil
+	}
+	return true, classify("ping replica", s.replica.PingContext(ctx))
+}
+
+// readDB returns the pool reads should use: the replica, unless there is none,
+// it failed recently or there was a write within the read after write window.
+func (s *Storage) readDB() *sql.DB {
+	if s.replica == nil {
+		return s.db
+	}
+
+	s.replicaMu.Lock()
+	defer s.replicaMu.Unlock()
+	now := time.Now()
+	if now.Before(s.replicaDownUntil) || now.Before(s.lastWrite.Add(s.replicaReadAfterWrite)) {
+		return s.db
+	}
+	return s.replica
+}
+
+// recordWrite keeps reads on the primary for the read after write window.
+func (s *Storage) recordWrite() {
+	if s.replica == nil {
+		return
+	}
+	s.replicaMu.Lock()
+	defer s.replicaMu.Unlock()
+	s.lastWrite = time.Now()
+}
+
+func (s *Storage) markReplicaDown(ctx context.Context, err error) {
+	s.replicaMu.Lock()
+	defer s.replicaMu.Unlock()
+	if time.Now().Before(s.replicaDownUntil) {
+		return
+	}
+	s.replicaDownUntil = time.Now().Add(replicaRetryAfter)
+	log.WithContext(ctx).WithError(err).WithFields(log.Fields{"retry_after": replicaRetryAfter.String()}).Warn("replica unavailable, reading from the primary")
+}
+
+// readFrom runs a read on the pool picked by readDB. When the replica fails
+// with a transient error it is skipped for a while and the read is repeated on
+// the primary, as it is when the replica does not have the record yet.
+func readFrom[T any](ctx context.Context, s *Storage, read func(db *sql.DB) (T, error)) (T, error) {
+	db := s.readDB()
+	result, err := read(db)
+	if err == nil || db == s.db {
+		return result, err
+	}
+
+	err = classify("read from replica", err)
+	switch {
+	case errors.Is(err, ErrTransient):
+		s.markReplicaDown(ctx, err)
+	case errors.Is(err, ErrNotFound):
+		log.WithContext(ctx).WithError(err).Debug("record not found on the replica, reading from the primary")
+	default:
+		return result, err
+	}
+	return read(s.db)
+}
@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// newReplicaStorage returns a storage with distinct, never connected, primary
+// and replica pools, enough to check which one a read is routed to.
+func newReplicaStorage(t *testing.T) *Storage {
+	t.Helper()
+
+	s := NewStorage()
+	for _, pool := range []**sql.DB{&s.db, &s.replica} {
+		db, err := sql.Open("sqlite", ":memory:")
+		if err != nil {
+			t.Fatalf("failed to open pool: %v", err)
+		}
+		*pool = db
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestReadFromReplica(t *testing.T) {
+	tests := []struct {
+		name         string
+		setup        func(s *Storage)
+		replicaErr   error
+		expectedPool []string
+		expectedErr  error
+	}{
+		{
+			name:         "reads use the replica",
+			expectedPool: []string{"replica"},
+		},
+		{
+			name:         "reads after a write use the primary",
+			setup:        func(s *Storage) { s.recordWrite() },
+			expectedPool: []string{"primary"},
+		},
+		{
+			name:         "reads after the write window use the replica",
+			setup:        func(s *Storage) { s.lastWrite = time.Now().Add(-time.Minute) },
+			expectedPool: []string{"replica"},
+		},
+		{
+			name:         "connection failures fall back to the primary",
+			replicaErr:   fmt.Errorf("failed to list events: %w", driver.ErrBadConn),
+			expectedPool: []string{"replica", "primary"},
+		},
+		{
+			name:         "missing records are read from the primary",
+			replicaErr:   ErrNotFound,
+			expectedPool: []string{"replica", "primary"},
+		},
+		{
+			name:         "query errors are returned",
+			replicaErr:   &pq.Error{Code: "42P01"},
+			expectedPool: []string{"replica"},
+			expectedErr:  &pq.Error{Code: "42P01"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newReplicaStorage(t)
+			if tt.setup != nil {
+				tt.setup(s)
+			}
+
+			var pools []string
+			_, err := readFrom(context.Background(), s, func(db *sql.DB) (int, error) {
+				if db == s.replica {
+					pools = append(pools, "replica")
+					return 0, tt.replicaErr
+				}
+				pools = append(pools, "primary")
+				return 1, nil
+			})
+
+			if fmt.Sprint(pools) != fmt.Sprint(tt.expectedPool) {
+				t.Errorf("expected reads from %v, got %v", tt.expectedPool, pools)
+			}
+			if (err == nil) != (tt.expectedErr == nil) || (err != nil && !errors.As(err, new(*pq.Error))) {
+				t.Errorf("expected error %v, got %v", tt.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestReadFromSkipsFailedReplica(t *testing.T) {
+	s := newReplicaStorage(t)
+
+	readFrom(context.Background(), s, func(db *sql.DB) (int, error) {
+		if db == s.replica {
+			return 0, driver.ErrBadConn
+		}
+		return 1, nil
+	})
+
+	if s.readDB() != s.db {
+		t.Errorf("expected reads to skip the replica after it failed")
+	}
+	s.replicaDownUntil = time.Now().Add(-time.Second)
+	if s.readDB() != s.replica {
+		t.Errorf("expected reads to go back to the replica once the retry delay passed")
+	}
+}
+
+func TestReadFromWithoutReplica(t *testing.T) {
+	s := newReplicaStorage(t)
+	s.replica.Close()
+	s.replica = nil
+
+	s.recordWrite()
+	if s.readDB() != s.db {
+		t.Errorf("expected reads to use the primary without a replica")
+	}
+}
@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/internal_types"
+	"github.com/google/uuid"
+)
+
+// Repository is the set of event operations the HTTP handlers depend on. It is
+// implemented by Storage and by memory.Storage for tests. Errors can be
+// matched against the error kinds in errors.go.
+type Repository interface {
+	// StoreEvent stores the event along with its cuisine, foods and allergens
+	// and returns the new event's ID.
+	StoreEvent(ctx context.Context, event internal_types.Event) (uuid.UUID, error)
+
+	// GetEvent returns a single event, or ErrNotFound.
+	GetEvent(ctx context.Context, eventID uuid.UUID) (internal_types.StoredEvent, error)
+
+	// ListEvents returns every event ordered by date.
+	ListEvents(ctx context.Context) ([]internal_types.StoredEvent, error)
+
+	// GetEventsByDate returns the events, usually only one, on the given
+	// YYYY-MM-DD date.
+	GetEventsByDate(ctx context.Context, isoDate string) ([]internal_types.StoredEvent, error)
+
+	// GetFrontPageEvents returns the previous, current and upcoming events that
+	// have food.
+	GetFrontPageEvents(ctx context.Context) ([]internal_types.StoredEvent, error)
+}
+
+var _ Repository = (*Storage)(nil)
+
+// APIKeyStore stores the API keys by their hash. It is implemented by Storage
+// and by memory.Storage for tests.
+type APIKeyStore interface {
+	// CreateAPIKey stores a key with the hash of its value.
+	CreateAPIKey(ctx context.Context, name, scope, prefix, hash string) (internal_types.APIKey, error)
+
+	// AuthenticateAPIKey returns the key with the hash and records that it
+	// was used, or ErrNotFound when there is none or it was revoked.
+	AuthenticateAPIKey(ctx context.Context, hash string) (internal_types.APIKey, error)
+
+	// ListAPIKeys returns every key, revoked ones included, oldest first.
+	ListAPIKeys(ctx context.Context) ([]internal_types.APIKey, error)
+
+	// RevokeAPIKey revokes a key, or returns ErrNotFound.
+	RevokeAPIKey(ctx context.Context, id uuid.UUID) error
+}
+
+var _ APIKeyStore = (*Storage)(nil)
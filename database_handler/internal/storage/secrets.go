@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultSecretRefreshInterval is how often the secret files are re-read.
+const DefaultSecretRefreshInterval = time.Minute
+
+// WithPasswordFile reads the password from a file, such as a mounted
+// Kubernetes secret, instead of WithPassword.
+func (s *Storage) WithPasswordFile(path string) *Storage {
+	s.passwordFile = path
+	return s
+}
+
+// WithDatabaseURLFile reads the database URL from a file instead of
+// WithDatabaseURL.
+func (s *Storage) WithDatabaseURLFile(path string) *Storage {
+	s.databaseURLFile = path
+	return s
+}
+
+// WithReplicaURLFile reads the replica URL from a file instead of
+// WithReplicaURL.
+func (s *Storage) WithReplicaURLFile(path string) *Storage {
+	s.replicaURLFile = path
+	return s
+}
+
+// secrets are the credentials that can be rotated while the pools are open.
+type secrets struct {
+	password    string
+	databaseURL string
+	replicaURL  string
+}
+
+// currentSecrets returns the credentials new connections are opened with.
+func (s *Storage) currentSecrets() secrets {
+	s.secretsMu.RLock()
+	defer s.secretsMu.RUnlock()
+	return secrets{
+		password:    s.password,
+		databaseURL: s.databaseURL,
+		replicaURL:  s.replicaURL,
+	}
+}
+
+// readSecrets returns the current credentials with the values of the secret
+// files, along with the files that could not be read.
+func (s *Storage) readSecrets() (secrets, []error) {
+	current := s.currentSecrets()
+	var errs []error
+	for _, file := range []struct {
+		path  string
+		value *string
+	}{
+		{s.passwordFile, &current.password},
+		{s.databaseURLFile, &current.databaseURL},
+		{s.replicaURLFile, &current.replicaURL},
+	} {
+		if file.path == "" {
+			continue
+		}
+		value, err := readSecretFile(file.path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		*file.value = value
+	}
+	return current, errs
+}
+
+// loadSecrets re-reads the secret files. The credentials are only replaced
+// when every file could be read, so a rotation caught half way through is
+// picked up on the next refresh instead.
+func (s *Storage) loadSecrets() (changed bool, err error) {
+	loaded, errs := s.readSecrets()
+	if len(errs) > 0 {
+		return false, errors.Join(errs...)
+	}
+
+	s.secretsMu.Lock()
+	defer s.secretsMu.Unlock()
+	changed = loaded.password != s.password || loaded.databaseURL != s.databaseURL || loaded.replicaURL != s.replicaURL
+	s.password, s.databaseURL, s.replicaURL = loaded.password, loaded.databaseURL, loaded.replicaURL
+	return changed, nil
+}
+
+// readSecretFile reads a secret without the trailing newline most editors and
+// `echo` add.
+func readSecretFile(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("secret file %s cannot be read: %w", path, errors.Unwrap(err))
+	}
+	value := strings.TrimRight(string(content), "\r\n")
+	if value == "" {
+		return "", fmt.Errorf("secret file %s is empty", path)
+	}
+	return value, nil
+}
+
+// WatchSecrets re-reads the secret files every interval until ctx is done.
+// Rotated credentials are used by new connections, the pooled ones are
+// replaced as they reach the connection max lifetime.
+func (s *Storage) WatchSecrets(ctx context.Context, interval time.Duration) {
+	if s.passwordFile == "" && s.databaseURLFile == "" && s.replicaURLFile == "" {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			changed, err := s.loadSecrets()
+			if err != nil {
+				log.WithError(err).Warn("failed to refresh secrets, keeping the current credentials")
+				continue
+			}
+			if changed {
+				log.Info("database credentials rotated")
+			}
+		}
+	}
+}
+
+// postgresConnector opens every connection with the current credentials, so
+// rotated secrets apply without reopening the pool.
+type postgresConnector struct {
+	connectionString func() (string, error)
+}
+
+func (c postgresConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	connectionString, err := c.connectionString()
+	if err != nil {
+		return nil, err
+	}
+	connector, err := pq.NewConnector(connectionString)
+	if err != nil {
+		return nil, err
+	}
+	return connector.Connect(ctx)
+}
+
+func (c postgresConnector) Driver() driver.Driver {
+	return &pq.Driver{}
+}
@@ -0,0 +1,229 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/internal_types"
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/storage/postgres"
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/storage/sqlite"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+func (s *Storage) getSQLiteQueryExecutor() (*sqlite.Queries, error) {
+	dbConnection, err := s.GetDBConnection()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get db connection: %w", err)
+	}
+	return sqlite.New(s.traced(dbConnection)), nil
+}
+
+func (s *Storage) storeEventSQLite(ctx context.Context, event internal_types.Event) (uuid.UUID, error) {
+	dbConnection, err := s.GetDBConnection()
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	dbTx, err := dbConnection.BeginTx(ctx, nil)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	defer dbTx.Rollback()
+
+	// SQLite only has a single writer, so every statement, including the
+	// allergen upserts, has to run inside the transaction that holds the lock.
+	queryExecutorTx := sqlite.New(s.traced(dbTx))
+
+	newAllergens := 0
+	storeFood := func(food internal_types.EntreesAndSidesOrSaladBar, foodType postgres.DogdishFoodTypeEnum, eventID, cuisineID uuid.UUID) (uuid.UUID, error) {
+		var preference sql.NullString
+		switch food.Preference {
+		case string(postgres.DogdishPreferenceEnumVegan), string(postgres.DogdishPreferenceEnumVegetarian):
+			preference = sql.NullString{String: food.Preference, Valid: true}
+		default:
+			preference = sql.NullString{Valid: false}
+		}
+
+		foodID, err := queryExecutorTx.InsertFood(ctx, sqlite.InsertFoodParams{
+			ID:         uuid.New(),
+			CuisineID:  cuisineID,
+			EventID:    eventID,
+			Name:       food.Name,
+			FoodType:   string(foodType),
+			Preference: preference,
+		})
+		if err != nil {
+			return uuid.Nil, fmt.Errorf("failed to insert food into database: %w", err)
+		}
+
+		for _, allergen := range food.Allergens {
+			newAllergenID := uuid.New()
+			allergenID, err := queryExecutorTx.UpsertAllergen(ctx, sqlite.UpsertAllergenParams{
+				ID:   newAllergenID,
+				Name: allergen,
+			})
+			if err != nil {
+				return uuid.Nil, fmt.Errorf("failed to upsert allergen: %w", err)
+			}
+			if allergenID == newAllergenID {
+				newAllergens++
+				log.WithContext(ctx).WithFields(log.Fields{"allergen": allergen}).Info("new allergen detected, adding to database")
+			}
+
+			err = queryExecutorTx.InsertFoodAllergen(ctx, sqlite.InsertFoodAllergenParams{
+				FoodID:     foodID,
+				AllergenID: allergenID,
+			})
+			if err != nil {
+				return uuid.Nil, fmt.Errorf("failed to insert food allergen: %w", err)
+			}
+		}
+
+		return foodID, nil
+	}
+
+	newEventID, err := queryExecutorTx.InsertEvent(ctx, sqlite.InsertEventParams{
+		ID:      uuid.New(),
+		Date:    event.Weekday,
+		IsoDate: event.ISODate,
+	})
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to insert event into database: %w", err)
+	}
+
+	newCuisineID, err := queryExecutorTx.UpsertCuisine(ctx, sqlite.UpsertCuisineParams{
+		ID:   uuid.New(),
+		Name: event.Cuisine,
+	})
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to upsert cuisine: %w", err)
+	}
+
+	foods := []struct {
+		foodType postgres.DogdishFoodTypeEnum
+		items    []internal_types.EntreesAndSidesOrSaladBar
+	}{
+		{postgres.DogdishFoodTypeEnumEntreesAndSides, event.EntreesAndSides},
+		{postgres.DogdishFoodTypeEnumToppings, event.SaladBar.Toppings},
+		{postgres.DogdishFoodTypeEnumDressings, event.SaladBar.Dressings},
+	}
+	for _, group := range foods {
+		for _, food := range group.items {
+			if _, err := storeFood(food, group.foodType, newEventID, newCuisineID); err != nil {
+				return uuid.Nil, fmt.Errorf("failed to insert %s into database: %w", group.foodType, err)
+			}
+		}
+	}
+
+	if err := dbTx.Commit(); err != nil {
+		return uuid.Nil, &commitError{err: err}
+	}
+	s.publish(ChangeNotification{Op: OpStoreEvent, EventID: newEventID, ISODate: event.ISODate})
+	s.recordEventStored(event, newAllergens)
+
+	return newEventID, nil
+}
+
+func (s *Storage) getFrontPageEventsSQLite(ctx context.Context) ([]internal_types.StoredEvent, error) {
+	queryExecutor, err := s.getSQLiteQueryExecutor()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := queryExecutor.GetFrontPageEvents(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get front page events: %w", err)
+	}
+
+	events := make([]internal_types.StoredEvent, 0, len(rows))
+	for _, row := range rows {
+		event, err := decodeSQLiteEvent(row.ID, row.Date, row.IsoDate, row.UpdatedAt, row.Cuisine, row.Foods)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+func (s *Storage) getEventSQLite(ctx context.Context, eventID uuid.UUID) (internal_types.StoredEvent, error) {
+	queryExecutor, err := s.getSQLiteQueryExecutor()
+	if err != nil {
+		return internal_types.StoredEvent{}, err
+	}
+
+	row, err := queryExecutor.GetEventById(ctx, eventID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return internal_types.StoredEvent{}, ErrNotFound
+	}
+	if err != nil {
+		return internal_types.StoredEvent{}, fmt.Errorf("failed to get event by id: %w", err)
+	}
+
+	return decodeSQLiteEvent(row.ID, row.Date, row.IsoDate, row.UpdatedAt, row.Cuisine, row.Foods)
+}
+
+func (s *Storage) listEventsSQLite(ctx context.Context) ([]internal_types.StoredEvent, error) {
+	queryExecutor, err := s.getSQLiteQueryExecutor()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := queryExecutor.ListEvents(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list events: %w", err)
+	}
+
+	events := make([]internal_types.StoredEvent, 0, len(rows))
+	for _, row := range rows {
+		event, err := decodeSQLiteEvent(row.ID, row.Date, row.IsoDate, row.UpdatedAt, row.Cuisine, row.Foods)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+func (s *Storage) getEventsByDateSQLite(ctx context.Context, isoDate string) ([]internal_types.StoredEvent, error) {
+	if _, err := time.Parse(time.DateOnly, isoDate); err != nil {
+		return nil, &Error{Kind: ErrValidation, Op: "get events by date", Err: err}
+	}
+
+	queryExecutor, err := s.getSQLiteQueryExecutor()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := queryExecutor.ListEventsByDate(ctx, isoDate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list events by date: %w", err)
+	}
+
+	events := make([]internal_types.StoredEvent, 0, len(rows))
+	for _, row := range rows {
+		event, err := decodeSQLiteEvent(row.ID, row.Date, row.IsoDate, row.UpdatedAt, row.Cuisine, row.Foods)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+// decodeSQLiteEvent decodes an event row, SQLite stores updated_at as an
+// RFC 3339 string.
+func decodeSQLiteEvent(id uuid.UUID, date, isoDate, updatedAt, cuisine, foodsJSON string) (internal_types.StoredEvent, error) {
+	updated, err := time.Parse(time.RFC3339Nano, updatedAt)
+	if err != nil {
+		return internal_types.StoredEvent{}, fmt.Errorf("failed to decode updated_at for event %s: %w", id, err)
+	}
+	return decodeEvent(id, date, isoDate, updated, cuisine, []byte(foodsJSON))
+}
@@ -3,15 +3,28 @@ package storage
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	sqltrace "github.com/DataDog/dd-trace-go/contrib/database/sql/v2"
 	"github.com/Failure-Enthusiasts/cater-me-up/internal/internal_types"
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/metrics"
 	"github.com/Failure-Enthusiasts/cater-me-up/internal/storage/postgres"
 	"github.com/google/uuid"
 	"github.com/lib/pq"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+	sqlite3 "modernc.org/sqlite"
 )
 
 type DBType string
@@ -19,11 +32,13 @@ type DBType string
 const (
 	// DBTypes
 	DBTypePostgres DBType = "postgres"
+	DBTypeSQLite   DBType = "sqlite"
 
-	// Default connection options
-	DefaultMaxOpenConns    = 25
-	DefaultMaxIdleConns    = 10
-	DefaultConnMaxLifetime = 300 // 5 minutes in seconds
+	// Default connection pool options
+	DefaultMaxOpenConns    int           = 25
+	DefaultMaxIdleConns    int           = 10
+	DefaultConnMaxLifetime time.Duration = 5 * time.Minute
+	DefaultConnMaxIdleTime time.Duration = 1 * time.Minute
 
 	// Default connection string values
 	DefaultDBType   DBType = DBTypePostgres
@@ -32,8 +47,14 @@ const (
 	DefaultPassword string = "password"
 	DefaultPort     uint   = 5432
 	DefaultDatabase string = "postgres"
+
+	// Default Postgres connection options
+	DefaultSSLMode         string = "disable"
+	DefaultApplicationName string = "database_handler"
 )
 
+var sslModes = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+
 type Storage struct {
 	dbType   DBType
 	host     string
@@ -41,16 +62,76 @@ type Storage struct {
 	password string
 	port     uint
 	database string
+
+	// Postgres only connection options. A database URL replaces the host,
+	// port, user, password and database, its query parameters take precedence
+	// over the options below.
+	databaseURL      string
+	sslMode          string
+	sslRootCert      string
+	sslCert          string
+	sslKey           string
+	applicationName  string
+	statementTimeout time.Duration
+	searchPath       string
+
+	replicaURL            string
+	replicaReadAfterWrite time.Duration
+
+	// Files the password and URLs above are read from, see secrets.go. The
+	// credentials are guarded by secretsMu once the storage is open.
+	passwordFile    string
+	databaseURLFile string
+	replicaURLFile  string
+	secretsMu       sync.RWMutex
+
+	maxOpenConns    int
+	maxIdleConns    int
+	connMaxLifetime time.Duration
+	connMaxIdleTime time.Duration
+
+	maxRetries   int
+	retryBackoff time.Duration
+
+	db      *sql.DB
+	replica *sql.DB
+
+	// Guards the replica routing state
+	replicaMu        sync.Mutex
+	lastWrite        time.Time
+	replicaDownUntil time.Time
+
+	// Change notification subscribers, see Subscribe
+	subscribersMu  sync.Mutex
+	subscribers    map[int]func(ChangeNotification)
+	nextSubscriber int
+
+	metrics *metrics.Metrics
+
+	// See tracing.go
+	tracer            trace.Tracer
+	datadogSQLTracing bool
 }
 
 func NewStorage() *Storage {
 	return &Storage{
-		dbType:   DefaultDBType,
-		host:     DefaultHost,
-		user:     DefaultUser,
-		password: DefaultPassword,
-		port:     DefaultPort,
-		database: DefaultDatabase,
+		dbType:          DefaultDBType,
+		host:            DefaultHost,
+		user:            DefaultUser,
+		password:        DefaultPassword,
+		port:            DefaultPort,
+		database:        DefaultDatabase,
+		applicationName: DefaultApplicationName,
+		maxOpenConns:    DefaultMaxOpenConns,
+		maxIdleConns:    DefaultMaxIdleConns,
+		connMaxLifetime: DefaultConnMaxLifetime,
+		connMaxIdleTime: DefaultConnMaxIdleTime,
+		maxRetries:      DefaultMaxRetries,
+		retryBackoff:    DefaultRetryBackoff,
+
+		replicaReadAfterWrite: DefaultReplicaReadAfterWrite,
+		tracer:                noop.NewTracerProvider().Tracer(instrumentationName),
+		datadogSQLTracing:     true,
 	}
 }
 func (s *Storage) WithDBType(databaseType DBType) *Storage {
@@ -58,6 +139,10 @@ func (s *Storage) WithDBType(databaseType DBType) *Storage {
 	return s
 }
 
+func (s *Storage) DBType() DBType {
+	return s.dbType
+}
+
 func (s *Storage) WithHost(host string) *Storage {
 	s.host = host
 	return s
@@ -83,296 +168,530 @@ func (s *Storage) WithDatabase(database string) *Storage {
 	return s
 }
 
-func (s *Storage) validateConnectionValues() error {
-	if s.host == "" {
-		return fmt.Errorf("host cannot be empty")
-	}
-	if s.user == "" {
-		return fmt.Errorf("user cannot be empty")
-	}
-	if s.database == "" {
-		return fmt.Errorf("database cannot be empty")
-	}
-	if s.port == 0 {
-		return fmt.Errorf("port cannot be zero")
-	}
-	return nil
+// WithDatabaseURL sets a postgres:// connection URL, used instead of the host,
+// port, user, password and database.
+func (s *Storage) WithDatabaseURL(databaseURL string) *Storage {
+	s.databaseURL = databaseURL
+	return s
 }
 
-func (s *Storage) GetDBConnection() (*sql.DB, error) {
-	err := s.validateConnectionValues()
-	if err != nil {
-		return nil, err
-	}
-	connectionString, err := s.createConnectionString()
-	if err != nil {
-		return nil, err
-	}
-	sqltrace.Register("postgres", &pq.Driver{}, sqltrace.WithService("database"))
+// WithSSLMode sets the Postgres sslmode. It defaults to disable unless a
+// database URL is set, in which case the driver default applies.
+func (s *Storage) WithSSLMode(sslMode string) *Storage {
+	s.sslMode = sslMode
+	return s
+}
 
-	dbConnection, err := sqltrace.Open(string(s.dbType), connectionString)
-	if err != nil {
-		return nil, fmt.Errorf("failed to form a connection with the database: %q", err)
-	}
+func (s *Storage) WithSSLRootCert(sslRootCert string) *Storage {
+	s.sslRootCert = sslRootCert
+	return s
+}
 
-	dbConnection.SetMaxOpenConns(DefaultMaxOpenConns)
-	dbConnection.SetMaxIdleConns(DefaultMaxIdleConns)
-	dbConnection.SetConnMaxLifetime(time.Duration(DefaultConnMaxLifetime) * time.Second)
+// WithSSLCert sets the client certificate, it must be set along with
+// WithSSLKey.
+func (s *Storage) WithSSLCert(sslCert string) *Storage {
+	s.sslCert = sslCert
+	return s
+}
 
-	return dbConnection, nil
+func (s *Storage) WithSSLKey(sslKey string) *Storage {
+	s.sslKey = sslKey
+	return s
 }
 
-func (s *Storage) createConnectionString() (string, error) {
-	switch s.dbType {
-	case DBTypePostgres:
-		return fmt.Sprintf(
-			"postgres://%s:%s@%s:%d/%s?sslmode=disable",
-			s.user, s.password, s.host, s.port, s.database,
-		), nil
-	default:
-		return "", fmt.Errorf("unsupported database type: %s", s.dbType)
-	}
+func (s *Storage) WithApplicationName(applicationName string) *Storage {
+	s.applicationName = applicationName
+	return s
 }
 
-func (s *Storage) GetQueryExecutor(db *sql.DB) (*postgres.Queries, error) {
-	switch s.dbType {
-	case DBTypePostgres:
-		return postgres.New(db), nil
-	default:
-		return nil, fmt.Errorf("database type %s not supported", s.dbType)
-	}
+// WithStatementTimeout sets the Postgres statement_timeout for every
+// connection, 0 keeps the server default.
+func (s *Storage) WithStatementTimeout(statementTimeout time.Duration) *Storage {
+	s.statementTimeout = statementTimeout
+	return s
 }
 
-func (s *Storage) GetQueryExecutorWithTx(db *sql.DB, tx *sql.Tx) (*postgres.Queries, error) {
-	switch s.dbType {
-	case DBTypePostgres:
-		return postgres.New(db).WithTx(tx), nil
-	default:
-		return nil, fmt.Errorf("database type %s not supported", s.dbType)
-	}
+// WithSearchPath sets the Postgres search_path for every connection as a
+// comma separated list of schemas.
+func (s *Storage) WithSearchPath(searchPath string) *Storage {
+	s.searchPath = searchPath
+	return s
 }
 
-func (s *Storage) StoreEvent(ctx context.Context, event internal_types.Event) (uuid.UUID, error) {
-	dbConnection, err := s.GetDBConnection()
-	if err != nil {
-		return uuid.Nil, err
-	}
-	defer dbConnection.Close()
+func (s *Storage) WithMaxOpenConns(maxOpenConns int) *Storage {
+	s.maxOpenConns = maxOpenConns
+	return s
+}
 
-	dbTx, err := dbConnection.BeginTx(ctx, nil)
-	if err != nil {
-		return uuid.Nil, err
+func (s *Storage) WithMaxIdleConns(maxIdleConns int) *Storage {
+	s.maxIdleConns = maxIdleConns
+	return s
+}
+
+func (s *Storage) WithConnMaxLifetime(connMaxLifetime time.Duration) *Storage {
+	s.connMaxLifetime = connMaxLifetime
+	return s
+}
+
+func (s *Storage) WithConnMaxIdleTime(connMaxIdleTime time.Duration) *Storage {
+	s.connMaxIdleTime = connMaxIdleTime
+	return s
+}
+
+// WithMaxRetries sets how many times an operation failing with a transient
+// error is retried, 0 disables retries.
+func (s *Storage) WithMaxRetries(maxRetries int) *Storage {
+	s.maxRetries = maxRetries
+	return s
+}
+
+// WithRetryBackoff sets the wait before the first retry, it doubles on every
+// following attempt.
+func (s *Storage) WithRetryBackoff(retryBackoff time.Duration) *Storage {
+	s.retryBackoff = retryBackoff
+	return s
+}
+
+// ConfigError lists every misconfigured connection setting.
+type ConfigError struct {
+	Problems []string
+}
+
+func (e *ConfigError) Error() string {
+	return "invalid database configuration: " + strings.Join(e.Problems, "; ")
+}
+
+// Validate checks the connection settings and returns a *ConfigError listing
+// every problem found, so they can all be fixed at once.
+func (s *Storage) Validate() error {
+	var problems []string
+	invalid := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
 	}
 
-	queryExecutor, err := s.GetQueryExecutor(dbConnection)
-	if err != nil {
-		return uuid.Nil, fmt.Errorf("failed to create a query executor: %q", err)
+	current, errs := s.readSecrets()
+	for _, err := range errs {
+		invalid("%v", err)
 	}
 
-	queryExecutorTx, err := s.GetQueryExecutorWithTx(dbConnection, dbTx)
-	defer func() {
-		if err != nil {
-			fmt.Printf("\n\n\nError Found: %q\n\n\nRolling Back\n\n\n", err)
-			dbTx.Rollback()
+	switch s.dbType {
+	case DBTypeSQLite:
+		// The database is a file path, no server to connect to
+		if s.database == "" {
+			invalid("database cannot be empty")
 		}
-	}()
-
-	storeFood := func(food internal_types.EntreesAndSidesOrSaladBar, foodType postgres.DogdishFoodTypeEnum, eventID, cuisineID uuid.UUID) (uuid.UUID, error) {
-		var preference postgres.NullDogdishPreferenceEnum
-		var foodID uuid.UUID
-
-		// Handle preference
-		switch food.Preference {
-		case string(postgres.DogdishPreferenceEnumValue0):
-			preference = postgres.NullDogdishPreferenceEnum{Valid: false}
-		case string(postgres.DogdishPreferenceEnumVegan):
-			preference = postgres.NullDogdishPreferenceEnum{
-				DogdishPreferenceEnum: postgres.DogdishPreferenceEnumVegan,
-				Valid:                 true,
+		if current.replicaURL != "" {
+			invalid("replica url is only supported with %s", DBTypePostgres)
+		}
+	case DBTypePostgres:
+		validateURL := func(name, value string) {
+			if u, err := url.Parse(value); err != nil {
+				// The parse error would repeat the URL, password included
+				invalid("%s is not a valid URL", name)
+			} else if u.Scheme != "postgres" && u.Scheme != "postgresql" {
+				invalid("%s scheme %q must be postgres or postgresql", name, u.Scheme)
 			}
-		case string(postgres.DogdishPreferenceEnumVegetarian):
-			preference = postgres.NullDogdishPreferenceEnum{
-				DogdishPreferenceEnum: postgres.DogdishPreferenceEnumVegetarian,
-				Valid:                 true,
+		}
+		if current.replicaURL != "" {
+			validateURL("replica url", current.replicaURL)
+		}
+		if s.replicaReadAfterWrite < 0 {
+			invalid("replica read after write %s cannot be negative", s.replicaReadAfterWrite)
+		}
+		if current.databaseURL != "" {
+			validateURL("database url", current.databaseURL)
+		} else {
+			if s.host == "" {
+				invalid("host cannot be empty")
+			}
+			if s.user == "" {
+				invalid("user cannot be empty")
+			}
+			if s.database == "" {
+				invalid("database cannot be empty")
+			}
+			if s.port == 0 || s.port > 65535 {
+				invalid("port %d must be between 1 and 65535", s.port)
 			}
-		default:
-			preference = postgres.NullDogdishPreferenceEnum{Valid: false}
 		}
-
-		// Create food
-		foodID, err := queryExecutorTx.InsertFood(ctx, postgres.InsertFoodParams{
-			CuisineID:  cuisineID,
-			EventID:    eventID,
-			Name:       food.Name,
-			FoodType:   foodType,
-			Preference: preference,
-		})
-		if err != nil {
-			return uuid.Nil, fmt.Errorf("failed to insert food into database: %q", err)
+		if s.sslMode != "" && !slices.Contains(sslModes, s.sslMode) {
+			invalid("sslmode %q must be one of %s", s.sslMode, strings.Join(sslModes, ", "))
 		}
-
-		// Handle entree and sides allergens
-		for _, allergen := range food.Allergens {
-			// Check to see if the allergen already exist
-			allergenID, err := queryExecutor.GetAllergenByName(ctx, allergen)
-
-			// Allergen doesn't exist, add it to the database
-			if err != nil {
-				fmt.Printf("New Allergen detected: %q, adding to database\n", allergen)
-				allergenID, err = queryExecutor.InsertAllergen(ctx, allergen)
-				if err != nil {
-					return uuid.Nil, fmt.Errorf("failed to insert allergen: %q", err)
-				}
+		if (s.sslCert == "") != (s.sslKey == "") {
+			invalid("sslcert and sslkey must be set together")
+		}
+		for name, file := range map[string]string{"sslrootcert": s.sslRootCert, "sslcert": s.sslCert, "sslkey": s.sslKey} {
+			if file == "" {
+				continue
 			}
-
-			// Create the food allergen join table
-			_, err = queryExecutorTx.InsertFoodAllergen(ctx, postgres.InsertFoodAllergenParams{
-				FoodID:     foodID,
-				AllergenID: allergenID,
-			})
-			if err != nil {
-				return uuid.Nil, fmt.Errorf("failed to insert food allergen: %q", err.Error())
+			if _, err := os.Stat(file); err != nil {
+				invalid("%s %s cannot be read: %v", name, file, errors.Unwrap(err))
 			}
 		}
+		if s.statementTimeout < 0 {
+			invalid("statement timeout %s cannot be negative", s.statementTimeout)
+		}
+		for _, schema := range strings.Split(s.searchPath, ",") {
+			if s.searchPath != "" && strings.TrimSpace(schema) == "" {
+				invalid("search path %q contains an empty schema", s.searchPath)
+				break
+			}
+		}
+	default:
+		invalid("database type %q must be %s or %s", s.dbType, DBTypePostgres, DBTypeSQLite)
+	}
+
+	if s.maxOpenConns < 0 {
+		invalid("max open connections %d cannot be negative", s.maxOpenConns)
+	}
+	if s.maxIdleConns < 0 {
+		invalid("max idle connections %d cannot be negative", s.maxIdleConns)
+	}
+	if s.maxOpenConns > 0 && s.maxIdleConns > s.maxOpenConns {
+		invalid("max idle connections %d cannot exceed max open connections %d", s.maxIdleConns, s.maxOpenConns)
+	}
 
-		return foodID, nil
+	if len(problems) != 0 {
+		// Map iteration makes the certificate problems come in any order
+		slices.Sort(problems)
+		return &ConfigError{Problems: problems}
 	}
+	return nil
+}
 
-	// Ignoring error since this was already validated in validateEvent
-	isoDate, _ := time.Parse(time.DateOnly, event.ISODate)
+var registerDriversOnce sync.Once
 
-	// Create Event
-	newEventID, err := queryExecutorTx.InsertEvent(ctx, postgres.InsertEventParams{
-		Date:    event.Weekday,
-		IsoDate: isoDate,
+func registerDrivers() {
+	registerDriversOnce.Do(func() {
+		sqltrace.Register(string(DBTypePostgres), &pq.Driver{}, sqltrace.WithService("database"))
+		sqltrace.Register(string(DBTypeSQLite), &sqlite3.Driver{}, sqltrace.WithService("database"))
 	})
-	if err != nil {
-		return uuid.Nil, fmt.Errorf("failed to insert event into database: %q", err)
-	}
+}
 
-	// Create Cuisine
-	newCuisineID, err := queryExecutorTx.InsertCuisine(ctx, event.Cuisine)
+// Open creates the connection pool shared by every Storage method. It must be
+// called once at startup, before any other method, and paired with Close on
+// shutdown.
+func (s *Storage) Open() error {
+	if s.db != nil {
+		return fmt.Errorf("storage is already open")
+	}
+	err := s.Validate()
 	if err != nil {
-		return uuid.Nil, fmt.Errorf("failed to insert cuisine into database: %q", err)
+		return err
 	}
-
-	// Store Entree
-	for _, entree := range event.EntreesAndSides {
-		fmt.Printf("inserting entree: %+v\n", entree)
-		_, err := storeFood(entree, postgres.DogdishFoodTypeEnumEntreesAndSides, newEventID, newCuisineID)
-		if err != nil {
-			return uuid.Nil, fmt.Errorf("failed to insert entree into database: %q", err)
-		}
+	if _, err := s.loadSecrets(); err != nil {
+		return err
 	}
+	registerDrivers()
 
-	// Store salad bar toppings
-	for _, toppings := range event.SaladBar.Toppings {
-		fmt.Printf("inserting topping: %+v\n", toppings)
-		_, err := storeFood(toppings, postgres.DogdishFoodTypeEnumToppings, newEventID, newCuisineID)
-		if err != nil {
-			return uuid.Nil, fmt.Errorf("failed to insert topping into database: %q", err)
-		}
+	dbConnection, err := s.openPool(s.createConnectionString)
+	if err != nil {
+		return fmt.Errorf("failed to form a connection with the database: %w", err)
 	}
+	s.db = dbConnection
 
-	// Store salad bar dressings
-	for _, dressings := range event.SaladBar.Dressings {
-		fmt.Printf("inserting dressing: %+v\n", dressings)
-		_, err := storeFood(dressings, postgres.DogdishFoodTypeEnumDressings, newEventID, newCuisineID)
+	if s.currentSecrets().replicaURL != "" {
+		// Opening a pool does not connect, an unreachable replica only shows
+		// up on the first read, which then falls back to the primary
+		replicaConnection, err := s.openPool(func() (string, error) {
+			return s.postgresURL(s.currentSecrets().replicaURL)
+		})
 		if err != nil {
-			return uuid.Nil, fmt.Errorf("failed to insert dressing into database: %q", err)
+			s.Close()
+			return fmt.Errorf("failed to form a connection with the replica: %w", err)
 		}
+		s.replica = replicaConnection
 	}
 
-	if err := dbTx.Commit(); err != nil {
-		return uuid.Nil, fmt.Errorf("failed to commit transaction: %q", err)
-	}
+	log.WithFields(log.Fields{
+		"max_open_conns":     s.maxOpenConns,
+		"max_idle_conns":     s.maxIdleConns,
+		"conn_max_lifetime":  s.connMaxLifetime.String(),
+		"conn_max_idle_time": s.connMaxIdleTime.String(),
+		"replica":            s.replica != nil,
+	}).Info("database connection pool opened")
 
-	return newEventID, nil
+	return nil
 }
 
-func (s *Storage) GetFrontPageEventIDs(ctx context.Context) ([]postgres.DogdishEvent, error) {
-	dbConnection, err := s.GetDBConnection()
+// openPool opens a connection pool with the storage's pool limits. Postgres
+// connections are opened with the connection string at the time they are
+// made, so rotated secrets apply.
+func (s *Storage) openPool(connectionString func() (string, error)) (*sql.DB, error) {
+	initial, err := connectionString()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get db connection: %q", err)
+		return nil, err
 	}
-	defer dbConnection.Close()
-
-	queryExecutor, err := s.GetQueryExecutor(dbConnection)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create a query executor: %q", err)
+	var dbConnection *sql.DB
+	switch {
+	case s.dbType == DBTypePostgres && s.datadogSQLTracing:
+		dbConnection = sqltrace.OpenDB(postgresConnector{connectionString: connectionString}, sqltrace.WithDSN(initial))
+	case s.dbType == DBTypePostgres:
+		dbConnection = sql.OpenDB(postgresConnector{connectionString: connectionString})
+	case s.datadogSQLTracing:
+		dbConnection, err = sqltrace.Open(string(s.dbType), initial)
+	default:
+		dbConnection, err = sql.Open(string(s.dbType), initial)
 	}
-
-	events := make([]postgres.DogdishEvent, 0)
-
-	previousEvent, err := queryExecutor.GetPreviousEvent(ctx)
 	if err != nil {
-		log.Info("no previous event found")
-	} else {
-		events = append(events, previousEvent)
+		return nil, err
 	}
+	dbConnection.SetMaxOpenConns(s.maxOpenConns)
+	dbConnection.SetMaxIdleConns(s.maxIdleConns)
+	dbConnection.SetConnMaxLifetime(s.connMaxLifetime)
+	dbConnection.SetConnMaxIdleTime(s.connMaxIdleTime)
+	return dbConnection, nil
+}
 
-	currentEvent, err := queryExecutor.GetCurrentEvent(ctx)
-	if err != nil {
-		log.Info("no current event found")
-	} else {
-		events = append(events, currentEvent)
+// Close closes the connection pools, waiting for in use connections to be
+// returned.
+func (s *Storage) Close() error {
+	var errs []error
+	if s.replica != nil {
+		errs = append(errs, s.replica.Close())
+		s.replica = nil
 	}
-
-	var futureEventsNeeded int32
-	if len(events) != 0 {
-		futureEventsNeeded = 2
-	} else {
-		futureEventsNeeded = 1
+	if s.db != nil {
+		errs = append(errs, s.db.Close())
+		s.db = nil
 	}
-	log.WithFields(log.Fields{"future_events_needed": futureEventsNeeded}).Info("future events needed")
+	return errors.Join(errs...)
+}
 
-	futureEvents, err := queryExecutor.GetFutureEvents(ctx, futureEventsNeeded)
-	if err != nil {
-		log.Info("no future events found")
-	} else {
-		events = append(events, futureEvents...)
+// Stats returns the connection pool statistics.
+func (s *Storage) Stats() sql.DBStats {
+	if s.db == nil {
+		return sql.DBStats{}
 	}
-	log.WithFields(log.Fields{"events": events}).Info("events found")
-
-	return events, nil
+	return s.db.Stats()
 }
 
-func (s *Storage) GetFoodsByEventId(ctx context.Context, eventID uuid.UUID) ([]postgres.GetFoodsByEventIdRow, error) {
+// Ping checks the primary can be reached.
+func (s *Storage) Ping(ctx context.Context) error {
 	dbConnection, err := s.GetDBConnection()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get db connection: %q", err)
+		return err
 	}
-	defer dbConnection.Close()
+	return classify("ping", dbConnection.PingContext(ctx))
+}
 
-	queryExecutor, err := s.GetQueryExecutor(dbConnection)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create a query executor: %q", err)
+// GetDBConnection returns the shared connection pool. Callers must not close
+// it.
+func (s *Storage) GetDBConnection() (*sql.DB, error) {
+	if s.db == nil {
+		return nil, fmt.Errorf("storage is not open")
 	}
+	return s.db, nil
+}
 
-	foodsByEventIdRow, err := queryExecutor.GetFoodsByEventId(ctx, eventID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get foods by event id: %q", err)
+func (s *Storage) createConnectionString() (string, error) {
+	switch s.dbType {
+	case DBTypePostgres:
+		return s.postgresURL(s.currentSecrets().databaseURL)
+	case DBTypeSQLite:
+		// Foreign keys are off by default in SQLite. WAL lets readers run
+		// alongside the writer, and immediate transactions take the write lock
+		// up front so concurrent writers wait on busy_timeout instead of failing
+		// when they upgrade a read lock.
+		return fmt.Sprintf(
+			"file:%s?_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_txlock=immediate",
+			s.database,
+		), nil
+	default:
+		return "", fmt.Errorf("unsupported database type: %s", s.dbType)
 	}
+}
 
-	return foodsByEventIdRow, nil
+// postgresURL builds the lib/pq connection URL from databaseURL, or from the
+// host, port, user, password and database when it is empty. Options that are
+// not connection settings, like statement_timeout and search_path, are sent by
+// the driver as run-time parameters when the connection starts.
+func (s *Storage) postgresURL(databaseURL string) (string, error) {
+	u := &url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(s.user, s.currentSecrets().password),
+		Host:   net.JoinHostPort(s.host, strconv.FormatUint(uint64(s.port), 10)),
+		Path:   "/" + s.database,
+	}
+	sslMode := s.sslMode
+	if databaseURL != "" {
+		var err error
+		if u, err = url.Parse(databaseURL); err != nil {
+			return "", fmt.Errorf("database url is not a valid URL")
+		}
+	} else if sslMode == "" {
+		sslMode = DefaultSSLMode
+	}
+
+	query := u.Query()
+	for name, value := range map[string]string{
+		"sslmode":          sslMode,
+		"sslrootcert":      s.sslRootCert,
+		"sslcert":          s.sslCert,
+		"sslkey":           s.sslKey,
+		"application_name": s.applicationName,
+		"search_path":      s.searchPath,
+	} {
+		if value != "" && !query.Has(name) {
+			query.Set(name, value)
+		}
+	}
+	if s.statementTimeout > 0 && !query.Has("statement_timeout") {
+		query.Set("statement_timeout", strconv.FormatInt(s.statementTimeout.Milliseconds(), 10))
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
 }
 
-func (s *Storage) GetCuisineById(ctx context.Context, cuisineId uuid.UUID) (postgres.DogdishCuisine, error) {
-	dbConnection, err := s.GetDBConnection()
-	if err != nil {
-		return postgres.DogdishCuisine{}, fmt.Errorf("failed to get db connection: %q", err)
+func (s *Storage) GetQueryExecutor(db *sql.DB) (*postgres.Queries, error) {
+	switch s.dbType {
+	case DBTypePostgres:
+		return postgres.New(s.traced(db)), nil
+	default:
+		return nil, fmt.Errorf("database type %s not supported", s.dbType)
 	}
-	defer dbConnection.Close()
+}
 
-	queryExecutor, err := s.GetQueryExecutor(dbConnection)
-	if err != nil {
-		return postgres.DogdishCuisine{}, fmt.Errorf("failed to create a query executor: %q", err)
+func (s *Storage) GetQueryExecutorWithTx(db *sql.DB, tx *sql.Tx) (*postgres.Queries, error) {
+	switch s.dbType {
+	case DBTypePostgres:
+		return postgres.New(s.traced(tx)), nil
+	default:
+		return nil, fmt.Errorf("database type %s not supported", s.dbType)
 	}
+}
 
-	cuisine, err := queryExecutor.GetCuisineById(ctx, cuisineId)
-	if err != nil {
-		return postgres.DogdishCuisine{}, fmt.Errorf("failed to get cuisine by id: %q", err)
+// StoreEvent stores the event along with its cuisine, foods and allergens in
+// a single transaction and returns the new event's ID. The transaction is
+// retried as a whole when it fails with a transient error before COMMIT is
+// sent. A failed COMMIT is returned as is, since the event may be stored.
+func (s *Storage) StoreEvent(ctx context.Context, event internal_types.Event) (uuid.UUID, error) {
+	return retry(ctx, s, "store event", func(ctx context.Context) (uuid.UUID, error) {
+		switch s.dbType {
+		case DBTypePostgres:
+			return s.storeEventPostgres(ctx, event)
+		case DBTypeSQLite:
+			return s.storeEventSQLite(ctx, event)
+		default:
+			return uuid.Nil, fmt.Errorf("database type %s not supported", s.dbType)
+		}
+	})
+}
+
+// GetFrontPageEvents returns the previous, current and upcoming events along
+// with their cuisine and foods using a single query.
+func (s *Storage) GetFrontPageEvents(ctx context.Context) ([]internal_types.StoredEvent, error) {
+	return retry(ctx, s, "get front page events", func(ctx context.Context) ([]internal_types.StoredEvent, error) {
+		switch s.dbType {
+		case DBTypePostgres:
+			return readFrom(ctx, s, func(db *sql.DB) ([]internal_types.StoredEvent, error) {
+				return s.getFrontPageEventsPostgres(ctx, db)
+			})
+		case DBTypeSQLite:
+			return s.getFrontPageEventsSQLite(ctx)
+		default:
+			return nil, fmt.Errorf("database type %s not supported", s.dbType)
+		}
+	})
+}
+
+func (s *Storage) GetEvent(ctx context.Context, eventID uuid.UUID) (internal_types.StoredEvent, error) {
+	return retry(ctx, s, "get event", func(ctx context.Context) (internal_types.StoredEvent, error) {
+		switch s.dbType {
+		case DBTypePostgres:
+			return readFrom(ctx, s, func(db *sql.DB) (internal_types.StoredEvent, error) {
+				return s.getEventPostgres(ctx, db, eventID)
+			})
+		case DBTypeSQLite:
+			return s.getEventSQLite(ctx, eventID)
+		default:
+			return internal_types.StoredEvent{}, fmt.Errorf("database type %s not supported", s.dbType)
+		}
+	})
+}
+
+func (s *Storage) ListEvents(ctx context.Context) ([]internal_types.StoredEvent, error) {
+	return retry(ctx, s, "list events", func(ctx context.Context) ([]internal_types.StoredEvent, error) {
+		switch s.dbType {
+		case DBTypePostgres:
+			return readFrom(ctx, s, func(db *sql.DB) ([]internal_types.StoredEvent, error) {
+				return s.listEventsPostgres(ctx, db)
+			})
+		case DBTypeSQLite:
+			return s.listEventsSQLite(ctx)
+		default:
+			return nil, fmt.Errorf("database type %s not supported", s.dbType)
+		}
+	})
+}
+
+func (s *Storage) GetEventsByDate(ctx context.Context, isoDate string) ([]internal_types.StoredEvent, error) {
+	return retry(ctx, s, "get events by date", func(ctx context.Context) ([]internal_types.StoredEvent, error) {
+		switch s.dbType {
+		case DBTypePostgres:
+			return readFrom(ctx, s, func(db *sql.DB) ([]internal_types.StoredEvent, error) {
+				return s.getEventsByDatePostgres(ctx, db, isoDate)
+			})
+		case DBTypeSQLite:
+			return s.getEventsByDateSQLite(ctx, isoDate)
+		default:
+			return nil, fmt.Errorf("database type %s not supported", s.dbType)
+		}
+	})
+}
+
+type eventFood struct {
+	Name       string                       `json:"name"`
+	FoodType   postgres.DogdishFoodTypeEnum `json:"food_type"`
+	Preference string                       `json:"preference"`
+	Allergens  []string                     `json:"allergens"`
+}
+
+// decodeEvent builds a stored event from an event row and its foods, which
+// are aggregated into a JSON array by the database.
+func decodeEvent(id uuid.UUID, date, isoDate string, updatedAt time.Time, cuisine string, foodsJSON []byte) (internal_types.StoredEvent, error) {
+	var foods []eventFood
+	if err := json.Unmarshal(foodsJSON, &foods); err != nil {
+		return internal_types.StoredEvent{}, fmt.Errorf("failed to decode foods for event %s: %w", id, err)
+	}
+
+	event := internal_types.StoredEvent{
+		ID:        id,
+		UpdatedAt: updatedAt,
+		Event: internal_types.Event{
+			Weekday:         date,
+			ISODate:         isoDate,
+			Cuisine:         cuisine,
+			EntreesAndSides: []internal_types.EntreesAndSidesOrSaladBar{},
+			SaladBar: internal_types.SaladBar{
+				Toppings:  []internal_types.EntreesAndSidesOrSaladBar{},
+				Dressings: []internal_types.EntreesAndSidesOrSaladBar{},
+			},
+		},
+	}
+
+	for _, food := range foods {
+		item := internal_types.EntreesAndSidesOrSaladBar{
+			Name:       food.Name,
+			Allergens:  food.Allergens,
+			Preference: food.Preference,
+		}
+		if item.Allergens == nil {
+			item.Allergens = []string{}
+		}
+
+		switch food.FoodType {
+		case postgres.DogdishFoodTypeEnumEntreesAndSides:
+			event.EntreesAndSides = append(event.EntreesAndSides, item)
+		case postgres.DogdishFoodTypeEnumToppings:
+			event.SaladBar.Toppings = append(event.SaladBar.Toppings, item)
+		case postgres.DogdishFoodTypeEnumDressings:
+			event.SaladBar.Dressings = append(event.SaladBar.Dressings, item)
+		default:
+			log.WithFields(log.Fields{"food_type": food.FoodType}).Info("Unknown food type")
+		}
 	}
 
-	return cuisine, nil
+	return event, nil
 }
@@ -0,0 +1,403 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/internal_types"
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/migrations"
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/storage"
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/storage/memory"
+	"github.com/google/uuid"
+)
+
+// The same suite runs against every Repository implementation. The Postgres
+// run needs an empty, migrated database and is skipped unless DH_TEST_DB_HOST
+// is set; the connection is configured with DH_TEST_DB_PORT, DH_TEST_DB_USER,
+// DH_TEST_DB_PASS and DH_TEST_DB_NAME.
+
+func TestMemoryRepository(t *testing.T) {
+	runRepositoryTests(t, func(t *testing.T) storage.Repository {
+		return memory.NewStorage()
+	})
+}
+
+func TestSQLiteRepository(t *testing.T) {
+	runRepositoryTests(t, openSQLite)
+}
+
+func TestPostgresRepository(t *testing.T) {
+	host := os.Getenv("DH_TEST_DB_HOST")
+	if host == "" {
+		t.Skip("DH_TEST_DB_HOST not set")
+	}
+
+	runRepositoryTests(t, func(t *testing.T) storage.Repository {
+		return openPostgres(t, host)
+	})
+}
+
+func openPostgres(t testing.TB, host string) *storage.Storage {
+	t.Helper()
+
+	s := storage.NewStorage().
+		WithHost(host).
+		WithUser(getEnvOrDefault("DH_TEST_DB_USER", storage.DefaultUser)).
+		WithPassword(getEnvOrDefault("DH_TEST_DB_PASS", storage.DefaultPassword)).
+		WithDatabase(getEnvOrDefault("DH_TEST_DB_NAME", storage.DefaultDatabase))
+	if port, err := strconv.Atoi(os.Getenv("DH_TEST_DB_PORT")); err == nil {
+		s = s.WithPort(uint(port))
+	}
+	if err := s.Open(); err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+	t.Cleanup(func() {
+		db, _ := s.GetDBConnection()
+		db.Exec("TRUNCATE dogdish.event, dogdish.cuisine, dogdish.allergen CASCADE")
+		s.Close()
+	})
+	return s
+}
+
+func getEnvOrDefault(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func openSQLite(t *testing.T) storage.Repository {
+	t.Helper()
+
+	s := storage.NewStorage().
+		WithDBType(storage.DBTypeSQLite).
+		WithDatabase(filepath.Join(t.TempDir(), "dogdish.db"))
+	if err := s.Open(); err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	db, _ := s.GetDBConnection()
+	if _, err := migrations.Up(context.Background(), db, storage.DBTypeSQLite); err != nil {
+		t.Fatalf("failed to apply migrations: %v", err)
+	}
+	return s
+}
+
+func food(name, preference string, allergens ...string) internal_types.EntreesAndSidesOrSaladBar {
+	if allergens == nil {
+		allergens = []string{}
+	}
+	return internal_types.EntreesAndSidesOrSaladBar{
+		Name:       name,
+		Allergens:  allergens,
+		Preference: preference,
+	}
+}
+
+func newEvent(date time.Time) internal_types.Event {
+	return internal_types.Event{
+		Weekday: date.Weekday().String(),
+		ISODate: date.Format(time.DateOnly),
+		Cuisine: "Italian",
+		EntreesAndSides: []internal_types.EntreesAndSidesOrSaladBar{
+			food("Spaghetti Carbonara", "vegetarian", "gluten", "dairy", "eggs"),
+			food("Bruschetta", "vegan"),
+		},
+		SaladBar: internal_types.SaladBar{
+			Toppings:  []internal_types.EntreesAndSidesOrSaladBar{food("Croutons", "vegetarian", "gluten")},
+			Dressings: []internal_types.EntreesAndSidesOrSaladBar{food("Balsamic Vinaigrette", "vegan")},
+		},
+	}
+}
+
+func runRepositoryTests(t *testing.T, newRepository func(t *testing.T) storage.Repository) {
+	ctx := context.Background()
+
+	t.Run("store and get event", func(t *testing.T) {
+		repository := newRepository(t)
+
+		event := newEvent(time.Date(2025, 8, 29, 0, 0, 0, 0, time.Local))
+		eventID, err := repository.StoreEvent(ctx, event)
+		if err != nil {
+			t.Fatalf("failed to store event: %v", err)
+		}
+
+		stored, err := repository.GetEvent(ctx, eventID)
+		if err != nil {
+			t.Fatalf("failed to get event: %v", err)
+		}
+		if stored.ID != eventID || stored.ISODate != "2025-08-29" || stored.Weekday != "Friday" || stored.Cuisine != "Italian" {
+			t.Errorf("unexpected event %+v", stored)
+		}
+		// The database clock may be a little off
+		if since := time.Since(stored.UpdatedAt); since < -time.Minute || since > time.Minute {
+			t.Errorf("expected updated_at to be the time the event was stored, got %s", stored.UpdatedAt)
+		}
+
+		// Foods and allergens come back sorted by name
+		expectedEntrees := []internal_types.EntreesAndSidesOrSaladBar{
+			food("Bruschetta", "vegan"),
+			food("Spaghetti Carbonara", "vegetarian", "dairy", "eggs", "gluten"),
+		}
+		if len(stored.EntreesAndSides) != len(expectedEntrees) {
+			t.Fatalf("expected %d entrees, got %+v", len(expectedEntrees), stored.EntreesAndSides)
+		}
+		for ix, expected := range expectedEntrees {
+			got := stored.EntreesAndSides[ix]
+			if got.Name != expected.Name || got.Preference != expected.Preference || !equal(got.Allergens, expected.Allergens) {
+				t.Errorf("entree %d: expected %+v, got %+v", ix, expected, got)
+			}
+		}
+		if got := stored.EntreesAndSides[0].Allergens; got == nil {
+			t.Errorf("expected an empty, non nil allergen list for Bruschetta")
+		}
+		if len(stored.SaladBar.Toppings) != 1 || stored.SaladBar.Toppings[0].Name != "Croutons" {
+			t.Errorf("unexpected toppings %+v", stored.SaladBar.Toppings)
+		}
+		if len(stored.SaladBar.Dressings) != 1 || len(stored.SaladBar.Dressings[0].Allergens) != 0 {
+			t.Errorf("unexpected dressings %+v", stored.SaladBar.Dressings)
+		}
+	})
+
+	t.Run("get missing event", func(t *testing.T) {
+		repository := newRepository(t)
+
+		_, err := repository.GetEvent(ctx, uuid.New())
+		if !errors.Is(err, storage.ErrNotFound) {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("allergen and cuisine names are merged", func(t *testing.T) {
+		repository := newRepository(t)
+
+		if _, err := repository.StoreEvent(ctx, newEvent(time.Date(2025, 8, 29, 0, 0, 0, 0, time.Local))); err != nil {
+			t.Fatalf("failed to store event: %v", err)
+		}
+		event := newEvent(time.Date(2025, 9, 1, 0, 0, 0, 0, time.Local))
+		event.Cuisine = " italian "
+		event.EntreesAndSides = []internal_types.EntreesAndSidesOrSaladBar{food("Lasagna", "", "Gluten ", "DAIRY")}
+		eventID, err := repository.StoreEvent(ctx, event)
+		if err != nil {
+			t.Fatalf("failed to store event: %v", err)
+		}
+
+		stored, err := repository.GetEvent(ctx, eventID)
+		if err != nil {
+			t.Fatalf("failed to get event: %v", err)
+		}
+		if stored.Cuisine != "Italian" {
+			t.Errorf("expected the existing cuisine Italian, got %q", stored.Cuisine)
+		}
+		if got := stored.EntreesAndSides[0].Allergens; !equal(got, []string{"dairy", "gluten"}) {
+			t.Errorf("expected the existing allergens [dairy gluten], got %v", got)
+		}
+	})
+
+	t.Run("list events", func(t *testing.T) {
+		repository := newRepository(t)
+
+		for _, date := range []time.Time{
+			time.Date(2025, 9, 3, 0, 0, 0, 0, time.Local),
+			time.Date(2025, 8, 29, 0, 0, 0, 0, time.Local),
+			time.Date(2025, 9, 1, 0, 0, 0, 0, time.Local),
+		} {
+			if _, err := repository.StoreEvent(ctx, newEvent(date)); err != nil {
+				t.Fatalf("failed to store event: %v", err)
+			}
+		}
+
+		events, err := repository.ListEvents(ctx)
+		if err != nil {
+			t.Fatalf("failed to list events: %v", err)
+		}
+		var dates []string
+		for _, event := range events {
+			dates = append(dates, event.ISODate)
+		}
+		if !equal(dates, []string{"2025-08-29", "2025-09-01", "2025-09-03"}) {
+			t.Errorf("expected events ordered by date, got %v", dates)
+		}
+	})
+
+	t.Run("get events by date", func(t *testing.T) {
+		repository := newRepository(t)
+
+		for _, date := range []time.Time{
+			time.Date(2025, 8, 29, 0, 0, 0, 0, time.Local),
+			time.Date(2025, 9, 1, 0, 0, 0, 0, time.Local),
+		} {
+			if _, err := repository.StoreEvent(ctx, newEvent(date)); err != nil {
+				t.Fatalf("failed to store event: %v", err)
+			}
+		}
+
+		events, err := repository.GetEventsByDate(ctx, "2025-09-01")
+		if err != nil {
+			t.Fatalf("failed to get events by date: %v", err)
+		}
+		if len(events) != 1 || events[0].ISODate != "2025-09-01" || len(events[0].EntreesAndSides) != 2 {
+			t.Errorf("expected the 2025-09-01 event, got %+v", events)
+		}
+
+		events, err = repository.GetEventsByDate(ctx, "2025-09-02")
+		if err != nil || events == nil || len(events) != 0 {
+			t.Errorf("expected an empty, non nil list, got %#v (%v)", events, err)
+		}
+
+		if _, err := repository.GetEventsByDate(ctx, "01/09/2025"); !errors.Is(err, storage.ErrValidation) {
+			t.Errorf("expected ErrValidation for a malformed date, got %v", err)
+		}
+	})
+
+	t.Run("front page events", func(t *testing.T) {
+		repository := newRepository(t)
+
+		today := time.Now()
+		day := func(offset int) time.Time { return today.AddDate(0, 0, offset) }
+		for _, date := range []time.Time{day(-2), day(-1), day(0), day(1), day(2), day(5)} {
+			if _, err := repository.StoreEvent(ctx, newEvent(date)); err != nil {
+				t.Fatalf("failed to store event: %v", err)
+			}
+		}
+
+		events, err := repository.GetFrontPageEvents(ctx)
+		if err != nil {
+			t.Fatalf("failed to get front page events: %v", err)
+		}
+		var dates []string
+		for _, event := range events {
+			dates = append(dates, event.ISODate)
+		}
+		expected := []string{
+			day(-1).Format(time.DateOnly),
+			day(0).Format(time.DateOnly),
+			day(1).Format(time.DateOnly),
+			day(2).Format(time.DateOnly),
+		}
+		if !equal(dates, expected) {
+			t.Errorf("expected front page dates %v, got %v", expected, dates)
+		}
+	})
+
+	t.Run("front page without past events", func(t *testing.T) {
+		repository := newRepository(t)
+
+		for _, offset := range []int{3, 4} {
+			if _, err := repository.StoreEvent(ctx, newEvent(time.Now().AddDate(0, 0, offset))); err != nil {
+				t.Fatalf("failed to store event: %v", err)
+			}
+		}
+
+		events, err := repository.GetFrontPageEvents(ctx)
+		if err != nil {
+			t.Fatalf("failed to get front page events: %v", err)
+		}
+		if len(events) != 1 || events[0].ISODate != time.Now().AddDate(0, 0, 3).Format(time.DateOnly) {
+			t.Errorf("expected only the next event, got %+v", events)
+		}
+	})
+
+	t.Run("front page skips events without food", func(t *testing.T) {
+		repository := newRepository(t)
+
+		event := newEvent(time.Now().AddDate(0, 0, 1))
+		event.EntreesAndSides = nil
+		event.SaladBar = internal_types.SaladBar{}
+		if _, err := repository.StoreEvent(ctx, event); err != nil {
+			t.Fatalf("failed to store event: %v", err)
+		}
+
+		events, err := repository.GetFrontPageEvents(ctx)
+		if err != nil {
+			t.Fatalf("failed to get front page events: %v", err)
+		}
+		if len(events) != 0 {
+			t.Errorf("expected no front page events, got %+v", events)
+		}
+	})
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for ix := range a {
+		if a[ix] != b[ix] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSQLiteStoreEventNotifies(t *testing.T) {
+	s := openSQLite(t).(*storage.Storage)
+
+	notifications := make(chan storage.ChangeNotification, 1)
+	s.Subscribe(func(notification storage.ChangeNotification) { notifications <- notification })
+
+	event := newEvent(time.Now())
+	eventID, err := s.StoreEvent(context.Background(), event)
+	if err != nil {
+		t.Fatalf("failed to store event: %v", err)
+	}
+
+	select {
+	case notification := <-notifications:
+		expected := storage.ChangeNotification{Op: storage.OpStoreEvent, EventID: eventID, ISODate: event.ISODate}
+		if notification != expected {
+			t.Errorf("expected %+v, got %+v", expected, notification)
+		}
+	default:
+		t.Fatalf("expected a change notification after the commit")
+	}
+}
+
+func TestPostgresStoreEventNotifies(t *testing.T) {
+	host := os.Getenv("DH_TEST_DB_HOST")
+	if host == "" {
+		t.Skip("DH_TEST_DB_HOST not set")
+	}
+
+	// The write is made by another instance, so it can only arrive through
+	// LISTEN
+	listening, writing := openPostgres(t, host), openPostgres(t, host)
+
+	notifications := make(chan storage.ChangeNotification, 8)
+	listening.Subscribe(func(notification storage.ChangeNotification) { notifications <- notification })
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- listening.Listen(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("failed to listen: %v", err)
+		}
+	})
+
+	// The LISTEN is issued in the background, so keep writing until a
+	// notification arrives
+	deadline := time.After(10 * time.Second)
+	for {
+		eventID, err := writing.StoreEvent(context.Background(), newEvent(time.Now()))
+		if err != nil {
+			t.Fatalf("failed to store event: %v", err)
+		}
+		select {
+		case notification := <-notifications:
+			if notification.Op != storage.OpStoreEvent || notification.EventID == uuid.Nil {
+				t.Errorf("unexpected notification %+v for event %s", notification, eventID)
+			}
+			return
+		case <-time.After(200 * time.Millisecond):
+		case <-deadline:
+			t.Fatalf("no change notification received")
+		}
+	}
+}
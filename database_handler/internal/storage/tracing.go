@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/Failure-Enthusiasts/cater-me-up/internal/storage"
+
+// WithTracerProvider creates a span for every storage call and every query
+// it runs. Datadog traces the SQL driver instead, see WithDatadogSQLTracing.
+func (s *Storage) WithTracerProvider(provider trace.TracerProvider) *Storage {
+	s.tracer = provider.Tracer(instrumentationName)
+	return s
+}
+
+// WithDatadogSQLTracing opens the pools through the Datadog SQL driver
+// wrapper, on by default.
+func (s *Storage) WithDatadogSQLTracing(enabled bool) *Storage {
+	s.datadogSQLTracing = enabled
+	return s
+}
+
+// dbtx is the DBTX interface of the sqlc generated packages.
+type dbtx interface {
+	ExecContext(context.Context, string, ...interface{}) (sql.Result, error)
+	PrepareContext(context.Context, string) (*sql.Stmt, error)
+	QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error)
+	QueryRowContext(context.Context, string, ...interface{}) *sql.Row
+}
+
+// traced wraps a pool or transaction so every query gets a span named after
+// its sqlc query.
+func (s *Storage) traced(db dbtx) dbtx {
+	return tracedDBTX{db: db, tracer: s.tracer, system: s.dbSystem()}
+}
+
+func (s *Storage) dbSystem() string {
+	if s.dbType == DBTypePostgres {
+		return "postgresql"
+	}
+	return string(s.dbType)
+}
+
+type tracedDBTX struct {
+	db     dbtx
+	tracer trace.Tracer
+	system string
+}
+
+// start starts a query span. Rows are read after the span ends, so it only
+// covers running the query.
+func (t tracedDBTX) start(ctx context.Context, query string) (context.Context, trace.Span) {
+	return t.tracer.Start(ctx, queryName(query),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", t.system),
+			attribute.String("db.query.text", query),
+		),
+	)
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func (t tracedDBTX) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := t.start(ctx, query)
+	result, err := t.db.ExecContext(ctx, query, args...)
+	endSpan(span, err)
+	return result, err
+}
+
+func (t tracedDBTX) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	ctx, span := t.start(ctx, query)
+	stmt, err := t.db.PrepareContext(ctx, query)
+	endSpan(span, err)
+	return stmt, err
+}
+
+func (t tracedDBTX) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, span := t.start(ctx, query)
+	rows, err := t.db.QueryContext(ctx, query, args...)
+	endSpan(span, err)
+	return rows, err
+}
+
+func (t tracedDBTX) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, span := t.start(ctx, query)
+	row := t.db.QueryRowContext(ctx, query, args...)
+	endSpan(span, row.Err())
+	return row
+}
+
+// queryName returns the name of a sqlc query, which starts with a
+// "-- name: InsertEvent :one" comment.
+func queryName(query string) string {
+	if name, ok := strings.CutPrefix(query, "-- name: "); ok {
+		if name, _, ok := strings.Cut(name, " "); ok {
+			return name
+		}
+	}
+	return "query"
+}
+
+// startCall starts the span of a public storage call.
+func (s *Storage) startCall(ctx context.Context, op string) (context.Context, trace.Span) {
+	return s.tracer.Start(ctx, "storage."+strings.ReplaceAll(op, " ", "_"),
+		trace.WithAttributes(attribute.String("db.system", s.dbSystem())),
+	)
+}
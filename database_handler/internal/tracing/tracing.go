@@ -0,0 +1,186 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+
+	echotrace "github.com/DataDog/dd-trace-go/contrib/labstack/echo.v4/v2"
+	"github.com/DataDog/dd-trace-go/v2/ddtrace/tracer"
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const (
+	// Tracing backends
+	BackendDatadog = "datadog"
+	BackendOTLP    = "otlp"
+	BackendNone    = "none"
+
+	// ServiceName is reported to OTLP unless OTEL_SERVICE_NAME is set
+	ServiceName = "database_handler"
+
+	instrumentationName = "github.com/Failure-Enthusiasts/cater-me-up"
+)
+
+// Backends lists the supported tracing backends.
+var Backends = []string{BackendDatadog, BackendOTLP, BackendNone}
+
+// Valid reports whether backend is supported.
+func Valid(backend string) bool {
+	return slices.Contains(Backends, backend)
+}
+
+// Tracing is the started tracing backend.
+type Tracing struct {
+	backend    string
+	provider   trace.TracerProvider
+	propagator propagation.TextMapPropagator
+	shutdown   func(ctx context.Context) error
+}
+
+// Start starts the backend. Datadog traces through its agent, configured
+// with the DD_ environment variables. OTLP exports over HTTP to endpoint, or
+// to OTEL_EXPORTER_OTLP_ENDPOINT when endpoint is empty.
+func Start(ctx context.Context, backend, endpoint, version string) (*Tracing, error) {
+	t := &Tracing{
+		backend:    backend,
+		provider:   noop.NewTracerProvider(),
+		propagator: propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}),
+		shutdown:   func(context.Context) error { return nil },
+	}
+
+	switch backend {
+	case BackendDatadog:
+		if err := tracer.Start(); err != nil {
+			return nil, fmt.Errorf("failed to start the datadog tracer: %w", err)
+		}
+		t.shutdown = func(context.Context) error {
+			tracer.Stop()
+			return nil
+		}
+	case BackendOTLP:
+		var options []otlptracehttp.Option
+		if endpoint != "" {
+			endpointURL, err := url.Parse(endpoint)
+			if err != nil || endpointURL.Host == "" {
+				return nil, fmt.Errorf("otlp endpoint %q must be a URL such as http://localhost:4318", endpoint)
+			}
+			// Like OTEL_EXPORTER_OTLP_ENDPOINT, a collector address gets the
+			// traces path
+			if endpointURL.Path == "" || endpointURL.Path == "/" {
+				endpointURL.Path = "/v1/traces"
+			}
+			options = append(options, otlptracehttp.WithEndpointURL(endpointURL.String()))
+		}
+		exporter, err := otlptracehttp.New(ctx, options...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create the otlp exporter: %w", err)
+		}
+		// The environment, such as OTEL_SERVICE_NAME, overrides the defaults
+		serviceResource, err := resource.Merge(
+			resource.NewSchemaless(
+				attribute.String("service.name", ServiceName),
+				attribute.String("service.version", version),
+			),
+			resource.Environment(),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create the otlp resource: %w", err)
+		}
+		provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(serviceResource))
+		t.provider = provider
+		t.shutdown = provider.Shutdown
+	case BackendNone:
+	default:
+		return nil, fmt.Errorf("tracing backend %q must be datadog, otlp or none", backend)
+	}
+	return t, nil
+}
+
+// Backend returns the started backend.
+func (t *Tracing) Backend() string {
+	return t.backend
+}
+
+// TracerProvider returns the OpenTelemetry provider spans are created with. It
+// is a no-op unless the backend is OTLP, Datadog instruments the SQL driver
+// itself.
+func (t *Tracing) TracerProvider() trace.TracerProvider {
+	return t.provider
+}
+
+// Shutdown flushes the pending spans.
+func (t *Tracing) Shutdown(ctx context.Context) error {
+	return t.shutdown(ctx)
+}
+
+// Middleware starts a span for every request, continuing the trace of the
+// caller.
+func (t *Tracing) Middleware() echo.MiddlewareFunc {
+	switch t.backend {
+	case BackendDatadog:
+		return echotrace.Middleware()
+	case BackendOTLP:
+		return t.otelMiddleware()
+	default:
+		return func(next echo.HandlerFunc) echo.HandlerFunc {
+			return next
+		}
+	}
+}
+
+func (t *Tracing) otelMiddleware() echo.MiddlewareFunc {
+	spanTracer := t.provider.Tracer(instrumentationName)
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			request := ctx.Request()
+			attributes := []attribute.KeyValue{
+				attribute.String("http.request.method", request.Method),
+				attribute.String("url.path", request.URL.Path),
+				attribute.String("client.address", ctx.RealIP()),
+			}
+			// Unknown paths are named after the method only, like the metrics
+			name := request.Method
+			if route := ctx.Path(); route != "" {
+				name += " " + route
+				attributes = append(attributes, attribute.String("http.route", route))
+			}
+
+			parent := t.propagator.Extract(request.Context(), propagation.HeaderCarrier(request.Header))
+			spanCtx, span := spanTracer.Start(parent, name,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(attributes...),
+			)
+			defer span.End()
+			ctx.SetRequest(request.WithContext(spanCtx))
+
+			err := next(ctx)
+			status := ctx.Response().Status
+			if err != nil {
+				var httpErr *echo.HTTPError
+				if errors.As(err, &httpErr) {
+					status = httpErr.Code
+				} else if !ctx.Response().Committed {
+					status = http.StatusInternalServerError
+				}
+				span.RecordError(err)
+			}
+			span.SetAttributes(attribute.Int("http.response.status_code", status))
+			if status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(status))
+			}
+			return err
+		}
+	}
+}
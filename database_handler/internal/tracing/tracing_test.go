@@ -0,0 +1,157 @@
+package tracing_test
+
+import (
+	"context"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/internal_types"
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/migrations"
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/storage"
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/tracing"
+	"github.com/labstack/echo/v4"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// collector stands in for an OTLP/HTTP collector and keeps every span it
+// receives.
+type collector struct {
+	mu    sync.Mutex
+	spans []*tracepb.Span
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/v1/traces" {
+		http.NotFound(w, r)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var request collectortrace.ExportTraceServiceRequest
+	if err := proto.Unmarshal(body, &request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	c.mu.Lock()
+	for _, resourceSpans := range request.ResourceSpans {
+		for _, scopeSpans := range resourceSpans.ScopeSpans {
+			c.spans = append(c.spans, scopeSpans.Spans...)
+		}
+	}
+	c.mu.Unlock()
+
+	response, _ := proto.Marshal(&collectortrace.ExportTraceServiceResponse{})
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.Write(response)
+}
+
+func (c *collector) byName() map[string][]*tracepb.Span {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	spans := make(map[string][]*tracepb.Span)
+	for _, span := range c.spans {
+		spans[span.Name] = append(spans[span.Name], span)
+	}
+	return spans
+}
+
+func TestOTLP(t *testing.T) {
+	received := &collector{}
+	server := httptest.NewServer(received)
+	defer server.Close()
+
+	traces, err := tracing.Start(context.Background(), tracing.BackendOTLP, server.URL, "1.2.3")
+	if err != nil {
+		t.Fatalf("failed to start tracing: %v", err)
+	}
+
+	s := storage.NewStorage().
+		WithDBType(storage.DBTypeSQLite).
+		WithDatabase(filepath.Join(t.TempDir(), "dogdish.db")).
+		WithDatadogSQLTracing(false).
+		WithTracerProvider(traces.TracerProvider())
+	if err := s.Open(); err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+	defer s.Close()
+	db, _ := s.GetDBConnection()
+	if _, err := migrations.Up(context.Background(), db, storage.DBTypeSQLite); err != nil {
+		t.Fatalf("failed to apply migrations: %v", err)
+	}
+
+	e := echo.New()
+	e.Use(traces.Middleware())
+	e.POST("/event", func(ctx echo.Context) error {
+		_, err := s.StoreEvent(ctx.Request().Context(), internal_types.Event{
+			Weekday: "Friday",
+			ISODate: "2025-08-29",
+			Cuisine: "Italian",
+			EntreesAndSides: []internal_types.EntreesAndSidesOrSaladBar{
+				{Name: "Bruschetta", Allergens: []string{"gluten"}, Preference: "vegan"},
+			},
+		})
+		if err != nil {
+			return err
+		}
+		return ctx.NoContent(http.StatusCreated)
+	})
+
+	// The caller's trace is continued
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodPost, "/event", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, rec.Code, rec.Body.String())
+	}
+
+	if err := traces.Shutdown(context.Background()); err != nil {
+		t.Fatalf("failed to flush spans: %v", err)
+	}
+
+	spans := received.byName()
+	for _, name := range []string{"POST /event", "storage.store_event", "InsertEvent", "UpsertCuisine", "InsertFood", "UpsertAllergen", "InsertFoodAllergen"} {
+		if len(spans[name]) == 0 {
+			t.Errorf("expected a %q span, got %v", name, spans)
+		}
+	}
+	if t.Failed() {
+		return
+	}
+
+	request, call, query := spans["POST /event"][0], spans["storage.store_event"][0], spans["InsertEvent"][0]
+	if got := hex.EncodeToString(request.TraceId); got != traceID {
+		t.Errorf("expected the request span to continue trace %s, got %s", traceID, got)
+	}
+	if string(call.ParentSpanId) != string(request.SpanId) {
+		t.Errorf("expected the storage call to be a child of the request")
+	}
+	if string(query.ParentSpanId) != string(call.SpanId) {
+		t.Errorf("expected the query to be a child of the storage call")
+	}
+	if query.Kind != tracepb.Span_SPAN_KIND_CLIENT {
+		t.Errorf("expected a client span for the query, got %s", query.Kind)
+	}
+}
+
+func TestStartInvalid(t *testing.T) {
+	if _, err := tracing.Start(context.Background(), "zipkin", "", ""); err == nil {
+		t.Errorf("expected an unknown backend to be rejected")
+	}
+	if _, err := tracing.Start(context.Background(), tracing.BackendOTLP, "collector:4318", ""); err == nil {
+		t.Errorf("expected an endpoint without a scheme to be rejected")
+	}
+}
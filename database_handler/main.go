@@ -1,23 +1,32 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
-	echotrace "github.com/DataDog/dd-trace-go/contrib/labstack/echo.v4/v2"
-	"github.com/DataDog/dd-trace-go/v2/ddtrace/tracer"
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/auth"
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/cache"
 	"github.com/Failure-Enthusiasts/cater-me-up/internal/config"
 	"github.com/Failure-Enthusiasts/cater-me-up/internal/internal_types"
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/logging"
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/metrics"
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/ratelimit"
 	"github.com/Failure-Enthusiasts/cater-me-up/internal/storage"
-	"github.com/Failure-Enthusiasts/cater-me-up/internal/storage/postgres"
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/tracing"
 	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
-	"github.com/labstack/echo/v4/middleware"
 	_ "github.com/lib/pq"
 	log "github.com/sirupsen/logrus"
 )
@@ -38,7 +47,7 @@ func validateStruct(v *validator.Validate, data any, location string) []internal
 	return nil
 }
 
-func validateEvent(event internal_types.Event) []internal_types.FieldError {
+func validateEvent(ctx context.Context, event internal_types.Event) []internal_types.FieldError {
 	validate := validator.New(validator.WithRequiredStructEnabled())
 
 	// Validate event's root level fields
@@ -49,7 +58,7 @@ func validateEvent(event internal_types.Event) []internal_types.FieldError {
 
 	// Validate event entress and sides
 	for ix, entree := range event.EntreesAndSides {
-		fmt.Printf("Validating Entree and Sides: %v\n", entree)
+		log.WithContext(ctx).WithField("entree", entree).Debug("validating entree or side")
 		entreeErrors := validateStruct(validate, entree, fmt.Sprintf("Entree [%d]", ix))
 		if entreeErrors != nil {
 			return entreeErrors
@@ -58,14 +67,14 @@ func validateEvent(event internal_types.Event) []internal_types.FieldError {
 
 	// Validate salad bar
 	saladBarErrors := validateStruct(validate, event.SaladBar, "Salad Bar")
-	fmt.Printf("Validating Salad Dressing: %v\n", event.SaladBar)
+	log.WithContext(ctx).WithField("salad_bar", event.SaladBar).Debug("validating salad bar")
 	if saladBarErrors != nil {
 		return saladBarErrors
 	}
 
 	// Validate salad bar toppings
 	for ix, topping := range event.SaladBar.Toppings {
-		fmt.Printf("Validating Topping: %v\n", topping)
+		log.WithContext(ctx).WithField("topping", topping).Debug("validating topping")
 		toppingsErrors := validateStruct(validate, topping, fmt.Sprintf("Salad Bar - Topping [%d]", ix))
 		if toppingsErrors != nil {
 			return toppingsErrors
@@ -74,7 +83,7 @@ func validateEvent(event internal_types.Event) []internal_types.FieldError {
 
 	// Validate salad bar dressings
 	for ix, dressing := range event.SaladBar.Dressings {
-		fmt.Printf("Validating Dressing: %v\n", dressing)
+		log.WithContext(ctx).WithField("dressing", dressing).Debug("validating dressing")
 		dressingsErrors := validateStruct(validate, dressing, fmt.Sprintf("Salad Bar - Dressing [%d]", ix))
 		if dressingsErrors != nil {
 			return dressingsErrors
@@ -95,75 +104,343 @@ func validateEvent(event internal_types.Event) []internal_types.FieldError {
 	return nil
 }
 
-func init() {
-	log.SetFormatter(&log.JSONFormatter{})
-	// TODO: Add logic to log to stdout based on environment variable
-	log.SetOutput(os.Stdout)
-
-	// file, err := os.OpenFile("./logs/database_handler.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
-	// if err == nil {
-	// 	log.SetOutput(file)
-	// } else {
-	// 	log.Info("Failed to log to file, using default stderr")
-	// }
-
-	// TODO: Add logic to set the log level based on environment variable
-	log.SetLevel(log.InfoLevel)
-}
-
 func main() {
-	tracer.Start()
-	defer tracer.Stop()
+	c, args, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		printUsage(os.Stdout)
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n\nRun database_handler --help to list the settings.\n", err)
+		os.Exit(2)
+	}
+	logOutput, err := logging.Configure(c.LogLevel, c.LogFormat, c.LogOutput)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to configure logging: %v\n", err)
+		os.Exit(1)
+	}
+	defer logOutput.Close()
 
-	c := config.Load()
+	m := metrics.New()
 	s := storage.NewStorage().
+		WithMetrics(m).
+		WithDatadogSQLTracing(c.TracingBackend == tracing.BackendDatadog).
+		WithDBType(storage.DBType(c.DatabaseType)).
+		WithHost(c.DatabaseHost).
+		WithPort(c.DatabasePort).
 		WithPassword(c.DatabasePassword).
+		WithPasswordFile(c.DatabasePasswordFile).
 		WithUser(c.DatabaseUser).
-		WithDatabase(c.DatabaseName)
+		WithDatabase(c.DatabaseName).
+		WithDatabaseURL(c.DatabaseURL).
+		WithDatabaseURLFile(c.DatabaseURLFile).
+		WithSSLMode(c.DatabaseSSLMode).
+		WithSSLRootCert(c.DatabaseSSLRootCert).
+		WithSSLCert(c.DatabaseSSLCert).
+		WithSSLKey(c.DatabaseSSLKey).
+		WithApplicationName(c.DatabaseApplicationName).
+		WithStatementTimeout(c.DatabaseStatementTimeout).
+		WithSearchPath(c.DatabaseSearchPath).
+		WithReplicaURL(c.DatabaseReplicaURL).
+		WithReplicaURLFile(c.DatabaseReplicaURLFile).
+		WithReplicaReadAfterWrite(c.DatabaseReplicaReadAfterWrite).
+		WithMaxOpenConns(int(c.DatabaseMaxOpenConns)).
+		WithMaxIdleConns(int(c.DatabaseMaxIdleConns)).
+		WithConnMaxLifetime(c.DatabaseConnMaxLifetime).
+		WithConnMaxIdleTime(c.DatabaseConnMaxIdleTime).
+		WithMaxRetries(int(c.DatabaseMaxRetries)).
+		WithRetryBackoff(c.DatabaseRetryBackoff)
+
+	if len(args) > 0 {
+		switch args[0] {
+		case "migrate":
+			os.Exit(runMigrate(s, args[1:]))
+		case "config":
+			os.Exit(runConfig(c, args[1:]))
+		case "apikey":
+			os.Exit(runAPIKey(s, args[1:]))
+		default:
+			fmt.Fprintf(os.Stderr, "unknown command %q\n\n", args[0])
+			printUsage(os.Stderr)
+			os.Exit(2)
+		}
+	}
+
+	if err := s.Validate(); err != nil {
+		log.WithError(err).Fatal("refusing to start")
+	}
+
+	traces, err := tracing.Start(context.Background(), c.TracingBackend, c.OTLPEndpoint, c.Version)
+	if err != nil {
+		log.WithError(err).Fatal("failed to start tracing")
+	}
+	defer func() {
+		flushCtx, cancel := context.WithTimeout(context.Background(), c.ShutdownTimeout)
+		defer cancel()
+		if err := traces.Shutdown(flushCtx); err != nil {
+			log.WithError(err).Warn("failed to flush traces")
+		}
+	}()
+	s.WithTracerProvider(traces.TracerProvider())
+
+	if err := s.Open(); err != nil {
+		log.WithError(err).Fatal("failed to open storage")
+	}
+	defer func() {
+		if err := s.Close(); err != nil {
+			log.WithError(err).Warn("failed to close the database pool")
+		}
+	}()
+
+	// The background workers use the pool, so they are stopped before it is
+	// closed
+	background, stopBackground := context.WithCancel(context.Background())
+	var workers sync.WaitGroup
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		s.WatchSecrets(background, c.SecretRefreshInterval)
+	}()
+
+	if err := checkSchema(c, s); err != nil {
+		log.WithError(err).Fatal("refusing to serve, run `database_handler migrate up` or set DH_SCHEMA_CHECK=warn")
+	}
 
 	e := echo.New()
-	e.Use(echotrace.Middleware())
-	// TODO: make this less permissive
-	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
-		AllowOrigins: []string{"*"},
+	e.Use(requestID())
+	e.Use(m.Middleware())
+	e.Use(traces.Middleware())
+	cert, err := configureServer(e, c)
+	if err != nil {
+		log.WithError(err).Fatal("failed to configure the server")
+	}
+	if cert != nil {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			cert.watch(background, c.SecretRefreshInterval)
+		}()
+	}
+	// Writes, key management and debugging are only open to the admin origins
+	e.Use(corsPolicies(c, func(route string) bool {
+		return route == "/event" || strings.HasPrefix(route, "/admin/") || strings.HasPrefix(route, "/debug/")
 	}))
 
-	e.POST("/event", createEvent(s))
-	e.GET("/health", healthCheck(c))
-	e.GET("/front-page-events", getFrontPageEvents(s))
-	e.Logger.Fatal(e.Start(fmt.Sprintf(":%d", c.Port)))
+	// A TTL of 0 disables the cache
+	var repository storage.Repository = s
+	var eventCache *cache.Repository
+	if c.CacheTTL > 0 {
+		eventCache = cache.New(s, c.CacheTTL)
+		repository = eventCache
+		// Writes made by other instances arrive as change notifications
+		s.Subscribe(func(storage.ChangeNotification) { eventCache.Invalidate() })
+	}
+
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		if err := s.Listen(background); err != nil {
+			log.WithError(err).Error("stopped listening for change notifications, caches will only expire")
+		}
+	}()
+
+	tokens, tokenKeys, err := newTokenVerifier(background, c)
+	if err != nil {
+		log.WithError(err).Fatal("failed to load the token signing keys")
+	}
+	if tokenKeys != nil {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			tokenKeys.Watch(background, c.OIDCJWKSRefreshInterval)
+		}()
+	}
+
+	reads := ratelimit.PerMinute("reads", c.RateLimitReadPerMinute, c.RateLimitReadBurst)
+	writes := ratelimit.PerMinute("writes", c.RateLimitWritePerMinute, c.RateLimitWriteBurst)
+	authentication := ratelimit.PerMinute("authentication", c.RateLimitAuthPerMinute, c.RateLimitAuthBurst)
+	limiter, shared := newRateLimiter(c, s)
+	if shared != nil {
+		// A bucket idle for longer than it takes to fill is full, deleting it
+		// changes nothing
+		idle := max(reads.FillTime(), writes.FillTime(), authentication.FillTime()) + time.Minute
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			shared.Sweep(background, time.Minute, idle)
+		}()
+	}
+	limit := rateLimit(limiter, reads, writes, m)
+	// Before requireScope there is no principal yet, so this limits by IP and
+	// keeps bad keys and tokens from reaching the database unthrottled
+	limitAuth := rateLimit(limiter, authentication, authentication, m)
+
+	m.MustRegister(metrics.DBStats(map[string]func() (sql.DBStats, bool){
+		"primary": func() (sql.DBStats, bool) { return s.Stats(), true },
+		"replica": s.ReplicaStats,
+	}))
+
+	// Reads are public, writes need a key or a token with the editor role.
+	// The probes and metrics are not rate limited.
+	e.POST("/event", createEvent(repository, m), limitAuth, requireScope(s, tokens, auth.ScopeWrite), limit)
+	e.GET("/livez", livez())
+	var draining atomic.Bool
+	e.GET("/readyz", readyz(append(readinessChecks(c, s), drainingCheck(&draining))))
+	e.GET("/health", healthCheck(c, append(healthChecks(c, s), drainingCheck(&draining))))
+	e.GET("/event/:id", getEvent(repository, c.HTTPCacheMaxAge), limit)
+	e.GET("/events", listEvents(repository, c.HTTPCacheMaxAge), limit)
+	e.GET("/menu/:date", getMenu(repository, c.HTTPCacheMaxAge), limit)
+	e.GET("/front-page-events", getFrontPageEvents(repository, c.HTTPCacheMaxAge), limit)
+	e.GET("/debug/db-stats", getDBStats(s), limitAuth, requireScope(s, tokens, auth.ScopeRead), limit)
+	e.GET("/debug/cache-stats", getCacheStats(eventCache), limitAuth, requireScope(s, tokens, auth.ScopeRead), limit)
+	e.GET("/metrics", echo.WrapHandler(m.Handler()))
+
+	admin := e.Group("/admin", limitAuth, requireScope(s, tokens, auth.ScopeAdmin), limit)
+	admin.GET("/api-keys", listAPIKeys(s))
+	admin.POST("/api-keys", createAPIKey(s))
+	admin.DELETE("/api-keys/:id", revokeAPIKey(s))
+
+	// After the first signal, a second one kills the process right away
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	context.AfterFunc(ctx, stop)
+	if err := runServer(ctx, e, &draining, c.ShutdownDelay, c.ShutdownTimeout); err != nil {
+		log.WithError(err).Fatal("server failed")
+	}
+
+	stopBackground()
+	workers.Wait()
+	log.Info("requests drained, closing the database pool and flushing traces")
+}
+
+type DBStatsResponse struct {
+	MaxOpenConnections int   `json:"max_open_connections"`
+	OpenConnections    int   `json:"open_connections"`
+	InUse              int   `json:"in_use"`
+	Idle               int   `json:"idle"`
+	WaitCount          int64 `json:"wait_count"`
+	WaitDurationMs     int64 `json:"wait_duration_ms"`
+	MaxIdleClosed      int64 `json:"max_idle_closed"`
+	MaxIdleTimeClosed  int64 `json:"max_idle_time_closed"`
+	MaxLifetimeClosed  int64 `json:"max_lifetime_closed"`
+
+	// Replica is only set when a read replica is configured
+	Replica *DBStatsResponse `json:"replica,omitempty"`
+}
+
+func newDBStatsResponse(stats sql.DBStats) DBStatsResponse {
+	return DBStatsResponse{
+		MaxOpenConnections: stats.MaxOpenConnections,
+		OpenConnections:    stats.OpenConnections,
+		InUse:              stats.InUse,
+		Idle:               stats.Idle,
+		WaitCount:          stats.WaitCount,
+		WaitDurationMs:     stats.WaitDuration.Milliseconds(),
+		MaxIdleClosed:      stats.MaxIdleClosed,
+		MaxIdleTimeClosed:  stats.MaxIdleTimeClosed,
+		MaxLifetimeClosed:  stats.MaxLifetimeClosed,
+	}
+}
+
+func getDBStats(storage *storage.Storage) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		response := newDBStatsResponse(storage.Stats())
+		if replicaStats, ok := storage.ReplicaStats(); ok {
+			replica := newDBStatsResponse(replicaStats)
+			response.Replica = &replica
+		}
+		return ctx.JSON(http.StatusOK, response)
+	}
+}
+
+// storageErrorResponse maps a storage error to the status the client can act
+// on. Database details are only logged, never returned.
+func storageErrorResponse(ctx echo.Context, err error) error {
+	status, message := http.StatusInternalServerError, "internal server error"
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		status, message = http.StatusNotFound, "not found"
+	case errors.Is(err, storage.ErrValidation):
+		status, message = http.StatusBadRequest, "invalid event data"
+	case errors.Is(err, storage.ErrConflict):
+		status, message = http.StatusConflict, "conflicts with an existing record"
+	case errors.Is(err, storage.ErrTransient):
+		status, message = http.StatusServiceUnavailable, "database temporarily unavailable"
+		ctx.Response().Header().Set("Retry-After", "1")
+	}
+
+	// A CDN must not keep serving an error after the database recovered
+	ctx.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+	entry := requestLog(ctx).WithError(err).WithField("status", status)
+	if status == http.StatusNotFound {
+		// A missing record is an answer, not a failed request
+		entry.Info("record not found")
+	} else {
+		entry.Error("storage request failed")
+	}
+	return ctx.JSON(status, internal_types.ErrorResponse{
+		Error: message,
+	})
+}
+
+type CacheStatsResponse struct {
+	Enabled bool `json:"enabled"`
+	cache.Stats
 }
 
-func healthCheck(c *config.Config) echo.HandlerFunc {
+func getCacheStats(eventCache *cache.Repository) echo.HandlerFunc {
 	return func(ctx echo.Context) error {
-		log.WithFields(log.Fields{"client_ip": ctx.RealIP(), "version": c.Version}).Info("health check hit")
-		return ctx.JSON(http.StatusOK, map[string]string{
-			"version": c.Version,
+		if eventCache == nil {
+			return ctx.JSON(http.StatusOK, CacheStatsResponse{})
+		}
+		return ctx.JSON(http.StatusOK, CacheStatsResponse{
+			Enabled: true,
+			Stats:   eventCache.Stats(),
 		})
 	}
 }
 
-func createEvent(storage *storage.Storage) echo.HandlerFunc {
+func createEvent(storage storage.Repository, m *metrics.Metrics) echo.HandlerFunc {
 	return func(ctx echo.Context) error {
-		log.WithFields(log.Fields{"client_ip": ctx.RealIP()}).Info("creating event")
+		requestLog(ctx).Info("creating event")
 
 		body := ctx.Request().Body
 		defer body.Close()
 
-		log.WithFields(log.Fields{"client_ip": ctx.RealIP(), "data": body}).Debug("json received")
 		var event internal_types.Event
-		if err := json.NewDecoder(body).Decode(&event); err != nil {
+		unknownFields, err := decodeJSON(body, &event)
+		if errors.Is(err, errBodyTooLarge) {
+			requestLog(ctx).Error(err)
+			return ctx.JSON(http.StatusRequestEntityTooLarge, internal_types.ErrorResponse{
+				Error: err.Error(),
+			})
+		}
+		if err != nil {
 			err_msg := "failed to decode json"
-			log.WithFields(log.Fields{"client_ip": ctx.RealIP()}).Error(err_msg)
+			requestLog(ctx).WithError(err).Error(err_msg)
 			return ctx.JSON(http.StatusBadRequest, internal_types.FieldErrorResponse{
 				Error: err_msg,
 			})
 		}
+		if unknownFields != nil {
+			err_msg := "unknown fields in event data"
+			requestLog(ctx).Error(err_msg)
+			// The paths are client input, keep them out of the labels
+			m.ValidationFailed("unknown_field")
+			return ctx.JSON(http.StatusBadRequest, internal_types.FieldErrorResponse{
+				Error:      err_msg,
+				FieldError: unknownFields,
+			})
+		}
+		requestLog(ctx).WithFields(log.Fields{"event": event}).Debug("json received")
 
-		eventValidationErrors := validateEvent(event)
+		eventValidationErrors := validateEvent(ctx.Request().Context(), event)
 		if eventValidationErrors != nil {
 			err_msg := "invalid event data"
-			log.WithFields(log.Fields{"client_ip": ctx.RealIP()}).Error(err_msg)
+			requestLog(ctx).Error(err_msg)
+			for _, fieldError := range eventValidationErrors {
+				m.ValidationFailed(fieldError.Field)
+			}
 
 			return ctx.JSON(http.StatusBadRequest, internal_types.FieldErrorResponse{
 				Error:      err_msg,
@@ -173,10 +450,9 @@ func createEvent(storage *storage.Storage) echo.HandlerFunc {
 
 		newEventID, err := storage.StoreEvent(ctx.Request().Context(), event)
 		if err != nil {
-			return ctx.JSON(http.StatusInternalServerError, internal_types.ErrorResponse{
-				Error: err.Error(),
-			})
+			return storageErrorResponse(ctx, err)
 		}
+		requestLog(ctx).WithFields(log.Fields{"event_id": newEventID, "iso_date": event.ISODate}).Info("created event")
 
 		return ctx.JSON(http.StatusOK, map[string]uuid.UUID{
 			"event_id": newEventID,
@@ -184,6 +460,76 @@ func createEvent(storage *storage.Storage) echo.HandlerFunc {
 	}
 }
 
+func getEvent(repository storage.Repository, maxAge time.Duration) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		requestLog(ctx).WithFields(log.Fields{"event_id": ctx.Param("id")}).Info("getting event")
+
+		eventID, err := uuid.Parse(ctx.Param("id"))
+		if err != nil {
+			return ctx.JSON(http.StatusBadRequest, internal_types.FieldErrorResponse{
+				Error: "invalid event id",
+				FieldError: []internal_types.FieldError{
+					{
+						Location: "Path",
+						Field:    "id",
+						Message:  "uuid",
+					},
+				},
+			})
+		}
+
+		event, err := repository.GetEvent(ctx.Request().Context(), eventID)
+		if err != nil {
+			return storageErrorResponse(ctx, err)
+		}
+
+		return cachedJSON(ctx, maxAge, event.UpdatedAt, event)
+	}
+}
+
+func listEvents(repository storage.Repository, maxAge time.Duration) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		requestLog(ctx).Info("listing events")
+
+		events, err := repository.ListEvents(ctx.Request().Context())
+		if err != nil {
+			return storageErrorResponse(ctx, err)
+		}
+
+		return cachedJSON(ctx, maxAge, lastUpdated(events), map[string][]internal_types.StoredEvent{
+			"events": events,
+		})
+	}
+}
+
+func getMenu(repository storage.Repository, maxAge time.Duration) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		requestLog(ctx).WithFields(log.Fields{"date": ctx.Param("date")}).Info("getting menu")
+
+		if _, err := time.Parse(time.DateOnly, ctx.Param("date")); err != nil {
+			return ctx.JSON(http.StatusBadRequest, internal_types.FieldErrorResponse{
+				Error: "invalid date",
+				FieldError: []internal_types.FieldError{
+					{
+						Location: "Path",
+						Field:    "date",
+						Message:  "datetime=2006-01-02",
+					},
+				},
+			})
+		}
+
+		events, err := repository.GetEventsByDate(ctx.Request().Context(), ctx.Param("date"))
+		if err != nil {
+			return storageErrorResponse(ctx, err)
+		}
+
+		return cachedJSON(ctx, maxAge, lastUpdated(events), map[string][]internal_types.StoredEvent{
+			"events": events,
+		})
+	}
+}
+
 type FrontPageEvent struct {
 	Weekday         string                                     `json:"weekday"`
 	ISODate         string                                     `json:"iso_date"`
@@ -196,91 +542,34 @@ type GetFrontPageEventsResponse struct {
 	Events []FrontPageEvent `json:"events"`
 }
 
-func getFrontPageEvents(storage *storage.Storage) echo.HandlerFunc {
+func getFrontPageEvents(storage storage.Repository, maxAge time.Duration) echo.HandlerFunc {
 	return func(ctx echo.Context) error {
-		log.WithFields(log.Fields{"client_ip": ctx.RealIP()}).Info("getting events for front page")
-
-		var frontPageEvents []FrontPageEvent
+		requestLog(ctx).Info("getting events for front page")
 
-		eventIDs, err := storage.GetFrontPageEventIDs(ctx.Request().Context())
+		events, err := storage.GetFrontPageEvents(ctx.Request().Context())
 		if err != nil {
-			return ctx.JSON(http.StatusInternalServerError, internal_types.ErrorResponse{
-				Error: err.Error(),
-			})
+			return storageErrorResponse(ctx, err)
 		}
 
-		for _, event := range eventIDs {
-			log.WithFields(log.Fields{"event_id": event.ID}).Info("event id found")
-			var frontPageEvent FrontPageEvent = FrontPageEvent{
-				Weekday: event.Date,
-				ISODate: event.IsoDate.Format(time.DateOnly),
-			}
-
-			log.WithFields(log.Fields{"event_id": event.ID}).Info("Getting food by event id")
-			eventFoods, err := storage.GetFoodsByEventId(ctx.Request().Context(), event.ID)
-			if err != nil {
-				return ctx.JSON(http.StatusInternalServerError, internal_types.ErrorResponse{
-					Error: err.Error(),
-				})
-			}
-			foodCount := len(eventFoods)
-			log.WithFields(log.Fields{"food_count": foodCount}).Info("Food found")
-
-			if foodCount == 0 {
-				log.Info("No food found")
-				continue
-			}
-
-			cuisine, err := storage.GetCuisineById(ctx.Request().Context(), eventFoods[0].CuisineID)
-			if err != nil {
-				return ctx.JSON(http.StatusInternalServerError, internal_types.ErrorResponse{
-					Error: err.Error(),
-				})
-			}
-			frontPageEvent.Cuisine = cuisine.Name
-
-			for _, eventFood := range eventFoods {
-				log.Info("Checking the event food")
-				log.WithFields(log.Fields{"food": eventFood}).Info("Event Food")
-
-				allergens := strings.Split(string(eventFood.AllergenNames), ",")
-				var preference string
-				if eventFood.Preference.Valid {
-					preference = string(eventFood.Preference.DogdishPreferenceEnum)
-				} else {
-					preference = ""
-				}
-
-				switch eventFood.FoodType {
-				case postgres.DogdishFoodTypeEnumEntreesAndSides:
-					frontPageEvent.EntreesAndSides = append(frontPageEvent.EntreesAndSides, internal_types.EntreesAndSidesOrSaladBar{
-						Name:       eventFood.Name,
-						Allergens:  allergens,
-						Preference: preference,
-					})
-				case postgres.DogdishFoodTypeEnumToppings:
-
-					frontPageEvent.SaladBar.Toppings = append(frontPageEvent.SaladBar.Toppings, internal_types.EntreesAndSidesOrSaladBar{
-						Name:       eventFood.Name,
-						Allergens:  allergens,
-						Preference: preference,
-					})
-				case postgres.DogdishFoodTypeEnumDressings:
-
-					frontPageEvent.SaladBar.Dressings = append(frontPageEvent.SaladBar.Dressings, internal_types.EntreesAndSidesOrSaladBar{
-						Name:       eventFood.Name,
-						Allergens:  allergens,
-						Preference: preference,
-					})
-				default:
-					log.WithFields(log.Fields{"food_type": eventFood.FoodType}).Info("Unknown food type")
-				}
-			}
-			frontPageEvents = append(frontPageEvents, frontPageEvent)
+		frontPageEvents := make([]FrontPageEvent, 0, len(events))
+		for _, event := range events {
+			frontPageEvents = append(frontPageEvents, FrontPageEvent{
+				Weekday:         event.Weekday,
+				ISODate:         event.ISODate,
+				Cuisine:         event.Cuisine,
+				EntreesAndSides: event.EntreesAndSides,
+				SaladBar:        event.SaladBar,
+			})
+		}
 
+		// The front page also changes at midnight without any write
+		now := time.Now()
+		lastModified := lastUpdated(events)
+		if today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()); today.After(lastModified) {
+			lastModified = today
 		}
 
-		return ctx.JSON(http.StatusOK, map[string][]FrontPageEvent{
+		return cachedJSON(ctx, maxAge, lastModified, map[string][]FrontPageEvent{
 			"events": frontPageEvents,
 		})
 	}
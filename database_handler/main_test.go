@@ -0,0 +1,1387 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/auth"
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/config"
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/internal_types"
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/logging"
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/migrations"
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/ratelimit"
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/storage"
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/storage/memory"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+const testEventJSON = `{
+	"weekday": "Friday",
+	"iso_date": "2025-08-29",
+	"cuisine": "Italian",
+	"entrees_and_sides": [
+		{"name": "Spaghetti Carbonara", "allergens": ["gluten", "dairy", "eggs"], "preference": "vegetarian"},
+		{"name": "Bruschetta", "allergens": [], "preference": "vegan"}
+	],
+	"salad_bar": {
+		"toppings": [
+			{"name": "Croutons", "allergens": ["gluten"], "preference": "vegetarian"}
+		],
+		"dressings": [
+			{"name": "Balsamic Vinaigrette", "allergens": [], "preference": "vegan"}
+		]
+	}
+}`
+
+func testClock(isoDate string) func() time.Time {
+	return func() time.Time {
+		now, _ := time.Parse(time.DateOnly, isoDate)
+		return now
+	}
+}
+
+func testEvent(weekday, isoDate string) internal_types.Event {
+	var event internal_types.Event
+	if err := json.Unmarshal([]byte(testEventJSON), &event); err != nil {
+		panic(err)
+	}
+	event.Weekday = weekday
+	event.ISODate = isoDate
+	return event
+}
+
+func serve(t *testing.T, handler echo.HandlerFunc, method, target, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	e := echo.New()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+
+	if err := handler(e.NewContext(req, rec)); err != nil {
+		t.Fatalf("handler returned an error: %v", err)
+	}
+	return rec
+}
+
+func decode[T any](t *testing.T, rec *httptest.ResponseRecorder) T {
+	t.Helper()
+
+	var v T
+	if err := json.Unmarshal(rec.Body.Bytes(), &v); err != nil {
+		t.Fatalf("failed to decode response %q: %v", rec.Body.String(), err)
+	}
+	return v
+}
+
+func TestHealthCheck(t *testing.T) {
+	s := openTestStorages(t)["sqlite"]
+	c := &config.Config{Version: "1.2.3", SchemaCheck: config.SchemaCheckStrict}
+
+	rec := serve(t, healthCheck(c, healthChecks(c, s)), http.MethodGet, "/health", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	body := decode[HealthResponse](t, rec)
+	if body.Version != "1.2.3" || body.Status != healthPass {
+		t.Errorf("expected a passing report for version 1.2.3, got %+v", body)
+	}
+	for _, name := range []string{"database", "pool", "migrations"} {
+		if check, ok := body.Checks[name]; !ok || check.Status != healthPass {
+			t.Errorf("expected the %s check to pass, got %+v", name, body.Checks)
+		}
+	}
+
+	if rec := serve(t, livez(), http.MethodGet, "/livez", ""); rec.Code != http.StatusOK {
+		t.Errorf("expected livez to pass, got %d", rec.Code)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	s := openTestStorages(t)["sqlite"]
+	db, _ := s.GetDBConnection()
+	if _, err := migrations.Down(context.Background(), db, s.DBType()); err != nil {
+		t.Fatalf("failed to roll back migration: %v", err)
+	}
+
+	strict := &config.Config{SchemaCheck: config.SchemaCheckStrict}
+	rec := serve(t, readyz(readinessChecks(strict, s)), http.MethodGet, "/readyz", "")
+	body := decode[HealthResponse](t, rec)
+	if rec.Code != http.StatusServiceUnavailable || body.Checks["migrations"].Status != healthFail {
+		t.Errorf("expected a schema mismatch to fail readiness, got %d %+v", rec.Code, body)
+	}
+
+	warn := &config.Config{SchemaCheck: config.SchemaCheckWarn}
+	rec = serve(t, readyz(readinessChecks(warn, s)), http.MethodGet, "/readyz", "")
+	body = decode[HealthResponse](t, rec)
+	if rec.Code != http.StatusOK || body.Status != healthWarn {
+		t.Errorf("expected a schema mismatch to only warn, got %d %+v", rec.Code, body)
+	}
+
+	s.Close()
+	rec = serve(t, readyz(readinessChecks(warn, s)), http.MethodGet, "/readyz", "")
+	body = decode[HealthResponse](t, rec)
+	if rec.Code != http.StatusServiceUnavailable || body.Checks["database"].Error != "database unreachable" {
+		t.Errorf("expected an unreachable database to fail readiness, got %d %+v", rec.Code, body)
+	}
+	if rec := serve(t, livez(), http.MethodGet, "/livez", ""); rec.Code != http.StatusOK {
+		t.Errorf("expected livez to pass without a database, got %d", rec.Code)
+	}
+}
+
+func TestPoolStatus(t *testing.T) {
+	if status, _, _ := poolStatus(sql.DBStats{MaxOpenConnections: 10, InUse: 5}); status != healthPass {
+		t.Errorf("expected a half used pool to pass, got %s", status)
+	}
+	status, details, err := poolStatus(sql.DBStats{MaxOpenConnections: 10, InUse: 10})
+	if status != healthWarn || err == nil || details["saturation"] != 1.0 {
+		t.Errorf("expected a saturated pool to warn, got %s %v %v", status, details, err)
+	}
+	if status, _, _ := poolStatus(sql.DBStats{InUse: 100}); status != healthPass {
+		t.Errorf("expected an unlimited pool to pass, got %s", status)
+	}
+}
+
+// startServer runs e with runServer on a local port until the returned
+// cancel is called.
+func startServer(t *testing.T, e *echo.Echo, draining *atomic.Bool, delay, timeout time.Duration) (string, context.CancelFunc, <-chan error) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	e.HideBanner, e.HidePort = true, true
+	e.Listener = listener
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- runServer(ctx, e, draining, delay, timeout)
+	}()
+	t.Cleanup(cancel)
+	return "http://" + listener.Addr().String(), cancel, served
+}
+
+func TestRunServerDrainsRequests(t *testing.T) {
+	var draining atomic.Bool
+	started, release := make(chan struct{}), make(chan struct{})
+	e := echo.New()
+	e.GET("/slow", func(ctx echo.Context) error {
+		close(started)
+		<-release
+		return ctx.String(http.StatusOK, "done")
+	})
+	e.GET("/readyz", readyz([]dependencyCheck{drainingCheck(&draining)}))
+	url, shutdown, served := startServer(t, e, &draining, 200*time.Millisecond, 5*time.Second)
+
+	slow := make(chan string, 1)
+	go func() {
+		resp, err := http.Get(url + "/slow")
+		if err != nil {
+			slow <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		slow <- string(body)
+	}()
+	<-started
+	shutdown()
+
+	// Readiness fails while connections are still accepted
+	for !draining.Load() {
+		time.Sleep(time.Millisecond)
+	}
+	resp, err := http.Get(url + "/readyz")
+	if err != nil {
+		t.Fatalf("expected connections to be accepted during the shutdown delay: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected readiness to fail while draining, got %d", resp.StatusCode)
+	}
+
+	close(release)
+	if body := <-slow; body != "done" {
+		t.Errorf("expected the in-flight request to finish, got %q", body)
+	}
+	if err := <-served; err != nil {
+		t.Errorf("expected a clean shutdown, got %v", err)
+	}
+}
+
+func TestRunServerShutdownTimeout(t *testing.T) {
+	var draining atomic.Bool
+	started, cancelled := make(chan struct{}), make(chan struct{})
+	e := echo.New()
+	e.GET("/stuck", func(ctx echo.Context) error {
+		close(started)
+		<-ctx.Request().Context().Done()
+		close(cancelled)
+		return ctx.Request().Context().Err()
+	})
+	url, shutdown, served := startServer(t, e, &draining, 0, 50*time.Millisecond)
+
+	failed := make(chan error, 1)
+	go func() {
+		resp, err := http.Get(url + "/stuck")
+		if err == nil {
+			resp.Body.Close()
+		}
+		failed <- err
+	}()
+	<-started
+	shutdown()
+
+	if err := <-served; err != nil {
+		t.Errorf("expected the server to stop after the timeout, got %v", err)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the request context to be cancelled")
+	}
+	if err := <-failed; err == nil {
+		t.Errorf("expected the connection of the stuck request to be closed")
+	}
+}
+
+// writeCertificate writes a self-signed certificate for 127.0.0.1 and its
+// key to certFile and keyFile, and returns a pool trusting it.
+func writeCertificate(t *testing.T, certFile, keyFile string) *x509.CertPool {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "dogdish test"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("failed to write certificate: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+
+	parsed, _ := x509.ParseCertificate(der)
+	pool := x509.NewCertPool()
+	pool.AddCert(parsed)
+	return pool
+}
+
+func TestServeTLS(t *testing.T) {
+	dir := t.TempDir()
+	c := config.Default()
+	c.Port = 0
+	c.TLSCertFile, c.TLSKeyFile = filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	firstCA := writeCertificate(t, c.TLSCertFile, c.TLSKeyFile)
+
+	e := echo.New()
+	e.HideBanner, e.HidePort = true, true
+	cert, err := configureServer(e, c)
+	if err != nil {
+		t.Fatalf("failed to configure the server: %v", err)
+	}
+	e.GET("/livez", livez())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var draining atomic.Bool
+	go runServer(ctx, e, &draining, 0, time.Second)
+	for e.TLSListenerAddr() == nil {
+		time.Sleep(time.Millisecond)
+	}
+	url := fmt.Sprintf("https://127.0.0.1:%d/livez", e.TLSListenerAddr().(*net.TCPAddr).Port)
+
+	get := func(roots *x509.CertPool) error {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+		defer client.CloseIdleConnections()
+		resp, err := client.Get(url)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("unexpected status %d", resp.StatusCode)
+		}
+		return nil
+	}
+	if err := get(firstCA); err != nil {
+		t.Fatalf("expected the request to be served over TLS: %v", err)
+	}
+
+	// A renewed certificate is served once reloaded
+	renewedCA := writeCertificate(t, c.TLSCertFile, c.TLSKeyFile)
+	if changed, err := cert.reload(); !changed || err != nil {
+		t.Fatalf("expected the renewed certificate to be loaded, got %t %v", changed, err)
+	}
+	if err := get(renewedCA); err != nil {
+		t.Errorf("expected the renewed certificate to be served: %v", err)
+	}
+
+	// A broken file keeps the current certificate
+	os.WriteFile(c.TLSKeyFile, []byte("half written"), 0o600)
+	if _, err := cert.reload(); err == nil {
+		t.Errorf("expected a broken key to fail to load")
+	}
+	if err := get(renewedCA); err != nil {
+		t.Errorf("expected the current certificate to be kept: %v", err)
+	}
+}
+
+func TestCreateEvent(t *testing.T) {
+	repository := memory.NewStorage()
+
+	rec := serve(t, createEvent(repository, nil), http.MethodPost, "/event", testEventJSON)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	body := decode[map[string]string](t, rec)
+	events, _ := repository.ListEvents(context.Background())
+	if len(events) != 1 {
+		t.Fatalf("expected 1 stored event, got %d", len(events))
+	}
+	if events[0].ID.String() != body["event_id"] {
+		t.Errorf("expected event_id %s, got %s", events[0].ID, body["event_id"])
+	}
+	if events[0].Cuisine != "Italian" || len(events[0].EntreesAndSides) != 2 {
+		t.Errorf("stored event does not match the request: %+v", events[0])
+	}
+}
+
+func TestCreateEventInvalidJSON(t *testing.T) {
+	rec := serve(t, createEvent(memory.NewStorage(), nil), http.MethodPost, "/event", `{"weekday": `)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+	body := decode[internal_types.FieldErrorResponse](t, rec)
+	if body.Error != "failed to decode json" {
+		t.Errorf("unexpected error %q", body.Error)
+	}
+}
+
+func TestCreateEventUnknownFields(t *testing.T) {
+	body := strings.Replace(testEventJSON, `"preference": "vegan"}`, `"preferences": ["vegan"]}`, 1)
+	body = strings.Replace(body, `"cuisine": "Italian",`, `"cuisine": "Italian", "Chef": "Mario",`, 1)
+	repository := memory.NewStorage()
+	rec := serve(t, createEvent(repository, nil), http.MethodPost, "/event", body)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusBadRequest, rec.Code, rec.Body.String())
+	}
+	response := decode[internal_types.FieldErrorResponse](t, rec)
+	expected := []internal_types.FieldError{
+		{Location: "Body", Field: "Chef", Message: "unknown field"},
+		{Location: "Body", Field: "entrees_and_sides[1].preferences", Message: "unknown field"},
+	}
+	if fmt.Sprint(response.FieldError) != fmt.Sprint(expected) {
+		t.Errorf("expected field errors %+v, got %+v", expected, response.FieldError)
+	}
+	if events, _ := repository.ListEvents(context.Background()); len(events) != 0 {
+		t.Errorf("expected nothing to be stored, got %d events", len(events))
+	}
+
+	// Keys match the fields case-insensitively, like encoding/json
+	rec = serve(t, createEvent(memory.NewStorage(), nil), http.MethodPost, "/event", strings.Replace(testEventJSON, `"weekday"`, `"Weekday"`, 1))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected a differently cased key to be accepted, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestCreateEventBodyLimit(t *testing.T) {
+	e := echo.New()
+	e.Use(bodyLimit(int64(len(testEventJSON))))
+	e.POST("/event", createEvent(memory.NewStorage(), nil))
+
+	for _, tt := range []struct {
+		name          string
+		body          string
+		contentLength bool
+		status        int
+	}{
+		{name: "at the limit", body: testEventJSON, contentLength: true, status: http.StatusOK},
+		{name: "over the limit", body: testEventJSON + " ", contentLength: true, status: http.StatusRequestEntityTooLarge},
+		{name: "over the limit, chunked", body: testEventJSON + " ", status: http.StatusRequestEntityTooLarge},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/event", strings.NewReader(tt.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			if !tt.contentLength {
+				req.ContentLength = -1
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Errorf("expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestCreateEventValidationErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		location string
+		field    string
+	}{
+		{
+			name:     "missing cuisine",
+			body:     strings.Replace(testEventJSON, `"cuisine": "Italian",`, "", 1),
+			location: "Event",
+			field:    "Cuisine",
+		},
+		{
+			name:     "bad date",
+			body:     strings.Replace(testEventJSON, "2025-08-29", "29/08/2025", 1),
+			location: "Event",
+			field:    "ISODate",
+		},
+		{
+			name:     "entree without name",
+			body:     strings.Replace(testEventJSON, `"name": "Bruschetta",`, "", 1),
+			location: "Entree [1]",
+			field:    "Name",
+		},
+		{
+			name:     "dressing without allergens",
+			body:     strings.Replace(testEventJSON, `"name": "Balsamic Vinaigrette", "allergens": [],`, `"name": "Balsamic Vinaigrette",`, 1),
+			location: "Salad Bar - Dressing [0]",
+			field:    "Allergens",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repository := memory.NewStorage()
+			rec := serve(t, createEvent(repository, nil), http.MethodPost, "/event", tt.body)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("expected status %d, got %d: %s", http.StatusBadRequest, rec.Code, rec.Body.String())
+			}
+			body := decode[internal_types.FieldErrorResponse](t, rec)
+			if len(body.FieldError) == 0 {
+				t.Fatalf("expected field errors, got none")
+			}
+			if body.FieldError[0].Location != tt.location || body.FieldError[0].Field != tt.field {
+				t.Errorf("expected field error %s/%s, got %+v", tt.location, tt.field, body.FieldError[0])
+			}
+			if events, _ := repository.ListEvents(context.Background()); len(events) != 0 {
+				t.Errorf("expected no stored events, got %d", len(events))
+			}
+		})
+	}
+}
+
+func TestGetFrontPageEvents(t *testing.T) {
+	repository := memory.NewStorage().WithClock(testClock("2025-09-03"))
+	for _, event := range []internal_types.Event{
+		testEvent("Monday", "2025-09-01"),
+		testEvent("Tuesday", "2025-09-02"),
+		testEvent("Wednesday", "2025-09-03"),
+		testEvent("Thursday", "2025-09-04"),
+		testEvent("Friday", "2025-09-05"),
+		testEvent("Monday", "2025-09-08"),
+	} {
+		if _, err := repository.StoreEvent(context.Background(), event); err != nil {
+			t.Fatalf("failed to store event: %v", err)
+		}
+	}
+
+	rec := serve(t, getFrontPageEvents(repository, time.Minute), http.MethodGet, "/front-page-events", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	body := decode[GetFrontPageEventsResponse](t, rec)
+	var dates []string
+	for _, event := range body.Events {
+		dates = append(dates, event.ISODate)
+	}
+	expected := []string{"2025-09-02", "2025-09-03", "2025-09-04", "2025-09-05"}
+	if strings.Join(dates, ",") != strings.Join(expected, ",") {
+		t.Fatalf("expected front page dates %v, got %v", expected, dates)
+	}
+
+	// Foods without allergens are returned with an empty list
+	for _, food := range body.Events[0].EntreesAndSides {
+		if food.Name == "Bruschetta" && (food.Allergens == nil || len(food.Allergens) != 0) {
+			t.Errorf("expected Bruschetta to have no allergens, got %#v", food.Allergens)
+		}
+	}
+	if !strings.Contains(rec.Body.String(), `"allergens":[]`) {
+		t.Errorf("expected empty allergen lists to be encoded as [], got %s", rec.Body.String())
+	}
+}
+
+func TestGetFrontPageEventsOnlyFuture(t *testing.T) {
+	repository := memory.NewStorage().WithClock(testClock("2025-01-01"))
+	for _, isoDate := range []string{"2025-01-06", "2025-01-07"} {
+		if _, err := repository.StoreEvent(context.Background(), testEvent("Monday", isoDate)); err != nil {
+			t.Fatalf("failed to store event: %v", err)
+		}
+	}
+
+	rec := serve(t, getFrontPageEvents(repository, time.Minute), http.MethodGet, "/front-page-events", "")
+	body := decode[GetFrontPageEventsResponse](t, rec)
+	if len(body.Events) != 1 || body.Events[0].ISODate != "2025-01-06" {
+		t.Fatalf("expected only the next event, got %+v", body.Events)
+	}
+}
+
+func TestGetFrontPageEventsEmpty(t *testing.T) {
+	rec := serve(t, getFrontPageEvents(memory.NewStorage(), time.Minute), http.MethodGet, "/front-page-events", "")
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	if strings.TrimSpace(rec.Body.String()) != `{"events":[]}` {
+		t.Errorf("expected an empty event list, got %s", rec.Body.String())
+	}
+}
+
+func TestGetEvent(t *testing.T) {
+	repository := memory.NewStorage()
+	eventID, err := repository.StoreEvent(context.Background(), testEvent("Friday", "2025-08-29"))
+	if err != nil {
+		t.Fatalf("failed to store event: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		id     string
+		status int
+	}{
+		{name: "found", id: eventID.String(), status: http.StatusOK},
+		{name: "not found", id: "00000000-0000-0000-0000-000000000000", status: http.StatusNotFound},
+		{name: "invalid id", id: "not-a-uuid", status: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodGet, "/event/"+tt.id, nil)
+			rec := httptest.NewRecorder()
+			ctx := e.NewContext(req, rec)
+			ctx.SetParamNames("id")
+			ctx.SetParamValues(tt.id)
+
+			if err := getEvent(repository, time.Minute)(ctx); err != nil {
+				t.Fatalf("handler returned an error: %v", err)
+			}
+			if rec.Code != tt.status {
+				t.Fatalf("expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+			if tt.status == http.StatusOK {
+				event := decode[internal_types.StoredEvent](t, rec)
+				if event.ID != eventID || event.ISODate != "2025-08-29" {
+					t.Errorf("unexpected event %+v", event)
+				}
+			}
+			if tt.status == http.StatusNotFound {
+				if body := decode[internal_types.ErrorResponse](t, rec); body.Error != "not found" {
+					t.Errorf("expected error %q, got %q", "not found", body.Error)
+				}
+			}
+		})
+	}
+}
+
+func TestGetMenu(t *testing.T) {
+	repository := memory.NewStorage()
+	if _, err := repository.StoreEvent(context.Background(), testEvent("Friday", "2025-08-29")); err != nil {
+		t.Fatalf("failed to store event: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		date   string
+		status int
+		events int
+	}{
+		{name: "found", date: "2025-08-29", status: http.StatusOK, events: 1},
+		{name: "no event", date: "2025-08-30", status: http.StatusOK, events: 0},
+		{name: "invalid date", date: "29-08-2025", status: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodGet, "/menu/"+tt.date, nil)
+			rec := httptest.NewRecorder()
+			ctx := e.NewContext(req, rec)
+			ctx.SetParamNames("date")
+			ctx.SetParamValues(tt.date)
+
+			if err := getMenu(repository, time.Minute)(ctx); err != nil {
+				t.Fatalf("handler returned an error: %v", err)
+			}
+			if rec.Code != tt.status {
+				t.Fatalf("expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+			if tt.status == http.StatusOK {
+				body := decode[map[string][]internal_types.StoredEvent](t, rec)
+				if events, ok := body["events"]; !ok || len(events) != tt.events {
+					t.Errorf("expected %d events, got %s", tt.events, rec.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestListEvents(t *testing.T) {
+	repository := memory.NewStorage()
+	for _, isoDate := range []string{"2025-09-03", "2025-08-29"} {
+		if _, err := repository.StoreEvent(context.Background(), testEvent("Friday", isoDate)); err != nil {
+			t.Fatalf("failed to store event: %v", err)
+		}
+	}
+
+	rec := serve(t, listEvents(repository, time.Minute), http.MethodGet, "/events", "")
+	body := decode[map[string][]internal_types.StoredEvent](t, rec)
+	if len(body["events"]) != 2 || body["events"][0].ISODate != "2025-08-29" {
+		t.Fatalf("expected 2 events ordered by date, got %+v", body["events"])
+	}
+}
+
+func TestConditionalRequests(t *testing.T) {
+	stored := time.Date(2025, 8, 28, 9, 30, 15, 500, time.UTC)
+	repository := memory.NewStorage().WithClock(func() time.Time { return stored })
+	if _, err := repository.StoreEvent(context.Background(), testEvent("Friday", "2025-08-29")); err != nil {
+		t.Fatalf("failed to store event: %v", err)
+	}
+
+	get := func(t *testing.T, header http.Header) *httptest.ResponseRecorder {
+		t.Helper()
+
+		req := httptest.NewRequest(http.MethodGet, "/events", nil)
+		req.Header = header
+		rec := httptest.NewRecorder()
+		if err := listEvents(repository, time.Minute)(echo.New().NewContext(req, rec)); err != nil {
+			t.Fatalf("handler returned an error: %v", err)
+		}
+		return rec
+	}
+
+	first := get(t, http.Header{})
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" {
+		t.Fatalf("expected a 200 with an ETag, got %d and %q", first.Code, etag)
+	}
+	if got := first.Header().Get(echo.HeaderLastModified); got != "Thu, 28 Aug 2025 09:30:15 GMT" {
+		t.Errorf("expected Last-Modified to be the update time, got %q", got)
+	}
+	if got := first.Header().Get(echo.HeaderCacheControl); got != "public, max-age=60" {
+		t.Errorf("unexpected Cache-Control %q", got)
+	}
+
+	tests := []struct {
+		name   string
+		header http.Header
+		status int
+	}{
+		{name: "matching etag", header: http.Header{"If-None-Match": {etag}}, status: http.StatusNotModified},
+		{name: "weak etag from a cdn", header: http.Header{"If-None-Match": {`"other", W/` + etag}}, status: http.StatusNotModified},
+		{name: "any etag", header: http.Header{"If-None-Match": {"*"}}, status: http.StatusNotModified},
+		{name: "changed etag", header: http.Header{"If-None-Match": {`"other"`}}, status: http.StatusOK},
+		{name: "not modified since", header: http.Header{"If-Modified-Since": {"Thu, 28 Aug 2025 09:30:15 GMT"}}, status: http.StatusNotModified},
+		{name: "modified since", header: http.Header{"If-Modified-Since": {"Thu, 28 Aug 2025 09:30:14 GMT"}}, status: http.StatusOK},
+		{
+			name:   "etag takes precedence",
+			header: http.Header{"If-None-Match": {`"other"`}, "If-Modified-Since": {"Thu, 28 Aug 2025 09:30:15 GMT"}},
+			status: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := get(t, tt.header)
+			if rec.Code != tt.status {
+				t.Fatalf("expected status %d, got %d", tt.status, rec.Code)
+			}
+			if rec.Code == http.StatusNotModified && rec.Body.Len() != 0 {
+				t.Errorf("expected an empty 304 body, got %q", rec.Body.String())
+			}
+			if got := rec.Header().Get("ETag"); got != etag {
+				t.Errorf("expected ETag %s, got %s", etag, got)
+			}
+		})
+	}
+
+	t.Run("new event", func(t *testing.T) {
+		stored = stored.Add(time.Hour)
+		if _, err := repository.StoreEvent(context.Background(), testEvent("Monday", "2025-09-01")); err != nil {
+			t.Fatalf("failed to store event: %v", err)
+		}
+
+		rec := get(t, http.Header{"If-None-Match": {etag}})
+		if rec.Code != http.StatusOK || rec.Header().Get("ETag") == etag {
+			t.Errorf("expected a 200 with a new ETag, got %d and %s", rec.Code, rec.Header().Get("ETag"))
+		}
+	})
+}
+
+// failingRepository fails every call with err.
+type failingRepository struct {
+	err error
+}
+
+func (r failingRepository) StoreEvent(context.Context, internal_types.Event) (uuid.UUID, error) {
+	return uuid.Nil, r.err
+}
+
+func (r failingRepository) GetEvent(context.Context, uuid.UUID) (internal_types.StoredEvent, error) {
+	return internal_types.StoredEvent{}, r.err
+}
+
+func (r failingRepository) ListEvents(context.Context) ([]internal_types.StoredEvent, error) {
+	return nil, r.err
+}
+
+func (r failingRepository) GetEventsByDate(context.Context, string) ([]internal_types.StoredEvent, error) {
+	return nil, r.err
+}
+
+func (r failingRepository) GetFrontPageEvents(context.Context) ([]internal_types.StoredEvent, error) {
+	return nil, r.err
+}
+
+func TestStorageErrorStatuses(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		status     int
+		retryAfter string
+	}{
+		{name: "transient", err: &storage.Error{Kind: storage.ErrTransient, Op: "store event", Err: errors.New("connection reset")}, status: http.StatusServiceUnavailable, retryAfter: "1"},
+		{name: "conflict", err: &storage.Error{Kind: storage.ErrConflict, Op: "store event", Err: errors.New("duplicate key")}, status: http.StatusConflict},
+		{name: "validation", err: &storage.Error{Kind: storage.ErrValidation, Op: "store event", Err: errors.New("invalid date")}, status: http.StatusBadRequest},
+		{name: "unknown", err: errors.New("pq: relation \"dogdish.event\" does not exist"), status: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repository := failingRepository{err: tt.err}
+			for _, rec := range []*httptest.ResponseRecorder{
+				serve(t, createEvent(repository, nil), http.MethodPost, "/event", testEventJSON),
+				serve(t, listEvents(repository, time.Minute), http.MethodGet, "/events", ""),
+				serve(t, getFrontPageEvents(repository, time.Minute), http.MethodGet, "/front-page-events", ""),
+			} {
+				if rec.Code != tt.status {
+					t.Errorf("expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+				}
+				if got := rec.Header().Get("Retry-After"); got != tt.retryAfter {
+					t.Errorf("expected Retry-After %q, got %q", tt.retryAfter, got)
+				}
+				if got := rec.Header().Get(echo.HeaderCacheControl); got != "no-store" {
+					t.Errorf("expected errors not to be cached, got Cache-Control %q", got)
+				}
+				if strings.Contains(rec.Body.String(), tt.err.Error()) {
+					t.Errorf("expected the database error to stay out of the response, got %s", rec.Body.String())
+				}
+			}
+		})
+	}
+}
+
+// openTestStorages returns a migrated SQLite storage and, when DH_TEST_DB_HOST
+// is set, a Postgres storage configured like the storage package tests.
+func openTestStorages(t *testing.T) map[string]*storage.Storage {
+	t.Helper()
+
+	sqliteStorage := storage.NewStorage().
+		WithDBType(storage.DBTypeSQLite).
+		WithDatabase(filepath.Join(t.TempDir(), "dogdish.db"))
+	if err := sqliteStorage.Open(); err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+	t.Cleanup(func() { sqliteStorage.Close() })
+	db, _ := sqliteStorage.GetDBConnection()
+	if _, err := migrations.Up(context.Background(), db, storage.DBTypeSQLite); err != nil {
+		t.Fatalf("failed to apply migrations: %v", err)
+	}
+	storages := map[string]*storage.Storage{"sqlite": sqliteStorage}
+
+	host := os.Getenv("DH_TEST_DB_HOST")
+	if host == "" {
+		return storages
+	}
+	postgresStorage := storage.NewStorage().WithHost(host)
+	if user := os.Getenv("DH_TEST_DB_USER"); user != "" {
+		postgresStorage = postgresStorage.WithUser(user)
+	}
+	if password := os.Getenv("DH_TEST_DB_PASS"); password != "" {
+		postgresStorage = postgresStorage.WithPassword(password)
+	}
+	if database := os.Getenv("DH_TEST_DB_NAME"); database != "" {
+		postgresStorage = postgresStorage.WithDatabase(database)
+	}
+	if port, err := strconv.Atoi(os.Getenv("DH_TEST_DB_PORT")); err == nil {
+		postgresStorage = postgresStorage.WithPort(uint(port))
+	}
+	if err := postgresStorage.Open(); err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+	t.Cleanup(func() {
+		db, _ := postgresStorage.GetDBConnection()
+		db.Exec("TRUNCATE dogdish.event, dogdish.cuisine, dogdish.allergen CASCADE")
+		postgresStorage.Close()
+	})
+	storages["postgres"] = postgresStorage
+	return storages
+}
+
+func TestCreateEventConcurrentAllergens(t *testing.T) {
+	const requests = 20
+
+	for name, s := range openTestStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			e := echo.New()
+			e.POST("/event", createEvent(s, nil))
+			server := httptest.NewServer(e)
+			defer server.Close()
+
+			// Every request shares the same allergens with a different
+			// spelling, and a cuisine that only some requests share
+			var wg sync.WaitGroup
+			statuses := make([]int, requests)
+			for ix := range requests {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+
+					body := testEventJSON
+					body = strings.Replace(body, `"Italian"`, fmt.Sprintf(`"Cuisine %d"`, ix%3), 1)
+					if ix%2 == 0 {
+						body = strings.ReplaceAll(body, `"gluten"`, `"Gluten"`)
+						body = strings.ReplaceAll(body, `"dairy"`, `" dairy "`)
+					}
+					resp, err := http.Post(server.URL+"/event", echo.MIMEApplicationJSON, strings.NewReader(body))
+					if err != nil {
+						t.Errorf("request %d failed: %v", ix, err)
+						return
+					}
+					resp.Body.Close()
+					statuses[ix] = resp.StatusCode
+				}()
+			}
+			wg.Wait()
+
+			for ix, status := range statuses {
+				if status != http.StatusOK {
+					t.Errorf("request %d: expected status %d, got %d", ix, http.StatusOK, status)
+				}
+			}
+
+			db, _ := s.GetDBConnection()
+			var allergens, cuisines, events int
+			err := db.QueryRow(`SELECT
+				(SELECT COUNT(*) FROM allergen),
+				(SELECT COUNT(*) FROM cuisine),
+				(SELECT COUNT(*) FROM event)`).Scan(&allergens, &cuisines, &events)
+			if err != nil {
+				t.Fatalf("failed to count rows: %v", err)
+			}
+			if allergens != 3 || cuisines != 3 || events != requests {
+				t.Errorf("expected 3 allergens, 3 cuisines and %d events, got %d, %d and %d", requests, allergens, cuisines, events)
+			}
+		})
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		expected string
+	}{
+		{name: "propagated", header: "abc-123", expected: "abc-123"},
+		{name: "generated"},
+		{name: "control characters replaced", header: "abc\n{\"level\":\"error\"}"},
+		{name: "too long replaced", header: strings.Repeat("a", maxRequestIDLength+1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen string
+			handler := requestID()(func(ctx echo.Context) error {
+				seen = logging.RequestID(ctx.Request().Context())
+				return ctx.NoContent(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/events", nil)
+			if tt.header != "" {
+				req.Header.Set(echo.HeaderXRequestID, tt.header)
+			}
+			rec := httptest.NewRecorder()
+			if err := handler(echo.New().NewContext(req, rec)); err != nil {
+				t.Fatalf("handler returned an error: %v", err)
+			}
+
+			returned := rec.Header().Get(echo.HeaderXRequestID)
+			if returned != seen {
+				t.Errorf("expected the response to carry the logged request id %q, got %q", seen, returned)
+			}
+			if tt.expected != "" && returned != tt.expected {
+				t.Errorf("expected request id %q, got %q", tt.expected, returned)
+			}
+			if tt.expected == "" && uuid.Validate(returned) != nil {
+				t.Errorf("expected a generated uuid, got %q", returned)
+			}
+		})
+	}
+}
+
+func TestRequireScopeAPIKey(t *testing.T) {
+	keys := memory.NewStorage()
+	ctx := context.Background()
+	readKey, err := newAPIKey(ctx, keys, "reader", auth.ScopeRead)
+	if err != nil {
+		t.Fatalf("failed to create api key: %v", err)
+	}
+	writeKey, err := newAPIKey(ctx, keys, "pdf_handler", auth.ScopeWrite)
+	if err != nil {
+		t.Fatalf("failed to create api key: %v", err)
+	}
+	revokedKey, err := newAPIKey(ctx, keys, "revoked", auth.ScopeAdmin)
+	if err != nil {
+		t.Fatalf("failed to create api key: %v", err)
+	}
+	if err := keys.RevokeAPIKey(ctx, revokedKey.ID); err != nil {
+		t.Fatalf("failed to revoke api key: %v", err)
+	}
+	unknownKey, _ := auth.GenerateKey()
+
+	tests := []struct {
+		name   string
+		key    string
+		status int
+		error  string
+	}{
+		{name: "missing", status: http.StatusUnauthorized, error: "missing api key or bearer token"},
+		{name: "malformed", key: "not-a-key", status: http.StatusUnauthorized, error: "invalid api key"},
+		{name: "unknown", key: unknownKey, status: http.StatusUnauthorized, error: "invalid api key"},
+		{name: "revoked", key: revokedKey.Key, status: http.StatusUnauthorized, error: "invalid api key"},
+		{name: "insufficient scope", key: readKey.Key, status: http.StatusForbidden, error: "api key lacks the write scope"},
+		{name: "allowed", key: writeKey.Key, status: http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var authenticated auth.Principal
+			handler := requireScope(keys, nil, auth.ScopeWrite)(func(ctx echo.Context) error {
+				authenticated, _ = principalOf(ctx)
+				return ctx.NoContent(http.StatusNoContent)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/event", nil)
+			if tt.key != "" {
+				req.Header.Set(headerAPIKey, tt.key)
+			}
+			rec := httptest.NewRecorder()
+			if err := handler(echo.New().NewContext(req, rec)); err != nil {
+				t.Fatalf("handler returned an error: %v", err)
+			}
+
+			if rec.Code != tt.status {
+				t.Fatalf("expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+			if tt.error != "" {
+				if body := decode[internal_types.ErrorResponse](t, rec); body.Error != tt.error {
+					t.Errorf("expected error %q, got %q", tt.error, body.Error)
+				}
+				return
+			}
+			expected := auth.Principal{Method: auth.MethodAPIKey, Subject: writeKey.ID.String(), Name: "pdf_handler", Scope: auth.ScopeWrite}
+			if fmt.Sprint(authenticated) != fmt.Sprint(expected) {
+				t.Errorf("expected the handler to see %+v, got %+v", expected, authenticated)
+			}
+		})
+	}
+}
+
+func TestAdminAPIKeys(t *testing.T) {
+	keys := memory.NewStorage()
+	admin, err := newAPIKey(context.Background(), keys, "admin", auth.ScopeAdmin)
+	if err != nil {
+		t.Fatalf("failed to create api key: %v", err)
+	}
+
+	e := echo.New()
+	group := e.Group("/admin", requireScope(keys, nil, auth.ScopeAdmin))
+	group.GET("/api-keys", listAPIKeys(keys))
+	group.POST("/api-keys", createAPIKey(keys))
+	group.DELETE("/api-keys/:id", revokeAPIKey(keys))
+	request := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(headerAPIKey, admin.Key)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := request(http.MethodPost, "/admin/api-keys", `{"name": "pdf_handler", "scope": "owner"}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d for an unknown scope, got %d: %s", http.StatusBadRequest, rec.Code, rec.Body.String())
+	}
+
+	rec = request(http.MethodPost, "/admin/api-keys", `{"name": "pdf_handler", "scope": "write"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get(echo.HeaderCacheControl) != "no-store" {
+		t.Errorf("expected the created key not to be cached")
+	}
+	created := decode[internal_types.CreateAPIKeyResponse](t, rec)
+	if !auth.LooksLikeKey(created.Key) || created.Scope != "write" || created.Prefix != auth.DisplayPrefix(created.Key) {
+		t.Errorf("unexpected created api key %+v", created)
+	}
+
+	rec = request(http.MethodGet, "/admin/api-keys", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	if strings.Contains(rec.Body.String(), created.Key) {
+		t.Errorf("expected the listing not to contain the key")
+	}
+	listed := decode[map[string][]internal_types.APIKey](t, rec)["api_keys"]
+	if len(listed) != 2 {
+		t.Errorf("expected 2 api keys, got %+v", listed)
+	}
+
+	rec = request(http.MethodDelete, "/admin/api-keys/"+created.ID.String(), "")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusNoContent, rec.Code, rec.Body.String())
+	}
+	if _, err := keys.AuthenticateAPIKey(context.Background(), auth.HashKey(created.Key)); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected the revoked key to be rejected, got %v", err)
+	}
+
+	rec = request(http.MethodDelete, "/admin/api-keys/"+uuid.NewString(), "")
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected status %d for an unknown key, got %d", http.StatusNotFound, rec.Code)
+	}
+	rec = request(http.MethodDelete, "/admin/api-keys/not-a-uuid", "")
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d for an invalid id, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
+
+// signToken returns an ES256 token with claims, verified by the JWKS file
+// it writes to path.
+func signToken(t *testing.T, key *ecdsa.PrivateKey, path string, claims map[string]any) string {
+	t.Helper()
+
+	encode := base64.RawURLEncoding.EncodeToString
+	jwks, _ := json.Marshal(map[string]any{"keys": []map[string]string{{
+		"kty": "EC", "kid": "test", "crv": "P-256", "use": "sig",
+		"x": encode(key.X.FillBytes(make([]byte, 32))), "y": encode(key.Y.FillBytes(make([]byte, 32))),
+	}}})
+	if err := os.WriteFile(path, jwks, 0o600); err != nil {
+		t.Fatalf("failed to write jwks: %v", err)
+	}
+
+	header, _ := json.Marshal(map[string]string{"alg": "ES256", "kid": "test"})
+	payload, _ := json.Marshal(claims)
+	signed := encode(header) + "." + encode(payload)
+	digest := sha256.Sum256([]byte(signed))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return signed + "." + encode(append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...))
+}
+
+func TestRequireScopeBearer(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	token := func(roles ...string) string {
+		return signToken(t, key, path, map[string]any{
+			"iss":   "https://login.example.com",
+			"aud":   "dogdish",
+			"sub":   "user-1",
+			"email": "chef@example.com",
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"roles": roles,
+		})
+	}
+	editor, viewer := token("editor"), token("viewer")
+
+	c := config.Default()
+	c.OIDCIssuer, c.OIDCAudience, c.OIDCJWKSFile = "https://login.example.com", "dogdish", path
+	tokens, _, err := newTokenVerifier(context.Background(), c)
+	if err != nil {
+		t.Fatalf("failed to load the token verifier: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		tokens        *auth.Verifier
+		authorization string
+		status        int
+		error         string
+	}{
+		{name: "editor", tokens: tokens, authorization: "Bearer " + editor, status: http.StatusNoContent},
+		{name: "scheme case-insensitive", tokens: tokens, authorization: "bearer " + editor, status: http.StatusNoContent},
+		{name: "viewer", tokens: tokens, authorization: "Bearer " + viewer, status: http.StatusForbidden, error: "token lacks the editor role"},
+		{name: "invalid", tokens: tokens, authorization: "Bearer " + editor[:len(editor)-4], status: http.StatusUnauthorized, error: "invalid bearer token"},
+		{name: "missing", tokens: tokens, status: http.StatusUnauthorized, error: "missing api key or bearer token"},
+		{name: "not configured", authorization: "Bearer " + editor, status: http.StatusUnauthorized, error: "bearer tokens are not accepted"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var authenticated auth.Principal
+			handler := requireScope(memory.NewStorage(), tt.tokens, auth.ScopeWrite)(func(ctx echo.Context) error {
+				authenticated, _ = principalOf(ctx)
+				return ctx.NoContent(http.StatusNoContent)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/event", nil)
+			if tt.authorization != "" {
+				req.Header.Set(echo.HeaderAuthorization, tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			if err := handler(echo.New().NewContext(req, rec)); err != nil {
+				t.Fatalf("handler returned an error: %v", err)
+			}
+
+			if rec.Code != tt.status {
+				t.Fatalf("expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+			if tt.error != "" {
+				if body := decode[internal_types.ErrorResponse](t, rec); body.Error != tt.error {
+					t.Errorf("expected error %q, got %q", tt.error, body.Error)
+				}
+				if tt.status == http.StatusUnauthorized && tt.tokens != nil && !strings.HasPrefix(rec.Header().Get(echo.HeaderWWWAuthenticate), "Bearer") {
+					t.Errorf("expected a Bearer challenge, got %q", rec.Header().Get(echo.HeaderWWWAuthenticate))
+				}
+				return
+			}
+			if authenticated.Method != auth.MethodBearer || authenticated.Subject != "user-1" || authenticated.Name != "chef@example.com" {
+				t.Errorf("unexpected principal %+v", authenticated)
+			}
+		})
+	}
+}
+
+func TestMatchOrigin(t *testing.T) {
+	tests := []struct {
+		pattern string
+		origin  string
+		match   bool
+	}{
+		{"*", "https://anything.example.com", true},
+		{"https://dogdish.cc", "https://dogdish.cc", true},
+		{"https://dogdish.cc", "http://dogdish.cc", false},
+		{"https://dogdish.cc", "https://dogdish.cc:8443", false},
+		{"https://*.dogdish.cc", "https://admin.dogdish.cc", true},
+		{"https://*.dogdish.cc", "https://Admin.DogDish.cc", true},
+		{"https://*.dogdish.cc", "https://dogdish.cc", false},
+		{"https://*.dogdish.cc", "https://a.b.dogdish.cc", false},
+		{"https://*.dogdish.cc", "https://evil-dogdish.cc", false},
+		{"https://*.dogdish.cc", "https://admin.dogdish.cc.evil.com", false},
+		{"https://*.dogdish.cc", "http://admin.dogdish.cc", false},
+		{"https://*.dogdish.cc", "https://admin.dogdish.cc/path", false},
+		{"http://*.localhost:3000", "http://app.localhost:3000", true},
+		{"http://*.localhost:3000", "http://app.localhost:3001", false},
+	}
+	for _, tt := range tests {
+		if match := matchOrigin(tt.pattern, tt.origin); match != tt.match {
+			t.Errorf("expected matchOrigin(%q, %q) to be %t", tt.pattern, tt.origin, tt.match)
+		}
+	}
+}
+
+func TestCORSPolicies(t *testing.T) {
+	c := config.Default()
+	c.CORSAdminOrigins = []string{"https://*.dogdish.cc"}
+
+	e := echo.New()
+	e.Use(corsPolicies(c, func(route string) bool {
+		return route == "/event" || strings.HasPrefix(route, "/admin/")
+	}))
+	ok := func(ctx echo.Context) error { return ctx.NoContent(http.StatusOK) }
+	e.GET("/events", ok)
+	e.POST("/event", ok)
+	e.GET("/admin/api-keys", ok)
+
+	tests := []struct {
+		name          string
+		method        string
+		target        string
+		origin        string
+		requestMethod string
+		allowOrigin   string
+		allowMethods  string
+	}{
+		{name: "read from any origin", method: http.MethodGet, target: "/events", origin: "https://example.com", allowOrigin: "*"},
+		{name: "read preflight", method: http.MethodOptions, target: "/events", origin: "https://example.com", requestMethod: http.MethodGet, allowOrigin: "*", allowMethods: "GET,HEAD"},
+		{name: "write preflight from the admin origin", method: http.MethodOptions, target: "/event", origin: "https://admin.dogdish.cc", requestMethod: http.MethodPost, allowOrigin: "https://admin.dogdish.cc", allowMethods: "GET,POST,DELETE"},
+		{name: "write preflight from another origin", method: http.MethodOptions, target: "/event", origin: "https://example.com", requestMethod: http.MethodPost},
+		{name: "admin read from another origin", method: http.MethodGet, target: "/admin/api-keys", origin: "https://example.com"},
+		{name: "admin read from the admin origin", method: http.MethodGet, target: "/admin/api-keys", origin: "https://admin.dogdish.cc", allowOrigin: "https://admin.dogdish.cc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			req.Header.Set(echo.HeaderOrigin, tt.origin)
+			if tt.requestMethod != "" {
+				req.Header.Set(echo.HeaderAccessControlRequestMethod, tt.requestMethod)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if allowOrigin := rec.Header().Get(echo.HeaderAccessControlAllowOrigin); allowOrigin != tt.allowOrigin {
+				t.Errorf("expected Access-Control-Allow-Origin %q, got %q", tt.allowOrigin, allowOrigin)
+			}
+			if allowMethods := rec.Header().Get(echo.HeaderAccessControlAllowMethods); allowMethods != tt.allowMethods {
+				t.Errorf("expected Access-Control-Allow-Methods %q, got %q", tt.allowMethods, allowMethods)
+			}
+		})
+	}
+}
+
+type failingLimiter struct{}
+
+func (failingLimiter) Take(context.Context, string, ratelimit.Budget) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("connection refused")
+}
+
+func TestRateLimit(t *testing.T) {
+	keys := memory.NewStorage()
+	first, err := newAPIKey(context.Background(), keys, "pdf_handler", auth.ScopeWrite)
+	if err != nil {
+		t.Fatalf("failed to create api key: %v", err)
+	}
+	second, err := newAPIKey(context.Background(), keys, "menu_importer", auth.ScopeWrite)
+	if err != nil {
+		t.Fatalf("failed to create api key: %v", err)
+	}
+
+	e := echo.New()
+	e.IPExtractor = echo.ExtractIPFromXFFHeader()
+	limiter := ratelimit.NewMemory()
+	limit := rateLimit(limiter, ratelimit.PerMinute("reads", 60, 3), ratelimit.PerMinute("writes", 60, 2), nil)
+	authentication := ratelimit.PerMinute("authentication", 60, 2)
+	limitAuth := rateLimit(limiter, authentication, authentication, nil)
+	ok := func(ctx echo.Context) error { return ctx.NoContent(http.StatusOK) }
+	e.GET("/events", ok, limit)
+	e.POST("/event", ok, requireScope(keys, nil, auth.ScopeWrite), limit)
+
+	request := func(method, target, remoteAddr string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		req.RemoteAddr = remoteAddr
+		for key, value := range header {
+			req.Header.Set(key, value)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Writes are limited by api key, whatever the IP
+	for i, remoteAddr := range []string{"203.0.113.1:1234", "203.0.113.2:1234"} {
+		rec := request(http.MethodPost, "/event", remoteAddr, map[string]string{headerAPIKey: first.Key})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("write %d: expected status 200, got %d", i+1, rec.Code)
+		}
+		if limit, remaining := rec.Header().Get(headerRateLimitLimit), rec.Header().Get(headerRateLimitRemaining); limit != "2" || remaining != strconv.Itoa(1-i) {
+			t.Errorf("write %d: unexpected RateLimit-Limit %q and RateLimit-Remaining %q", i+1, limit, remaining)
+		}
+	}
+	rec := request(http.MethodPost, "/event", "203.0.113.3:1234", map[string]string{headerAPIKey: first.Key})
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status 429 once the burst is spent, got %d", rec.Code)
+	}
+	if body := decode[internal_types.ErrorResponse](t, rec); body.Error != "rate limit exceeded" {
+		t.Errorf("unexpected error %q", body.Error)
+	}
+	if retryAfter := rec.Header().Get(echo.HeaderRetryAfter); retryAfter != "1" {
+		t.Errorf("expected Retry-After 1, got %q", retryAfter)
+	}
+	if reset := rec.Header().Get(headerRateLimitReset); reset != "2" {
+		t.Errorf("expected RateLimit-Reset 2, got %q", reset)
+	}
+	if rec := request(http.MethodPost, "/event", "203.0.113.3:1234", map[string]string{headerAPIKey: second.Key}); rec.Code != http.StatusOK {
+		t.Errorf("expected another api key not to be limited, got %d", rec.Code)
+	}
+
+	// Reads are limited by IP, a forwarded IP is only trusted from a proxy
+	for range 3 {
+		request(http.MethodGet, "/events", "203.0.113.1:1234", nil)
+	}
+	if rec := request(http.MethodGet, "/events", "203.0.113.1:1234", map[string]string{echo.HeaderXForwardedFor: "198.51.100.7"}); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("expected a spoofed X-Forwarded-For to be ignored, got %d", rec.Code)
+	}
+	if rec := request(http.MethodGet, "/events", "10.0.0.2:1234", map[string]string{echo.HeaderXForwardedFor: "198.51.100.7"}); rec.Code != http.StatusOK {
+		t.Errorf("expected the client behind the proxy to have its own budget, got %d", rec.Code)
+	}
+
+	// Failed authentication is limited by IP before the key is looked up
+	e.POST("/admin/api-keys", ok, limitAuth, requireScope(keys, nil, auth.ScopeAdmin), limit)
+	for i := range 2 {
+		if rec := request(http.MethodPost, "/admin/api-keys", "203.0.113.4:1234", map[string]string{headerAPIKey: "bogus"}); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: expected status 401, got %d", i+1, rec.Code)
+		}
+	}
+	rec = request(http.MethodPost, "/admin/api-keys", "203.0.113.4:1234", map[string]string{headerAPIKey: "bogus"})
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status 429 after repeated failed authentication, got %d", rec.Code)
+	}
+	if rec := request(http.MethodPost, "/admin/api-keys", "203.0.113.4:1234", nil); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("expected a request without credentials to be limited too, got %d", rec.Code)
+	}
+	if rec := request(http.MethodPost, "/admin/api-keys", "203.0.113.5:1234", map[string]string{headerAPIKey: "bogus"}); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected another IP not to be limited, got %d", rec.Code)
+	}
+
+	// A failing limiter lets requests through
+	handler := rateLimit(failingLimiter{}, ratelimit.PerMinute("reads", 60, 3), ratelimit.PerMinute("writes", 60, 2), nil)(ok)
+	rec = httptest.NewRecorder()
+	if err := handler(echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/events", nil), rec)); err != nil || rec.Code != http.StatusOK {
+		t.Errorf("expected the request to go through, got %d, %v", rec.Code, err)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/config"
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/migrations"
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/storage"
+	log "github.com/sirupsen/logrus"
+)
+
+const usage = `Usage:
+  database_handler [settings]                   start the HTTP server
+  database_handler [settings] migrate up        apply all pending migrations
+  database_handler [settings] migrate down      roll back the latest migration
+  database_handler [settings] migrate status    list migrations and whether they are applied
+  database_handler [settings] config print      show the effective settings, secrets redacted
+  database_handler [settings] apikey create NAME SCOPE
+                                                create an API key with the read, write or admin scope
+  database_handler [settings] apikey list       list the API keys
+  database_handler [settings] apikey revoke ID  revoke an API key
+
+The Postgres migrations create the application user, so DATABASE_USER and
+DATABASE_PASSWORD must be set when running them.
+
+Every setting can be given as a flag, an environment variable or a key in the
+config file, in that order of precedence:
+`
+
+func printUsage(w io.Writer) {
+	fmt.Fprint(w, usage)
+	config.Usage(w)
+}
+
+// runMigrate runs a migrate subcommand and returns the process exit code.
+func runMigrate(s *storage.Storage, args []string) int {
+	if len(args) != 1 {
+		printUsage(os.Stderr)
+		return 2
+	}
+
+	if err := s.Open(); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to open storage: %v\n", err)
+		return 1
+	}
+	defer s.Close()
+
+	db, err := s.GetDBConnection()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to get db connection: %v\n", err)
+		return 1
+	}
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		results, err := migrations.Up(ctx, db, s.DBType())
+		for _, result := range results {
+			fmt.Printf("applied %s (%s)\n", result.Source.Path, result.Duration.Round(time.Millisecond))
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to apply migrations: %v\n", err)
+			return 1
+		}
+		if len(results) == 0 {
+			fmt.Println("no pending migrations")
+		}
+	case "down":
+		result, err := migrations.Down(ctx, db, s.DBType())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to roll back migration: %v\n", err)
+			return 1
+		}
+		fmt.Printf("rolled back %s (%s)\n", result.Source.Path, result.Duration.Round(time.Millisecond))
+	case "status":
+		statuses, err := migrations.Status(ctx, db, s.DBType())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to get migration status: %v\n", err)
+			return 1
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tMIGRATION\tSTATE\tAPPLIED AT")
+		for _, status := range statuses {
+			appliedAt := "-"
+			if !status.AppliedAt.IsZero() {
+				appliedAt = status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", status.Source.Version, status.Source.Path, status.State, appliedAt)
+		}
+		w.Flush()
+	default:
+		fmt.Fprintf(os.Stderr, "unknown migrate command %q\n\n", args[0])
+		printUsage(os.Stderr)
+		return 2
+	}
+
+	return 0
+}
+
+// runConfig runs a config subcommand and returns the process exit code.
+func runConfig(c *config.Config, args []string) int {
+	if len(args) != 1 || args[0] != "print" {
+		printUsage(os.Stderr)
+		return 2
+	}
+
+	if err := c.Print(os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to print config: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// checkSchema verifies the database schema version matches the embedded
+// migrations. A mismatch is only returned as an error in strict mode.
+func checkSchema(c *config.Config, s *storage.Storage) error {
+	if c.SchemaCheck == config.SchemaCheckOff {
+		return nil
+	}
+
+	db, err := s.GetDBConnection()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err = migrations.Check(ctx, db, s.DBType())
+	if err == nil {
+		log.Info("database schema is up to date")
+		return nil
+	}
+	if c.SchemaCheck == config.SchemaCheckWarn && errors.Is(err, migrations.ErrSchemaMismatch) {
+		log.WithError(err).Warn("database schema does not match the embedded migrations")
+		return nil
+	}
+	return err
+}
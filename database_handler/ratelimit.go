@@ -0,0 +1,92 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/config"
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/internal_types"
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/metrics"
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/ratelimit"
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/storage"
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	headerRateLimitLimit     = "RateLimit-Limit"
+	headerRateLimitRemaining = "RateLimit-Remaining"
+	headerRateLimitReset     = "RateLimit-Reset"
+)
+
+// newRateLimiter returns the limiter of the configured backend, or nil when
+// rate limiting is off. The shared limiter is also returned so its idle
+// buckets can be swept.
+func newRateLimiter(c *config.Config, s *storage.Storage) (ratelimit.Limiter, *ratelimit.Shared) {
+	switch c.RateLimitBackend {
+	case config.RateLimitMemory:
+		return ratelimit.NewMemory(), nil
+	case config.RateLimitPostgres:
+		shared := ratelimit.NewShared(s)
+		return shared, shared
+	default:
+		return nil, nil
+	}
+}
+
+// rateLimit takes a token from the reads budget of the client for GET and
+// HEAD requests and from the writes budget for the others, and rejects the
+// request once the budget is spent. Authenticated clients are limited by
+// key or token subject, so it must run after requireScope on those routes,
+// and the others by IP. Run before requireScope it limits by IP, which
+// throttles the requests that fail to authenticate. A limiter that fails
+// lets the request through.
+func rateLimit(limiter ratelimit.Limiter, reads, writes ratelimit.Budget, m *metrics.Metrics) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		if limiter == nil {
+			return next
+		}
+		return func(ctx echo.Context) error {
+			budget := writes
+			if method := ctx.Request().Method; method == http.MethodGet || method == http.MethodHead {
+				budget = reads
+			}
+			if !budget.Enabled() {
+				return next(ctx)
+			}
+
+			client := "ip:" + ctx.RealIP()
+			if principal, ok := principalOf(ctx); ok {
+				client = principal.Method + ":" + principal.Subject
+			}
+			result, err := limiter.Take(ctx.Request().Context(), client, budget)
+			if err != nil {
+				requestLog(ctx).WithError(err).Warn("failed to check the rate limit, letting the request through")
+				return next(ctx)
+			}
+
+			header := ctx.Response().Header()
+			header.Set(headerRateLimitLimit, strconv.Itoa(result.Limit))
+			header.Set(headerRateLimitRemaining, strconv.Itoa(result.Remaining))
+			header.Set(headerRateLimitReset, ceilSeconds(result.Reset))
+			if !result.Allowed {
+				requestLog(ctx).WithFields(log.Fields{"budget": budget.Name, "retry_after": result.RetryAfter}).Warn("rate limited")
+				m.RateLimited(budget.Name)
+				header.Set(echo.HeaderRetryAfter, ceilSeconds(max(result.RetryAfter, time.Second)))
+				header.Set(echo.HeaderCacheControl, "no-store")
+				return ctx.JSON(http.StatusTooManyRequests, internal_types.ErrorResponse{
+					Error: "rate limit exceeded",
+				})
+			}
+			return next(ctx)
+		}
+	}
+}
+
+// ceilSeconds formats d as whole seconds, rounded up so clients never come
+// back too early.
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
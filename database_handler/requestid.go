@@ -0,0 +1,51 @@
+package main
+
+import (
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/logging"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+// maxRequestIDLength bounds the X-Request-ID accepted from clients.
+const maxRequestIDLength = 128
+
+// requestID takes the X-Request-ID of the request, or generates one, echoes
+// it in the response and adds it to the request context for logging.
+func requestID() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			id := ctx.Request().Header.Get(echo.HeaderXRequestID)
+			if !validRequestID(id) {
+				id = uuid.NewString()
+			}
+
+			ctx.Response().Header().Set(echo.HeaderXRequestID, id)
+			ctx.SetRequest(ctx.Request().WithContext(logging.WithRequestID(ctx.Request().Context(), id)))
+			return next(ctx)
+		}
+	}
+}
+
+// validRequestID rejects IDs that would let a client forge log lines.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range []byte(id) {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// requestLog returns a logger for the request, carrying its ID, client IP
+// and, once authenticated, its caller for auditing.
+func requestLog(ctx echo.Context) *log.Entry {
+	entry := log.WithContext(ctx.Request().Context()).WithField("client_ip", ctx.RealIP())
+	if principal, ok := principalOf(ctx); ok {
+		entry = entry.WithFields(log.Fields{"auth_method": principal.Method, "subject": principal.Subject})
+	}
+	return entry
+}
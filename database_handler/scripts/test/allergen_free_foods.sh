@@ -0,0 +1,73 @@
+#!/bin/bash
+#
+# Regression test: foods without any allergens must still be returned by
+# /front-page-events, with an empty allergen list instead of [""].
+
+set -euo pipefail
+
+HOST="${DH_HOST:-http://localhost:1313}"
+ISO_DATE="$(date -d '+1 day' +%F)"
+WEEKDAY="$(date -d '+1 day' +%A)"
+
+echo "Seeding allergen free foods for ${ISO_DATE}..."
+
+curl -sf -X POST "${HOST}/event" \
+  -H "Content-Type: application/json" \
+  -d '{
+    "weekday": "'"${WEEKDAY}"'",
+    "iso_date": "'"${ISO_DATE}"'",
+    "cuisine": "Mediterranean",
+    "entrees_and_sides": [
+      {
+        "name": "Bruschetta",
+        "allergens": [],
+        "preference": "vegan"
+      },
+      {
+        "name": "Falafel",
+        "allergens": ["sesame"],
+        "preference": "vegan"
+      }
+    ],
+    "salad_bar": {
+      "toppings": [
+        {
+          "name": "Cucumber",
+          "allergens": [],
+          "preference": "vegan"
+        }
+      ],
+      "dressings": [
+        {
+          "name": "Balsamic Vinaigrette",
+          "allergens": [],
+          "preference": "vegan"
+        }
+      ]
+    }
+  }' | jq '.'
+
+echo "Checking /front-page-events..."
+
+EVENT="$(curl -sf "${HOST}/front-page-events" | jq --arg date "${ISO_DATE}" '.events[] | select(.iso_date == $date)')"
+
+fail() {
+  echo "FAIL: $1"
+  echo "${EVENT}" | jq '.'
+  exit 1
+}
+
+[ -n "${EVENT}" ] || fail "event for ${ISO_DATE} not found on the front page"
+
+echo "${EVENT}" | jq -e '.entrees_and_sides[] | select(.name == "Bruschetta") | .allergens == []' > /dev/null \
+  || fail "Bruschetta missing or allergens not empty"
+echo "${EVENT}" | jq -e '.entrees_and_sides[] | select(.name == "Falafel") | .allergens == ["sesame"]' > /dev/null \
+  || fail "Falafel missing or allergens wrong"
+echo "${EVENT}" | jq -e '.salad_bar.toppings[] | select(.name == "Cucumber") | .allergens == []' > /dev/null \
+  || fail "Cucumber missing or allergens not empty"
+echo "${EVENT}" | jq -e '.salad_bar.dressings[] | select(.name == "Balsamic Vinaigrette") | .allergens == []' > /dev/null \
+  || fail "Balsamic Vinaigrette missing or allergens not empty"
+echo "${EVENT}" | jq -e '[.. | .allergens? // empty | .[] | select(. == "")] | length == 0' > /dev/null \
+  || fail "found an empty string allergen"
+
+echo "PASS"
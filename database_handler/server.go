@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/Failure-Enthusiasts/cater-me-up/internal/config"
+	"github.com/labstack/echo/v4"
+)
+
+// configureServer sets the address, timeouts, body limit and client IP of
+// the server, and TLS when a certificate is configured. The certificate is
+// returned so it can be watched for renewals, it is nil when serving plain
+// HTTP.
+func configureServer(e *echo.Echo, c *config.Config) (*certificate, error) {
+	e.Server.Addr = fmt.Sprintf(":%d", c.Port)
+	e.Server.ReadTimeout = c.HTTPReadTimeout
+	e.Server.ReadHeaderTimeout = c.HTTPReadTimeout
+	e.Server.WriteTimeout = c.HTTPWriteTimeout
+	e.Server.IdleTimeout = c.HTTPIdleTimeout
+	e.Use(bodyLimit(int64(c.HTTPMaxBodyBytes)))
+	// Clients are rate limited by IP. X-Forwarded-For is only trusted from
+	// proxies on private and loopback addresses, so it can't be spoofed
+	e.IPExtractor = echo.ExtractIPFromXFFHeader()
+
+	if c.TLSCertFile == "" {
+		return nil, nil
+	}
+	cert, err := loadCertificate(c.TLSCertFile, c.TLSKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	e.Server.TLSConfig = cert.TLSConfig()
+	return cert, nil
+}
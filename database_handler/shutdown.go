@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+var errShuttingDown = errors.New("shutting down")
+
+// drainingCheck fails once shutdown started, so the instance is taken out of
+// the load balancer before it stops accepting connections.
+func drainingCheck(draining *atomic.Bool) dependencyCheck {
+	return dependencyCheck{
+		name:    "shutdown",
+		failure: "shutting down",
+		run: func(context.Context) (string, map[string]any, error) {
+			if draining.Load() {
+				return healthFail, nil, errShuttingDown
+			}
+			return healthPass, nil, nil
+		},
+	}
+}
+
+// runServer runs e.Server, set up by configureServer, until ctx is done.
+// Readiness then fails for delay, the server stops accepting connections and
+// the requests in flight get timeout to finish. The connections of the
+// requests still running after that are closed, which cancels their context
+// and rolls back their transactions.
+func runServer(ctx context.Context, e *echo.Echo, draining *atomic.Bool, delay, timeout time.Duration) error {
+	errs := make(chan error, 1)
+	go func() {
+		errs <- e.StartServer(e.Server)
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.WithFields(log.Fields{"delay": delay, "timeout": timeout}).Info("shutting down, draining requests")
+	draining.Store(true)
+	select {
+	case err := <-errs:
+		return err
+	case <-time.After(delay):
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := e.Shutdown(shutdownCtx); err != nil {
+		log.WithError(err).Warn("requests still in flight after the shutdown timeout, closing their connections")
+		if err := e.Close(); err != nil {
+			log.WithError(err).Warn("failed to close connections")
+		}
+	}
+	if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
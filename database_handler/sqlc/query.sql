@@ -1,13 +1,18 @@
 -- Inserts
 
--- name: InsertCuisine :one
-INSERT INTO dogdish.cuisine (name) VALUES ($1) RETURNING id;
+-- name: UpsertCuisine :one
+INSERT INTO dogdish.cuisine (name) VALUES (BTRIM($1))
+ON CONFLICT ((LOWER(BTRIM(name)))) DO UPDATE SET name = dogdish.cuisine.name
+RETURNING id;
 
 -- name: InsertEvent :one
 INSERT INTO dogdish.event (date, iso_date) VALUES ($1, $2) RETURNING id;
 
--- name: InsertAllergen :one
-INSERT INTO dogdish.allergen (name) VALUES ($1) RETURNING id;
+-- name: UpsertAllergen :one
+-- xmax is only zero for rows inserted by this statement
+INSERT INTO dogdish.allergen (name) VALUES (BTRIM($1))
+ON CONFLICT ((LOWER(BTRIM(name)))) DO UPDATE SET name = dogdish.allergen.name
+RETURNING id, (xmax = 0)::boolean AS inserted;
 
 -- name: InsertFood :one
 INSERT INTO dogdish.food (cuisine_id, event_id, name, food_type, preference) VALUES ($1, $2, $3, $4, $5) RETURNING id;
@@ -30,13 +35,83 @@ SELECT
     f.food_type, 
     f.preference, 
     f.cuisine_id,
-    STRING_AGG(a.name, ',') as allergen_names
+    COALESCE(ARRAY_AGG(a.name ORDER BY a.name) FILTER (WHERE a.id IS NOT NULL), '{}')::text[] as allergen_names
 FROM dogdish.food f 
-JOIN dogdish.food_allergen fa ON f.id = fa.food_id 
-JOIN dogdish.allergen a ON fa.allergen_id = a.id 
+LEFT JOIN dogdish.food_allergen fa ON f.id = fa.food_id 
+LEFT JOIN dogdish.allergen a ON fa.allergen_id = a.id 
 WHERE event_id = $1
-GROUP BY f.name, f.food_type, f.preference, f.cuisine_id;
-
+GROUP BY f.id, f.name, f.food_type, f.preference, f.cuisine_id;
+
+
+-- name: GetFrontPageEvents :many
+WITH previous_event AS (
+    SELECT id, date, iso_date, updated_at FROM dogdish.event WHERE iso_date < CURRENT_DATE ORDER BY iso_date DESC LIMIT 1
+), current_event AS (
+    SELECT id, date, iso_date, updated_at FROM dogdish.event WHERE iso_date = CURRENT_DATE LIMIT 1
+), future_events AS (
+    SELECT id, date, iso_date, updated_at FROM dogdish.event WHERE iso_date > CURRENT_DATE ORDER BY iso_date
+    LIMIT CASE
+        WHEN EXISTS (SELECT 1 FROM previous_event) OR EXISTS (SELECT 1 FROM current_event) THEN 2
+        ELSE 1
+    END
+), front_page_events AS (
+    SELECT id, date, iso_date, updated_at FROM previous_event
+    UNION ALL
+    SELECT id, date, iso_date, updated_at FROM current_event
+    UNION ALL
+    SELECT id, date, iso_date, updated_at FROM future_events
+)
+SELECT
+    e.id,
+    e.date,
+    e.iso_date,
+    e.updated_at,
+    ef.cuisine::text AS cuisine,
+    ef.foods::json AS foods
+FROM front_page_events e
+JOIN LATERAL dogdish.event_foods(e.id) ef ON true
+ORDER BY e.iso_date;
+
+-- name: GetEventById :one
+SELECT
+    e.id,
+    e.date,
+    e.iso_date,
+    e.updated_at,
+    COALESCE(ef.cuisine, '')::text AS cuisine,
+    COALESCE(ef.foods, '[]')::json AS foods
+FROM dogdish.event e
+LEFT JOIN LATERAL dogdish.event_foods(e.id) ef ON true
+WHERE e.id = $1;
+
+-- name: ListEvents :many
+SELECT
+    e.id,
+    e.date,
+    e.iso_date,
+    e.updated_at,
+    COALESCE(ef.cuisine, '')::text AS cuisine,
+    COALESCE(ef.foods, '[]')::json AS foods
+FROM dogdish.event e
+LEFT JOIN LATERAL dogdish.event_foods(e.id) ef ON true
+ORDER BY e.iso_date;
+
+-- name: ListEventsByDate :many
+SELECT
+    e.id,
+    e.date,
+    e.iso_date,
+    e.updated_at,
+    COALESCE(ef.cuisine, '')::text AS cuisine,
+    COALESCE(ef.foods, '[]')::json AS foods
+FROM dogdish.event e
+LEFT JOIN LATERAL dogdish.event_foods(e.id) ef ON true
+WHERE e.iso_date = $1
+ORDER BY e.id;
+
+-- name: NotifyEventChange :exec
+-- Delivered to the listeners when the transaction commits
+SELECT pg_notify('dogdish_events', sqlc.arg(payload)::text);
 
 -- name: GetCuisineById :one
 SELECT id, name FROM dogdish.cuisine WHERE id = $1;
@@ -69,3 +144,42 @@ SELECT * FROM dogdish.food WHERE event_id = $1;
 -- name: GetAllFoodsByCuisineId :many
 SELECT * FROM dogdish.food WHERE cuisine_id = $1;
 
+
+-- API keys
+
+-- name: InsertAPIKey :one
+INSERT INTO dogdish.api_key (name, prefix, hash, scope) VALUES ($1, $2, $3, $4)
+RETURNING id, name, prefix, hash, scope, created_at, last_used_at, revoked_at;
+
+-- name: GetActiveAPIKeyByHash :one
+SELECT id, name, prefix, hash, scope, created_at, last_used_at, revoked_at
+FROM dogdish.api_key
+WHERE hash = $1 AND revoked_at IS NULL;
+
+-- name: TouchAPIKey :exec
+-- Written at most once a minute, so authenticating doesn't write on every request
+UPDATE dogdish.api_key SET last_used_at = now()
+WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < now() - INTERVAL '1 minute');
+
+-- name: ListAPIKeys :many
+SELECT id, name, prefix, hash, scope, created_at, last_used_at, revoked_at
+FROM dogdish.api_key
+ORDER BY created_at, id;
+
+-- name: RevokeAPIKey :execrows
+-- Revoking a revoked key keeps the first revocation time
+UPDATE dogdish.api_key SET revoked_at = COALESCE(revoked_at, now()) WHERE id = $1;
+
+-- name: TakeRateLimitToken :one
+-- Refills the bucket for the time since its last update and takes a token if there is one, in one statement so replicas can't both take the last token
+INSERT INTO dogdish.rate_limit_bucket AS bucket (key, tokens, allowed, updated_at)
+VALUES (sqlc.arg(key), sqlc.arg(burst)::float8 - 1, true, now())
+ON CONFLICT (key) DO UPDATE SET
+  tokens = LEAST(sqlc.arg(burst)::float8, bucket.tokens + EXTRACT(EPOCH FROM now() - bucket.updated_at)::float8 * sqlc.arg(rate)::float8)
+    - CASE WHEN LEAST(sqlc.arg(burst)::float8, bucket.tokens + EXTRACT(EPOCH FROM now() - bucket.updated_at)::float8 * sqlc.arg(rate)::float8) >= 1 THEN 1 ELSE 0 END,
+  allowed = LEAST(sqlc.arg(burst)::float8, bucket.tokens + EXTRACT(EPOCH FROM now() - bucket.updated_at)::float8 * sqlc.arg(rate)::float8) >= 1,
+  updated_at = now()
+RETURNING tokens, allowed;
+
+-- name: DeleteIdleRateLimitBuckets :execrows
+DELETE FROM dogdish.rate_limit_bucket WHERE updated_at < $1;
@@ -10,7 +10,8 @@ CREATE TABLE dogdish.cuisine (
 CREATE TABLE dogdish.event (
   id UUID UNIQUE NOT NULL DEFAULT gen_random_uuid(),
   date VARCHAR(255) NOT NULL,
-  iso_date DATE NOT NULL
+  iso_date DATE NOT NULL,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
 );
 CREATE TABLE dogdish.allergen (
   id UUID UNIQUE NOT NULL DEFAULT gen_random_uuid(),
@@ -48,3 +49,52 @@ CREATE TABLE dogdish.food_allergen (
     REFERENCES dogdish.allergen(id)
     ON DELETE CASCADE
 );
+
+CREATE UNIQUE INDEX allergen_name_normalized_key ON dogdish.allergen (LOWER(BTRIM(name)));
+CREATE UNIQUE INDEX cuisine_name_normalized_key ON dogdish.cuisine (LOWER(BTRIM(name)));
+
+CREATE TABLE dogdish.api_key (
+  id UUID PRIMARY KEY NOT NULL DEFAULT gen_random_uuid(),
+  name VARCHAR(255) NOT NULL,
+  prefix VARCHAR(16) NOT NULL,
+  hash CHAR(64) UNIQUE NOT NULL,
+  scope VARCHAR(16) NOT NULL CHECK (scope IN ('read', 'write', 'admin')),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  last_used_at TIMESTAMPTZ NULL,
+  revoked_at TIMESTAMPTZ NULL
+);
+
+CREATE UNLOGGED TABLE dogdish.rate_limit_bucket (
+  key VARCHAR(255) PRIMARY KEY NOT NULL,
+  tokens DOUBLE PRECISION NOT NULL,
+  allowed BOOLEAN NOT NULL,
+  updated_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX rate_limit_bucket_updated_at_idx ON dogdish.rate_limit_bucket (updated_at);
+
+CREATE FUNCTION dogdish.event_foods(event_id UUID)
+RETURNS TABLE (cuisine TEXT, foods JSON)
+LANGUAGE sql STABLE
+AS $$
+    SELECT
+        MIN(c.name)::text,
+        JSON_AGG(
+            JSON_BUILD_OBJECT(
+                'name', f.name,
+                'food_type', f.food_type,
+                'preference', COALESCE(f.preference::text, ''),
+                'allergens', COALESCE(fa.allergen_names, '{}')
+            ) ORDER BY f.name
+        )
+    FROM dogdish.food f
+    JOIN dogdish.cuisine c ON c.id = f.cuisine_id
+    LEFT JOIN LATERAL (
+        SELECT ARRAY_AGG(a.name ORDER BY a.name) AS allergen_names
+        FROM dogdish.food_allergen fa
+        JOIN dogdish.allergen a ON a.id = fa.allergen_id
+        WHERE fa.food_id = f.id
+    ) fa ON true
+    WHERE f.event_id = $1
+    HAVING COUNT(f.id) > 0
+$$;
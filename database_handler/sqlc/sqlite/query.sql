@@ -0,0 +1,113 @@
+-- Inserts
+
+-- name: UpsertCuisine :one
+INSERT INTO cuisine (id, name) VALUES (?, TRIM(?))
+ON CONFLICT (LOWER(TRIM(name))) DO UPDATE SET name = cuisine.name
+RETURNING id;
+
+-- name: InsertEvent :one
+INSERT INTO event (id, date, iso_date, updated_at) VALUES (?, ?, ?, STRFTIME('%Y-%m-%dT%H:%M:%fZ', 'now')) RETURNING id;
+
+-- name: UpsertAllergen :one
+INSERT INTO allergen (id, name) VALUES (?, TRIM(?))
+ON CONFLICT (LOWER(TRIM(name))) DO UPDATE SET name = allergen.name
+RETURNING id;
+
+-- name: InsertFood :one
+INSERT INTO food (id, cuisine_id, event_id, name, food_type, preference) VALUES (?, ?, ?, ?, ?, ?) RETURNING id;
+
+-- name: InsertFoodAllergen :exec
+INSERT INTO food_allergen (food_id, allergen_id) VALUES (?, ?);
+
+-- Selects
+
+-- name: GetFrontPageEvents :many
+WITH previous_event AS (
+    SELECT id, date, iso_date, updated_at FROM event WHERE iso_date < DATE('now', 'localtime') ORDER BY iso_date DESC LIMIT 1
+), current_event AS (
+    SELECT id, date, iso_date, updated_at FROM event WHERE iso_date = DATE('now', 'localtime') LIMIT 1
+), future_events AS (
+    SELECT id, date, iso_date, updated_at FROM event WHERE iso_date > DATE('now', 'localtime') ORDER BY iso_date
+    LIMIT CASE
+        WHEN EXISTS (SELECT 1 FROM previous_event) OR EXISTS (SELECT 1 FROM current_event) THEN 2
+        ELSE 1
+    END
+), front_page_events AS (
+    SELECT id, date, iso_date, updated_at FROM previous_event
+    UNION ALL
+    SELECT id, date, iso_date, updated_at FROM current_event
+    UNION ALL
+    SELECT id, date, iso_date, updated_at FROM future_events
+)
+SELECT
+    e.id,
+    e.date,
+    e.iso_date,
+    e.updated_at,
+    CAST(ef.cuisine AS TEXT) AS cuisine,
+    CAST(ef.foods AS TEXT) AS foods
+FROM front_page_events e
+JOIN event_foods ef ON ef.event_id = e.id
+ORDER BY e.iso_date;
+
+-- name: GetEventById :one
+SELECT
+    e.id,
+    e.date,
+    e.iso_date,
+    e.updated_at,
+    CAST(COALESCE(ef.cuisine, '') AS TEXT) AS cuisine,
+    CAST(COALESCE(ef.foods, '[]') AS TEXT) AS foods
+FROM event e
+LEFT JOIN event_foods ef ON ef.event_id = e.id
+WHERE e.id = ?;
+
+-- name: ListEvents :many
+SELECT
+    e.id,
+    e.date,
+    e.iso_date,
+    e.updated_at,
+    CAST(COALESCE(ef.cuisine, '') AS TEXT) AS cuisine,
+    CAST(COALESCE(ef.foods, '[]') AS TEXT) AS foods
+FROM event e
+LEFT JOIN event_foods ef ON ef.event_id = e.id
+ORDER BY e.iso_date;
+
+-- name: ListEventsByDate :many
+SELECT
+    e.id,
+    e.date,
+    e.iso_date,
+    e.updated_at,
+    CAST(COALESCE(ef.cuisine, '') AS TEXT) AS cuisine,
+    CAST(COALESCE(ef.foods, '[]') AS TEXT) AS foods
+FROM event e
+LEFT JOIN event_foods ef ON ef.event_id = e.id
+WHERE e.iso_date = ?
+ORDER BY e.id;
+
+-- API keys
+
+-- name: InsertAPIKey :one
+INSERT INTO api_key (id, name, prefix, hash, scope, created_at) VALUES (?, ?, ?, ?, ?, STRFTIME('%Y-%m-%dT%H:%M:%fZ', 'now'))
+RETURNING id, name, prefix, hash, scope, created_at, last_used_at, revoked_at;
+
+-- name: GetActiveAPIKeyByHash :one
+SELECT id, name, prefix, hash, scope, created_at, last_used_at, revoked_at
+FROM api_key
+WHERE hash = ? AND revoked_at IS NULL;
+
+-- name: TouchAPIKey :exec
+-- Written at most once a minute, so authenticating doesn't write on every request
+UPDATE api_key SET last_used_at = STRFTIME('%Y-%m-%dT%H:%M:%fZ', 'now')
+WHERE id = ? AND (last_used_at IS NULL OR last_used_at < STRFTIME('%Y-%m-%dT%H:%M:%fZ', 'now', '-1 minute'));
+
+-- name: ListAPIKeys :many
+SELECT id, name, prefix, hash, scope, created_at, last_used_at, revoked_at
+FROM api_key
+ORDER BY created_at, id;
+
+-- name: RevokeAPIKey :execrows
+-- Revoking a revoked key keeps the first revocation time
+UPDATE api_key SET revoked_at = COALESCE(revoked_at, STRFTIME('%Y-%m-%dT%H:%M:%fZ', 'now')) WHERE id = ?;
@@ -0,0 +1,63 @@
+CREATE TABLE cuisine (
+  id TEXT PRIMARY KEY NOT NULL,
+  name TEXT NOT NULL
+);
+CREATE TABLE event (
+  id TEXT PRIMARY KEY NOT NULL,
+  date TEXT NOT NULL,
+  iso_date TEXT NOT NULL,
+  updated_at TEXT NOT NULL DEFAULT '1970-01-01T00:00:00Z'
+);
+CREATE TABLE allergen (
+  id TEXT PRIMARY KEY NOT NULL,
+  name TEXT NOT NULL
+);
+CREATE TABLE food (
+  id TEXT PRIMARY KEY NOT NULL,
+  cuisine_id TEXT NOT NULL REFERENCES cuisine(id) ON DELETE CASCADE,
+  event_id TEXT NOT NULL REFERENCES event(id) ON DELETE CASCADE,
+  name TEXT NOT NULL,
+  food_type TEXT NOT NULL CHECK (food_type IN ('entrees_and_sides', 'toppings', 'dressings')),
+  preference TEXT NULL CHECK (preference IN ('', 'vegan', 'vegetarian'))
+);
+CREATE TABLE food_allergen (
+  food_id TEXT NOT NULL REFERENCES food(id) ON DELETE CASCADE,
+  allergen_id TEXT NOT NULL REFERENCES allergen(id) ON DELETE CASCADE
+);
+CREATE TABLE api_key (
+  id TEXT PRIMARY KEY NOT NULL,
+  name TEXT NOT NULL,
+  prefix TEXT NOT NULL,
+  hash TEXT UNIQUE NOT NULL,
+  scope TEXT NOT NULL CHECK (scope IN ('read', 'write', 'admin')),
+  created_at TEXT NOT NULL,
+  last_used_at TEXT NULL,
+  revoked_at TEXT NULL
+);
+
+CREATE INDEX event_iso_date_idx ON event (iso_date);
+CREATE INDEX food_event_id_idx ON food (event_id);
+CREATE INDEX food_allergen_food_id_idx ON food_allergen (food_id);
+CREATE UNIQUE INDEX allergen_name_normalized_key ON allergen (LOWER(TRIM(name)));
+CREATE UNIQUE INDEX cuisine_name_normalized_key ON cuisine (LOWER(TRIM(name)));
+
+CREATE VIEW event_foods AS
+SELECT
+    f.event_id,
+    MIN(c.name) AS cuisine,
+    JSON_GROUP_ARRAY(
+        JSON_OBJECT(
+            'name', f.name,
+            'food_type', f.food_type,
+            'preference', COALESCE(f.preference, ''),
+            'allergens', JSON((
+                SELECT JSON_GROUP_ARRAY(a.name ORDER BY a.name)
+                FROM food_allergen fa
+                JOIN allergen a ON a.id = fa.allergen_id
+                WHERE fa.food_id = f.id
+            ))
+        ) ORDER BY f.name
+    ) AS foods
+FROM food f
+JOIN cuisine c ON c.id = f.cuisine_id
+GROUP BY f.event_id;
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// certificate serves the TLS certificate from certFile and keyFile, so a
+// renewed certificate is used without a restart.
+type certificate struct {
+	certFile string
+	keyFile  string
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+func loadCertificate(certFile, keyFile string) (*certificate, error) {
+	c := &certificate{certFile: certFile, keyFile: keyFile}
+	if _, err := c.reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// reload reads the files again and reports whether the certificate changed.
+// The current certificate is kept when they can't be loaded, such as while
+// they are half written.
+func (c *certificate) reload() (bool, error) {
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("failed to load the TLS certificate: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	changed := c.cert == nil || !bytes.Equal(c.cert.Certificate[0], cert.Certificate[0])
+	c.cert = &cert
+	return changed, nil
+}
+
+// GetCertificate is the tls.Config callback.
+func (c *certificate) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, nil
+}
+
+// TLSConfig returns a TLS 1.2+ configuration serving the certificate.
+func (c *certificate) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: c.GetCertificate,
+	}
+}
+
+// watch reloads the certificate every interval until ctx is done.
+func (c *certificate) watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			changed, err := c.reload()
+			if err != nil {
+				log.WithError(err).Warn("keeping the current TLS certificate")
+				continue
+			}
+			if changed {
+				log.WithFields(log.Fields{"cert_file": c.certFile}).Info("reloaded the TLS certificate")
+			}
+		}
+	}
+}
@@ -14,10 +14,11 @@ from logger import logger
 
 GEMINI_API_KEY = os.environ.get("GEMINI_API_KEY")
 DATABASE_HANDLER_HOST = os.environ.get("PH_DH_HOST")
+DATABASE_HANDLER_API_KEY = os.environ.get("PH_DH_API_KEY")
 DD_VERSION = os.environ.get("DD_VERSION")
 
-if GEMINI_API_KEY is None or DATABASE_HANDLER_HOST is None:
-    print("Error: Required environment variables GEMINI_API_KEY or PH_DH_HOST are not set.")
+if GEMINI_API_KEY is None or DATABASE_HANDLER_HOST is None or DATABASE_HANDLER_API_KEY is None:
+    print("Error: Required environment variables GEMINI_API_KEY, PH_DH_HOST or PH_DH_API_KEY are not set.")
     sys.exit(1)
 
 app = FastAPI(
@@ -127,7 +128,11 @@ def save_event(
     logger.debug("json data received", extra={"client_ip": request.client.host, "data": json_event})
 
     logger.debug(f"submitting data to database handler at {DATABASE_HANDLER_HOST}/event", extra={"client_ip": request.client.host})
-    response = httpx.post(f"{DATABASE_HANDLER_HOST}/event", json=json_event)
+    response = httpx.post(
+        f"{DATABASE_HANDLER_HOST}/event",
+        json=json_event,
+        headers={"X-API-Key": DATABASE_HANDLER_API_KEY},
+    )
     if response.status_code == 200:
         msg = "event successfully stored"
         event_id = response.json()["event_id"]